@@ -3,7 +3,12 @@ package server
 import (
 	"github.com/absurdlab/tigerd/cmd/server/internal/handler"
 	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/client"
 	"github.com/absurdlab/tigerd/internal/healthprobe"
+	"github.com/absurdlab/tigerd/internal/logout"
+	"github.com/absurdlab/tigerd/internal/storage"
+	"github.com/absurdlab/tigerd/internal/token"
+	"github.com/absurdlab/tigerd/internal/userinfo"
 	"github.com/absurdlab/tigerd/internal/wellknown"
 	"github.com/hellofresh/health-go/v5"
 	"github.com/labstack/echo/v4"
@@ -23,18 +28,40 @@ func Command() *cli.Command {
 			EnvVars: []string{"TIGERD_CONFIG"},
 		},
 		altsrc.NewIntFlag(cfg.portFlag()),
+		altsrc.NewStringFlag(cfg.errorURIFlag()),
 		altsrc.NewStringFlag(cfg.loggingLevelFlag()),
 		altsrc.NewBoolFlag(cfg.loggingJSONFormatFlag()),
 		altsrc.NewStringFlag(cfg.discoveryValueFlag()),
 		altsrc.NewBoolFlag(cfg.discoverySkipValidationFlag()),
 		altsrc.NewStringFlag(cfg.jwksValueFlag()),
+		altsrc.NewDurationFlag(cfg.authorizeSessionLifespanFlag()),
+		altsrc.NewDurationFlag(cfg.authorizeLoginSessionLifespanFlag()),
+		altsrc.NewDurationFlag(cfg.authorizeCodeLifespanFlag()),
+		altsrc.NewDurationFlag(cfg.tokenAccessTokenLifespanFlag()),
+		altsrc.NewDurationFlag(cfg.tokenIDTokenLifespanFlag()),
+		altsrc.NewDurationFlag(cfg.tokenRefreshTokenLifespanFlag()),
+		altsrc.NewStringFlag(cfg.registrationInitialAccessTokenFlag()),
+		altsrc.NewDurationFlag(cfg.clientKeysTimeoutFlag()),
+		altsrc.NewDurationFlag(cfg.clientKeysCacheTTLFlag()),
+		altsrc.NewIntFlag(cfg.logoutBackChannelAttemptsFlag()),
+		altsrc.NewDurationFlag(cfg.logoutBackChannelTimeoutFlag()),
+		altsrc.NewStringFlag(cfg.storageBackendFlag()),
+		altsrc.NewStringFlag(cfg.storagePathFlag()),
+		altsrc.NewStringFlag(cfg.storageRedisURLFlag()),
+		altsrc.NewStringFlag(cfg.storageRedisKeyPrefixFlag()),
+		altsrc.NewDurationFlag(cfg.storageSweepIntervalFlag()),
 	}
 
 	return &cli.Command{
 		Name:        "server",
 		Description: "Launch the tigerd server.",
 		Flags:       flags,
-		Before:      altsrc.InitInputSourceWithContext(flags, altsrc.NewYamlSourceFromFlagFunc("config")),
+		Before: func(cc *cli.Context) error {
+			if err := altsrc.InitInputSourceWithContext(flags, altsrc.NewYamlSourceFromFlagFunc("config"))(cc); err != nil {
+				return err
+			}
+			return cfg.readFile(cc.String("config"))
+		},
 		Action: func(cc *cli.Context) error {
 			return fx.New(
 				fx.NopLogger,
@@ -54,11 +81,43 @@ func Command() *cli.Command {
 					newProviderProperties,
 					healthprobe.Out(authorize.NewProviderHealthProbes),
 				),
+				fx.Provide(newStorageProperties),
+				storage.Provide(newStorage),
+				fx.Provide(
+					newAuthorizeProperties,
+					authorize.NewService,
+				),
+				fx.Provide(
+					newKeysProperties,
+					client.NewKeyFetcher,
+					newClientRegistry,
+					newRegistrationProperties,
+					client.NewRegistrationService,
+					client.NewAuthenticator,
+				),
+				fx.Provide(
+					newTokenProperties,
+					token.NewService,
+				),
+				fx.Provide(
+					userinfo.NewService,
+				),
+				fx.Provide(
+					newLogoutProperties,
+					logout.NewService,
+				),
 				fx.Provide(
 					handler.Out(handler.NewWellKnownHandler),
 					handler.Out(handler.NewUnderscoreHandler),
+					handler.Out(handler.NewAuthorizeHandler),
+					handler.Out(handler.NewCallbackHandler),
+					handler.Out(handler.NewTokenHandler),
+					handler.Out(handler.NewRegisterHandler),
+					handler.Out(handler.NewUserInfoHandler),
+					handler.Out(handler.NewLogoutHandler),
 				),
 				fx.Invoke(
+					closeLogoutService,
 					healthprobe.In0(registerHealthProbes),
 					handler.In0(startServer),
 				),
@@ -67,6 +126,11 @@ func Command() *cli.Command {
 	}
 }
 
+// closeLogoutService waits for the back-channel logout deliveries in flight when the server stops.
+func closeLogoutService(service *logout.Service, lc fx.Lifecycle) {
+	lc.Append(fx.Hook{OnStop: service.Close})
+}
+
 func registerHealthProbes(probes []healthprobe.Interface, h *health.Health) error {
 	for _, probe := range probes {
 		if err := probe.Register(h); err != nil {
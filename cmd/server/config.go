@@ -4,16 +4,27 @@ import (
 	"errors"
 	"fmt"
 	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/storage"
 	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+	"os"
+	"time"
 )
 
 const (
 	categoryServer    = "server"
 	categoryWellKnown = "well-known"
+	categoryAuthorize = "authorize"
+	categoryToken     = "token"
+	categoryClient    = "client"
+	categoryLogout    = "logout"
+	categoryStorage   = "storage"
 )
 
 type config struct {
-	Port int `yaml:"port"`
+	Port     int    `yaml:"port"`
+	ErrorURI string `yaml:"error_uri"`
 
 	Logging struct {
 		Level      string `yaml:"level"`
@@ -29,7 +40,62 @@ type config struct {
 		Value string `yaml:"value"`
 	} `yaml:"jwks"`
 
+	Authorize struct {
+		SessionLifespan      time.Duration `yaml:"session_lifespan"`
+		LoginSessionLifespan time.Duration `yaml:"login_session_lifespan"`
+		CodeLifespan         time.Duration `yaml:"code_lifespan"`
+	} `yaml:"authorize"`
+
+	Token struct {
+		AccessTokenLifespan  time.Duration `yaml:"access_token_lifespan"`
+		IDTokenLifespan      time.Duration `yaml:"id_token_lifespan"`
+		RefreshTokenLifespan time.Duration `yaml:"refresh_token_lifespan"`
+	} `yaml:"token"`
+
+	Registration struct {
+		InitialAccessToken string `yaml:"initial_access_token"`
+	} `yaml:"registration"`
+
+	ClientKeys struct {
+		Timeout  time.Duration `yaml:"timeout"`
+		CacheTTL time.Duration `yaml:"cache_ttl"`
+	} `yaml:"client_keys"`
+
+	Logout struct {
+		BackChannelAttempts int           `yaml:"backchannel_attempts"`
+		BackChannelTimeout  time.Duration `yaml:"backchannel_timeout"`
+	} `yaml:"logout"`
+
+	Storage struct {
+		Backend        string        `yaml:"backend"`
+		Path           string        `yaml:"path"`
+		RedisURL       string        `yaml:"redis_url"`
+		RedisKeyPrefix string        `yaml:"redis_key_prefix"`
+		SweepInterval  time.Duration `yaml:"sweep_interval"`
+	} `yaml:"storage"`
+
+	sections
+}
+
+// sections holds the configuration that is too structured to be expressed as flags, and therefore can only be
+// sourced from the configuration file.
+type sections struct {
 	Providers []*authorize.ProviderProperties `yaml:"providers"`
+	Clients   []*client.Client                `yaml:"clients"`
+}
+
+// readFile reads sections from the yaml configuration file at path. Empty path is ignored.
+func (c *config) readFile(path string) error {
+	if len(path) == 0 {
+		return nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return yaml.Unmarshal(raw, &c.sections)
 }
 
 func (c config) address() string {
@@ -53,6 +119,16 @@ func (c *config) portFlag() *cli.IntFlag {
 	}
 }
 
+func (c *config) errorURIFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:        "error_uri",
+		Category:    categoryServer,
+		Usage:       "URI of a web page documenting errors, included as error_uri in error responses with the error code as fragment.",
+		Destination: &c.ErrorURI,
+		EnvVars:     []string{"TIGERD_ERROR_URI"},
+	}
+}
+
 func (c *config) loggingLevelFlag() *cli.StringFlag {
 	return &cli.StringFlag{
 		Name:        "logging.level",
@@ -106,3 +182,177 @@ func (c *config) jwksValueFlag() *cli.StringFlag {
 		EnvVars:     []string{"TIGERD_JWKS_VALUE"},
 	}
 }
+
+func (c *config) authorizeSessionLifespanFlag() *cli.DurationFlag {
+	return &cli.DurationFlag{
+		Name:        "authorize.session_lifespan",
+		Category:    categoryAuthorize,
+		Usage:       "Maximum duration of an authorization session.",
+		Value:       10 * time.Minute,
+		Destination: &c.Authorize.SessionLifespan,
+		EnvVars:     []string{"TIGERD_AUTHORIZE_SESSION_LIFESPAN"},
+	}
+}
+
+func (c *config) authorizeLoginSessionLifespanFlag() *cli.DurationFlag {
+	return &cli.DurationFlag{
+		Name:        "authorize.login_session_lifespan",
+		Category:    categoryAuthorize,
+		Usage:       "Maximum duration End-User authentications are remembered in a user agent.",
+		Value:       24 * time.Hour,
+		Destination: &c.Authorize.LoginSessionLifespan,
+		EnvVars:     []string{"TIGERD_AUTHORIZE_LOGIN_SESSION_LIFESPAN"},
+	}
+}
+
+func (c *config) authorizeCodeLifespanFlag() *cli.DurationFlag {
+	return &cli.DurationFlag{
+		Name:        "authorize.code_lifespan",
+		Category:    categoryAuthorize,
+		Usage:       "Duration an authorization code remains redeemable.",
+		Value:       time.Minute,
+		Destination: &c.Authorize.CodeLifespan,
+		EnvVars:     []string{"TIGERD_AUTHORIZE_CODE_LIFESPAN"},
+	}
+}
+
+func (c *config) tokenAccessTokenLifespanFlag() *cli.DurationFlag {
+	return &cli.DurationFlag{
+		Name:        "token.access_token_lifespan",
+		Category:    categoryToken,
+		Usage:       "Duration an access token remains valid.",
+		Value:       time.Hour,
+		Destination: &c.Token.AccessTokenLifespan,
+		EnvVars:     []string{"TIGERD_TOKEN_ACCESS_TOKEN_LIFESPAN"},
+	}
+}
+
+func (c *config) tokenIDTokenLifespanFlag() *cli.DurationFlag {
+	return &cli.DurationFlag{
+		Name:        "token.id_token_lifespan",
+		Category:    categoryToken,
+		Usage:       "Duration an id_token remains valid.",
+		Value:       time.Hour,
+		Destination: &c.Token.IDTokenLifespan,
+		EnvVars:     []string{"TIGERD_TOKEN_ID_TOKEN_LIFESPAN"},
+	}
+}
+
+func (c *config) tokenRefreshTokenLifespanFlag() *cli.DurationFlag {
+	return &cli.DurationFlag{
+		Name:        "token.refresh_token_lifespan",
+		Category:    categoryToken,
+		Usage:       "Duration a refresh token remains valid, renewed on every rotation.",
+		Value:       30 * 24 * time.Hour,
+		Destination: &c.Token.RefreshTokenLifespan,
+		EnvVars:     []string{"TIGERD_TOKEN_REFRESH_TOKEN_LIFESPAN"},
+	}
+}
+
+func (c *config) registrationInitialAccessTokenFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:        "registration.initial_access_token",
+		Category:    categoryClient,
+		Usage:       "Bearer token required to dynamically register clients. Registration is open when empty.",
+		Destination: &c.Registration.InitialAccessToken,
+		EnvVars:     []string{"TIGERD_REGISTRATION_INITIAL_ACCESS_TOKEN"},
+	}
+}
+
+func (c *config) clientKeysTimeoutFlag() *cli.DurationFlag {
+	return &cli.DurationFlag{
+		Name:        "client_keys.timeout",
+		Category:    categoryClient,
+		Usage:       "Maximum duration of fetching the key set registered by a client as jwks_uri.",
+		Value:       10 * time.Second,
+		Destination: &c.ClientKeys.Timeout,
+		EnvVars:     []string{"TIGERD_CLIENT_KEYS_TIMEOUT"},
+	}
+}
+
+func (c *config) clientKeysCacheTTLFlag() *cli.DurationFlag {
+	return &cli.DurationFlag{
+		Name:        "client_keys.cache_ttl",
+		Category:    categoryClient,
+		Usage:       "Duration a key set fetched from a client jwks_uri is reused before it is fetched again.",
+		Value:       5 * time.Minute,
+		Destination: &c.ClientKeys.CacheTTL,
+		EnvVars:     []string{"TIGERD_CLIENT_KEYS_CACHE_TTL"},
+	}
+}
+
+func (c *config) logoutBackChannelAttemptsFlag() *cli.IntFlag {
+	return &cli.IntFlag{
+		Name:        "logout.backchannel_attempts",
+		Category:    categoryLogout,
+		Usage:       "Maximum number of attempts to deliver a logout token to a back-channel logout uri.",
+		Value:       3,
+		Destination: &c.Logout.BackChannelAttempts,
+		EnvVars:     []string{"TIGERD_LOGOUT_BACKCHANNEL_ATTEMPTS"},
+	}
+}
+
+func (c *config) logoutBackChannelTimeoutFlag() *cli.DurationFlag {
+	return &cli.DurationFlag{
+		Name:        "logout.backchannel_timeout",
+		Category:    categoryLogout,
+		Usage:       "Maximum duration of each attempt to deliver a logout token.",
+		Value:       5 * time.Second,
+		Destination: &c.Logout.BackChannelTimeout,
+		EnvVars:     []string{"TIGERD_LOGOUT_BACKCHANNEL_TIMEOUT"},
+	}
+}
+
+func (c *config) storageBackendFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:        "storage.backend",
+		Category:    categoryStorage,
+		Usage:       "Storage backend for sessions, grants and tokens: memory, bolt or redis.",
+		Value:       storage.BackendMemory,
+		Destination: &c.Storage.Backend,
+		EnvVars:     []string{"TIGERD_STORAGE_BACKEND"},
+	}
+}
+
+func (c *config) storagePathFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:        "storage.path",
+		Category:    categoryStorage,
+		Usage:       "Path to the database file, for the bolt storage backend.",
+		Value:       "tigerd.db",
+		Destination: &c.Storage.Path,
+		EnvVars:     []string{"TIGERD_STORAGE_PATH"},
+	}
+}
+
+func (c *config) storageRedisURLFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:        "storage.redis_url",
+		Category:    categoryStorage,
+		Usage:       "Url of the Redis server, for the redis storage backend, i.e. redis://<user>:<password>@<host>:<port>/<db>.",
+		Destination: &c.Storage.RedisURL,
+		EnvVars:     []string{"TIGERD_STORAGE_REDIS_URL"},
+	}
+}
+
+func (c *config) storageRedisKeyPrefixFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:        "storage.redis_key_prefix",
+		Category:    categoryStorage,
+		Usage:       "Prefix of all keys, for the redis storage backend.",
+		Value:       "tigerd:",
+		Destination: &c.Storage.RedisKeyPrefix,
+		EnvVars:     []string{"TIGERD_STORAGE_REDIS_KEY_PREFIX"},
+	}
+}
+
+func (c *config) storageSweepIntervalFlag() *cli.DurationFlag {
+	return &cli.DurationFlag{
+		Name:        "storage.sweep_interval",
+		Category:    categoryStorage,
+		Usage:       "Interval to evict expired records at, for storage backends without native expiry.",
+		Value:       time.Minute,
+		Destination: &c.Storage.SweepInterval,
+		EnvVars:     []string{"TIGERD_STORAGE_SWEEP_INTERVAL"},
+	}
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/wellknown"
+	"github.com/labstack/echo/v4"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+const (
+	// sidCookie is the cookie binding the user agent to its authorize.LoginSession.
+	sidCookie = "tigerd_sid"
+	// bindingCookie is the cookie binding the user agent to the authorization sessions it started, so that they are
+	// only resumed by the same user agent.
+	bindingCookie = "tigerd_binding"
+)
+
+func NewAuthorizeHandler(discovery *wellknown.Discovery, service *authorize.Service) Interface {
+	return &authorizeHandler{
+		secure:  strings.HasPrefix(discovery.Issuer, "https://"),
+		service: service,
+	}
+}
+
+type authorizeHandler struct {
+	secure  bool
+	service *authorize.Service
+}
+
+func (h *authorizeHandler) Mount(e *echo.Echo) error {
+	e.GET("/oauth/authorize", h.authorize)
+	e.POST("/oauth/authorize", h.authorize)
+	e.GET("/oauth/authorize/resume", h.resume)
+
+	return nil
+}
+
+func (h *authorizeHandler) authorize(c echo.Context) error {
+	values, err := c.FormParams()
+	if err != nil {
+		return err
+	}
+
+	req, err := authorize.ParseRequest(values)
+	if err != nil {
+		return errorPage(h.service.Reject(c.Request().Context(), req, err))
+	}
+
+	resp, err := h.service.Authorize(c.Request().Context(), req, h.cookie(c, sidCookie), h.cookie(c, bindingCookie))
+	if err != nil {
+		return errorPage(err)
+	}
+
+	return h.render(c, resp)
+}
+
+func (h *authorizeHandler) resume(c echo.Context) error {
+	resp, err := h.service.Resume(c.Request().Context(), c.QueryParam("session_id"), h.cookie(c, bindingCookie))
+	if err != nil {
+		return errorPage(err)
+	}
+
+	return h.render(c, resp)
+}
+
+func (h *authorizeHandler) cookie(c echo.Context, name string) string {
+	cookie, err := c.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func (h *authorizeHandler) render(c echo.Context, resp *authorize.Response) error {
+	if len(resp.Sid) > 0 {
+		c.SetCookie(&http.Cookie{
+			Name:     sidCookie,
+			Value:    resp.Sid,
+			Path:     "/",
+			Secure:   h.secure,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	if len(resp.Binding) > 0 {
+		c.SetCookie(&http.Cookie{
+			Name:     bindingCookie,
+			Value:    resp.Binding,
+			Path:     "/oauth/authorize",
+			Secure:   h.secure,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	return writeAuthorizationResponse(c, resp)
+}
+
+// writeAuthorizationResponse delivers the authorization response, or the redirection to the provider, to the user
+// agent according to its response mode.
+func writeAuthorizationResponse(c echo.Context, resp *authorize.Response) error {
+	for k, v := range resp.Headers {
+		c.Response().Header().Set(k, v)
+	}
+
+	if resp.Mode == spec.ResponseModeFormPost {
+		// OAuth 2.0 Form Post Response Mode Section 2: the response must not be cached.
+		c.Response().Header().Set(echo.HeaderCacheControl, "no-cache, no-store")
+		c.Response().Header().Set("Pragma", "no-cache")
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+		c.Response().WriteHeader(http.StatusOK)
+		return formPostTemplate.Execute(c.Response(), resp)
+	}
+
+	location, err := resp.Location()
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(resp.Status, location)
+}
+
+// formPostTemplate renders the response in the form_post mode, as an HTML form which auto-submits Params to Target.
+var formPostTemplate = template.Must(template.New("form_post").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Submit This Form</title>
+</head>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{.Target}}">
+{{- range $name, $value := .Params}}
+<input type="hidden" name="{{$name}}" value="{{$value}}"/>
+{{- end}}
+<noscript><button type="submit">Continue</button></noscript>
+</form>
+</body>
+</html>
+`))
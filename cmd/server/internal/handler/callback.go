@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/proto/gen/go/proto/provider/v1/providerv1connect"
+	"github.com/labstack/echo/v4"
+)
+
+// NewCallbackHandler serves the CallbackService to the configured providers, which authenticate with their secret.
+func NewCallbackHandler(service *authorize.Service, providers []*authorize.ProviderProperties) Interface {
+	return &callbackHandler{service: service, providers: providers}
+}
+
+type callbackHandler struct {
+	service   *authorize.Service
+	providers []*authorize.ProviderProperties
+}
+
+func (h *callbackHandler) Mount(e *echo.Echo) error {
+	path, handler := providerv1connect.NewCallbackServiceHandler(authorize.NewCallbackServer(h.service, h.providers))
+	e.Any(path+"*", echo.WrapHandler(handler))
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Southclaws/fault"
+	"github.com/Southclaws/fault/fmsg"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+const (
+	schemeBasic  = "Basic"
+	schemeBearer = "Bearer"
+)
+
+// errorPageTemplate renders the error to the End-User, when the error cannot be returned to the client.
+var errorPageTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Authorization failed</title>
+</head>
+<body>
+<h1>Authorization failed</h1>
+<p>{{.ErrorDescription}}</p>
+<p>Error code: <code>{{.Error}}</code>{{if .ErrorURI}} (<a href="{{.ErrorURI}}">details</a>){{end}}</p>
+</body>
+</html>
+`))
+
+// NewErrorHandler returns the echo.HTTPErrorHandler which renders all errors returned by the endpoints. Authorization
+// errors are redirected to the client if possible, or displayed on a local error page otherwise. Other errors are
+// rendered as the JSON error response defined in RFC 6749 Section 5.2. If errorURI is not empty, it is included in
+// error responses as error_uri, with the error code as fragment. Causes of server errors are logged, but never rendered.
+func NewErrorHandler(errorURI string, logger *zerolog.Logger) echo.HTTPErrorHandler {
+	h := &errorHandler{errorURI: errorURI, logger: logger}
+	return h.handle
+}
+
+type errorHandler struct {
+	errorURI string
+	logger   *zerolog.Logger
+}
+
+// errorResponse is the error response defined in RFC 6749 Section 5.2.
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+	ErrorURI         string `json:"error_uri,omitempty"`
+}
+
+func (r *errorResponse) params() map[string]string {
+	params := map[string]string{"error": r.Error}
+	if len(r.ErrorDescription) > 0 {
+		params["error_description"] = r.ErrorDescription
+	}
+	if len(r.ErrorURI) > 0 {
+		params["error_uri"] = r.ErrorURI
+	}
+	return params
+}
+
+func (h *errorHandler) handle(err error, c echo.Context) {
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		err = fromHTTPError(httpErr)
+	}
+
+	var (
+		kind   = spec.GetErrorKind(err)
+		status = spec.GetErrorStatus(kind)
+	)
+
+	if kind == spec.ErrKindServerError {
+		h.logger.Error().
+			Err(err).
+			Interface("chain", fault.Flatten(err)).
+			Str("method", c.Request().Method).
+			Str("path", c.Request().URL.Path).
+			Msg("request failed with server error")
+	}
+
+	if c.Response().Committed {
+		return
+	}
+
+	if httpErr != nil && httpErr.Code >= 400 && httpErr.Code < 500 {
+		status = httpErr.Code
+	}
+
+	resp := &errorResponse{
+		Error:            string(kind),
+		ErrorDescription: spec.GetErrorMessage(err),
+	}
+	if len(h.errorURI) > 0 {
+		resp.ErrorURI = h.errorURI + "#" + string(kind)
+	}
+
+	if err = h.render(c, err, kind, status, resp); err != nil {
+		h.logger.Error().Err(err).Msg("failed to render error response")
+	}
+}
+
+func (h *errorHandler) render(c echo.Context, err error, kind ftag.Kind, status int, resp *errorResponse) error {
+	var redirectErr *authorize.RedirectError
+	if errors.As(err, &redirectErr) {
+		authResp, err := redirectErr.Response(c.Request().Context(), resp.params())
+		if err != nil {
+			// the error cannot be returned to the client without its response encoding, so it is displayed instead.
+			h.logger.Error().Err(err).Msg("failed to encode authorization error response")
+			return h.page(c, http.StatusInternalServerError, &errorResponse{Error: string(spec.ErrKindServerError)})
+		}
+		return writeAuthorizationResponse(c, authResp)
+	}
+
+	if errors.As(err, new(*pageError)) {
+		return h.page(c, status, resp)
+	}
+
+	var challengeErr *challengeError
+	if errors.As(err, &challengeErr) {
+		if challenge := challengeErr.challenge(kind, resp); len(challenge) > 0 {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, challenge)
+		}
+	}
+
+	if c.Request().Method == http.MethodHead {
+		return c.NoContent(status)
+	}
+
+	return c.JSON(status, resp)
+}
+
+// page displays the error response on the local error page.
+func (h *errorHandler) page(c echo.Context, status int, resp *errorResponse) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+	c.Response().WriteHeader(status)
+	return errorPageTemplate.Execute(c.Response(), resp)
+}
+
+// fromHTTPError converts the errors raised by echo itself, such as for unknown routes, into tagged errors.
+func fromHTTPError(err *echo.HTTPError) error {
+	var kind ftag.Kind
+	switch {
+	case err.Code == http.StatusNotFound:
+		kind = spec.ErrKindResourceNotFound
+	case err.Code >= 400 && err.Code < 500:
+		kind = spec.ErrKindInvalidRequest
+	default:
+		kind = spec.ErrKindServerError
+	}
+
+	message := http.StatusText(err.Code)
+	if m, ok := err.Message.(string); ok && len(m) > 0 {
+		message = m
+	}
+	if kind == spec.ErrKindServerError {
+		message = ""
+	}
+
+	return fault.Wrap(err, ftag.With(kind), fmsg.WithDesc(err.Error(), message))
+}
+
+// challengeError is an error of an endpoint protected by an authentication scheme, which is rendered with a
+// WWW-Authenticate challenge when the error is caused by authentication.
+type challengeError struct {
+	err    error
+	scheme string
+}
+
+func (e *challengeError) Error() string { return e.err.Error() }
+func (e *challengeError) Unwrap() error { return e.err }
+
+// challenge returns the WWW-Authenticate header value for the error kind, or empty if the error kind does not
+// warrant a challenge.
+func (e *challengeError) challenge(kind ftag.Kind, resp *errorResponse) string {
+	switch e.scheme {
+	case schemeBasic:
+		if kind == spec.ErrKindInvalidClient {
+			return schemeBasic + ` realm="tigerd"`
+		}
+	case schemeBearer:
+		switch kind {
+		case spec.ErrKindInvalidRequest, spec.ErrKindInvalidToken, spec.ErrKindInsufficientScope:
+			// RFC 6750 Section 3 values are quoted-strings, in which quotes and backslashes must be escaped.
+			escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace
+			challenge := fmt.Sprintf(`%s realm="tigerd", error="%s"`, schemeBearer, kind)
+			if len(resp.ErrorDescription) > 0 {
+				challenge += fmt.Sprintf(`, error_description="%s"`, escape(resp.ErrorDescription))
+			}
+			return challenge
+		}
+	}
+	return ""
+}
+
+// basicChallenge marks the error of an endpoint protected by client authentication, defined in RFC 6749 Section
+// 2.3.1, to be rendered with a Basic challenge upon invalid_client.
+func basicChallenge(err error) error {
+	return &challengeError{err: err, scheme: schemeBasic}
+}
+
+// bearerChallenge marks the error of an endpoint protected by bearer token, defined in RFC 6750 Section 3, to be
+// rendered with a Bearer challenge upon invalid_request, invalid_token and insufficient_scope.
+func bearerChallenge(err error) error {
+	return &challengeError{err: err, scheme: schemeBearer}
+}
+
+// pageError is an error of an endpoint visited by the End-User, which is displayed on a local error page, unless it
+// is an authorize.RedirectError which can be returned to the client.
+type pageError struct {
+	err error
+}
+
+func (e *pageError) Error() string { return e.err.Error() }
+func (e *pageError) Unwrap() error { return e.err }
+
+// errorPage marks the error to be displayed on a local error page.
+func errorPage(err error) error {
+	return &pageError{err: err}
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/absurdlab/tigerd/internal/logout"
+	"github.com/absurdlab/tigerd/internal/wellknown"
+	"github.com/labstack/echo/v4"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// frontChannelLogoutPage renders the front-channel logout uris in hidden iframes, and continues to the post logout
+// redirect uri, if any, once all iframes have loaded, or after a timeout in case some relying party does not respond.
+var frontChannelLogoutPage = template.Must(template.New("logout").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Logged out</title>
+</head>
+<body>
+<p>You have been logged out.</p>
+{{range .FrontChannelLogoutURIs}}<iframe src="{{.}}" style="display:none" onload="loaded()"></iframe>
+{{end}}<script>
+var pending = {{len .FrontChannelLogoutURIs}};
+var redirectURI = {{.RedirectURI}};
+function proceed() {
+  if (redirectURI) {
+    window.location.replace(redirectURI);
+  }
+}
+function loaded() {
+  if (--pending === 0) {
+    proceed();
+  }
+}
+setTimeout(proceed, 5000);
+</script>
+</body>
+</html>
+`))
+
+// confirmLogoutPage asks the End-User to confirm the logout request, which carries no id_token_hint. The form posts
+// the request back along with the confirmation, which must match the confirmation cookie.
+var confirmLogoutPage = template.Must(template.New("confirm_logout").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Log out</title>
+</head>
+<body>
+<p>Do you want to log out?</p>
+<form method="post" action="/oauth/logout">
+{{- if .Request.ClientID}}
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}"/>
+{{- end}}
+{{- if .Request.PostLogoutRedirectURI}}
+<input type="hidden" name="post_logout_redirect_uri" value="{{.Request.PostLogoutRedirectURI}}"/>
+{{- end}}
+{{- if .Request.State}}
+<input type="hidden" name="state" value="{{.Request.State}}"/>
+{{- end}}
+<input type="hidden" name="confirmation" value="{{.Confirmation}}"/>
+<button type="submit">Log out</button>
+</form>
+</body>
+</html>
+`))
+
+const (
+	// confirmationCookie carries the confirmation expected to be posted back by confirmLogoutPage. Cross-site pages
+	// can neither read it, nor make the user agent send it, hence cannot confirm on behalf of the End-User.
+	confirmationCookie = "tigerd_logout"
+)
+
+func NewLogoutHandler(discovery *wellknown.Discovery, service *logout.Service) Interface {
+	return &logoutHandler{
+		secure:  strings.HasPrefix(discovery.Issuer, "https://"),
+		service: service,
+	}
+}
+
+type logoutHandler struct {
+	secure  bool
+	service *logout.Service
+}
+
+func (h *logoutHandler) Mount(e *echo.Echo) error {
+	e.GET("/oauth/logout", h.logout)
+	e.POST("/oauth/logout", h.logout)
+
+	return nil
+}
+
+func (h *logoutHandler) logout(c echo.Context) error {
+	values, err := c.FormParams()
+	if err != nil {
+		return errorPage(err)
+	}
+
+	var sid string
+	if cookie, err := c.Cookie(sidCookie); err == nil {
+		sid = cookie.Value
+	}
+
+	req := logout.ParseRequest(values)
+	req.Confirmed = h.confirmed(c, values.Get("confirmation"))
+
+	resp, err := h.service.Logout(c.Request().Context(), req, sid)
+	if err != nil {
+		return errorPage(err)
+	}
+
+	if resp.ConfirmationRequired {
+		return h.confirm(c, req)
+	}
+
+	h.clearCookie(c, confirmationCookie, "/oauth/logout", http.SameSiteStrictMode)
+	h.clearCookie(c, sidCookie, "/", http.SameSiteLaxMode)
+
+	switch {
+	case len(resp.FrontChannelLogoutURIs) > 0:
+		c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+		c.Response().WriteHeader(http.StatusOK)
+		return frontChannelLogoutPage.Execute(c.Response(), resp)
+	case len(resp.RedirectURI) > 0:
+		return c.Redirect(http.StatusFound, resp.RedirectURI)
+	default:
+		return c.String(http.StatusOK, "You have been logged out.")
+	}
+}
+
+// confirmed returns true if the confirmation posted by confirmLogoutPage matches the confirmation cookie.
+func (h *logoutHandler) confirmed(c echo.Context, confirmation string) bool {
+	cookie, err := c.Cookie(confirmationCookie)
+	if err != nil || len(cookie.Value) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(confirmation)) == 1
+}
+
+// confirm renders confirmLogoutPage for the request, with a new confirmation bound to the user agent by cookie.
+func (h *logoutHandler) confirm(c echo.Context, req *logout.Request) error {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	confirmation := base64.RawURLEncoding.EncodeToString(buf)
+
+	c.SetCookie(&http.Cookie{
+		Name:     confirmationCookie,
+		Value:    confirmation,
+		Path:     "/oauth/logout",
+		Secure:   h.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+	c.Response().WriteHeader(http.StatusOK)
+
+	return confirmLogoutPage.Execute(c.Response(), map[string]any{
+		"Request":      req,
+		"Confirmation": confirmation,
+	})
+}
+
+func (h *logoutHandler) clearCookie(c echo.Context, name string, path string, sameSite http.SameSite) {
+	c.SetCookie(&http.Cookie{
+		Name:     name,
+		Path:     path,
+		MaxAge:   -1,
+		Secure:   h.secure,
+		HttpOnly: true,
+		SameSite: sameSite,
+	})
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/Southclaws/fault"
+	"github.com/Southclaws/fault/fmsg"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+)
+
+func NewRegisterHandler(service *client.RegistrationService) Interface {
+	return &registerHandler{
+		service: service,
+	}
+}
+
+type registerHandler struct {
+	service *client.RegistrationService
+}
+
+func (h *registerHandler) Mount(e *echo.Echo) error {
+	e.POST("/oauth/register", h.register)
+	e.GET("/oauth/register/:client_id", h.read)
+	e.PUT("/oauth/register/:client_id", h.update)
+	e.DELETE("/oauth/register/:client_id", h.delete)
+
+	return nil
+}
+
+func (h *registerHandler) register(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	c.Response().Header().Set("Pragma", "no-cache")
+
+	metadata, err := h.metadata(c)
+	if err != nil {
+		return bearerChallenge(err)
+	}
+
+	resp, err := h.service.Register(c.Request().Context(), bearerToken(c), metadata)
+	if err != nil {
+		return bearerChallenge(err)
+	}
+
+	return c.JSON(http.StatusCreated, resp)
+}
+
+func (h *registerHandler) read(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	c.Response().Header().Set("Pragma", "no-cache")
+
+	resp, err := h.service.Read(c.Request().Context(), c.Param("client_id"), bearerToken(c))
+	if err != nil {
+		return bearerChallenge(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *registerHandler) update(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	c.Response().Header().Set("Pragma", "no-cache")
+
+	metadata, err := h.metadata(c)
+	if err != nil {
+		return bearerChallenge(err)
+	}
+
+	resp, err := h.service.Update(c.Request().Context(), c.Param("client_id"), bearerToken(c), metadata)
+	if err != nil {
+		return bearerChallenge(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *registerHandler) delete(c echo.Context) error {
+	if err := h.service.Delete(c.Request().Context(), c.Param("client_id"), bearerToken(c)); err != nil {
+		return bearerChallenge(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// metadata decodes the client metadata from the JSON request body. The body is decoded directly, so that path
+// parameters such as client_id do not leak into the metadata.
+func (h *registerHandler) metadata(c echo.Context) (*client.Client, error) {
+	metadata := new(client.Client)
+	if err := json.NewDecoder(c.Request().Body).Decode(metadata); err != nil {
+		return nil, fault.Wrap(err,
+			ftag.With(spec.ErrKindInvalidClientMetadata),
+			fmsg.WithDesc("malformed client metadata", "Client metadata must be a valid JSON object."),
+		)
+	}
+	return metadata, nil
+}
+
+// bearerToken returns the token from the Bearer authorization header, if any.
+func bearerToken(c echo.Context) string {
+	const prefix = "Bearer "
+
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+
+	return strings.TrimSpace(header[len(prefix):])
+}
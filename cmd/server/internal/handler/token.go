@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/token"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/url"
+)
+
+func NewTokenHandler(service *token.Service) Interface {
+	return &tokenHandler{
+		service: service,
+	}
+}
+
+type tokenHandler struct {
+	service *token.Service
+}
+
+func (h *tokenHandler) Mount(e *echo.Echo) error {
+	e.POST("/oauth/token", h.token)
+	e.POST("/oauth/introspect", h.introspect)
+	e.POST("/oauth/revoke", h.revoke)
+
+	return nil
+}
+
+func (h *tokenHandler) token(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	c.Response().Header().Set("Pragma", "no-cache")
+
+	values, err := c.FormParams()
+	if err != nil {
+		return basicChallenge(err)
+	}
+
+	credentials, err := clientCredentials(c, values)
+	if err != nil {
+		return basicChallenge(err)
+	}
+
+	req, err := token.ParseRequest(values, credentials)
+	if err != nil {
+		return basicChallenge(err)
+	}
+
+	resp, err := h.service.Exchange(c.Request().Context(), req)
+	if err != nil {
+		return basicChallenge(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *tokenHandler) introspect(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+
+	values, err := c.FormParams()
+	if err != nil {
+		return basicChallenge(err)
+	}
+
+	credentials, err := clientCredentials(c, values)
+	if err != nil {
+		return basicChallenge(err)
+	}
+
+	req, err := token.ParseIntrospectionRequest(values, credentials)
+	if err != nil {
+		return basicChallenge(err)
+	}
+
+	resp, err := h.service.Introspect(c.Request().Context(), req)
+	if err != nil {
+		return basicChallenge(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *tokenHandler) revoke(c echo.Context) error {
+	values, err := c.FormParams()
+	if err != nil {
+		return basicChallenge(err)
+	}
+
+	credentials, err := clientCredentials(c, values)
+	if err != nil {
+		return basicChallenge(err)
+	}
+
+	req, err := token.ParseRevocationRequest(values, credentials)
+	if err != nil {
+		return basicChallenge(err)
+	}
+
+	if err = h.service.Revoke(c.Request().Context(), req); err != nil {
+		return basicChallenge(err)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// clientCredentials parses the client authentication parameters from the form values, and from HTTP Basic
+// authentication, whose credentials are form url encoded as required by RFC 6749 Section 2.3.1.
+func clientCredentials(c echo.Context, values url.Values) (*client.Credentials, error) {
+	username, password, ok := c.Request().BasicAuth()
+	if !ok {
+		return client.ParseCredentials(values, "", "")
+	}
+
+	return client.ParseCredentials(values, formUnescape(username), formUnescape(password))
+}
+
+func formUnescape(value string) string {
+	unescaped, err := url.QueryUnescape(value)
+	if err != nil {
+		return value
+	}
+	return unescaped
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"github.com/absurdlab/tigerd/internal/userinfo"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+const mimeApplicationJWT = "application/jwt"
+
+func NewUserInfoHandler(service *userinfo.Service) Interface {
+	return &userInfoHandler{
+		service: service,
+	}
+}
+
+type userInfoHandler struct {
+	service *userinfo.Service
+}
+
+func (h *userInfoHandler) Mount(e *echo.Echo) error {
+	e.GET("/oauth/userinfo", h.userInfo)
+	e.POST("/oauth/userinfo", h.userInfo)
+
+	return nil
+}
+
+func (h *userInfoHandler) userInfo(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+
+	accessToken := bearerToken(c)
+	if len(accessToken) == 0 && c.Request().Method == http.MethodPost {
+		accessToken = c.FormValue("access_token")
+	}
+
+	resp, err := h.service.UserInfo(c.Request().Context(), accessToken)
+	if err != nil {
+		return bearerChallenge(err)
+	}
+
+	if len(resp.JWT) > 0 {
+		return c.Blob(http.StatusOK, mimeApplicationJWT, []byte(resp.JWT))
+	}
+
+	return c.JSON(http.StatusOK, resp.Claims)
+}
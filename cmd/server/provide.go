@@ -1,29 +1,38 @@
 package server
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/absurdlab/tigerd/buildinfo"
+	"github.com/absurdlab/tigerd/cmd/server/internal/handler"
 	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/logout"
+	"github.com/absurdlab/tigerd/internal/storage"
+	"github.com/absurdlab/tigerd/internal/storage/bolt"
+	"github.com/absurdlab/tigerd/internal/storage/memory"
+	"github.com/absurdlab/tigerd/internal/storage/redis"
+	"github.com/absurdlab/tigerd/internal/token"
 	"github.com/absurdlab/tigerd/internal/wellknown"
 	"github.com/hellofresh/health-go/v5"
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog"
 	"github.com/samber/lo"
 	"github.com/ziflex/lecho/v3"
+	"go.uber.org/fx"
 	"net"
 	"os"
 	"strings"
 	"time"
 )
 
-func newEcho(logger *zerolog.Logger) *echo.Echo {
+func newEcho(cfg *config, logger *zerolog.Logger) *echo.Echo {
 	e := echo.New()
 	e.HideBanner = true
 	e.HidePort = true
 	e.Logger = lecho.New(logger)
-	e.HTTPErrorHandler = func(err error, c echo.Context) {
-		panic("TODO handle this error")
-	}
+	e.HTTPErrorHandler = handler.NewErrorHandler(cfg.ErrorURI, logger)
 
 	return e
 }
@@ -96,6 +105,115 @@ func newProviderProperties(cfg *config, logger *zerolog.Logger) ([]*authorize.Pr
 	}), nil
 }
 
+func newAuthorizeProperties(cfg *config) (*authorize.Properties, error) {
+	props := &authorize.Properties{
+		SessionLifespan:      cfg.Authorize.SessionLifespan,
+		LoginSessionLifespan: cfg.Authorize.LoginSessionLifespan,
+		CodeLifespan:         cfg.Authorize.CodeLifespan,
+	}
+	if err := props.Validate(); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+func newClientRegistry(cfg *config, providers []*authorize.ProviderProperties, store client.Store, keys *client.KeyFetcher) (client.Registry, error) {
+	for _, each := range cfg.Clients {
+		if len(each.ProviderKey) == 0 {
+			continue
+		}
+		if !lo.ContainsBy(providers, func(p *authorize.ProviderProperties) bool { return p.Key == each.ProviderKey }) {
+			return nil, fmt.Errorf("client %s: provider_key %s is not configured", each.ID, each.ProviderKey)
+		}
+	}
+
+	return client.NewRegistry(cfg.Clients, store, keys)
+}
+
+func newKeysProperties(cfg *config) (*client.KeysProperties, error) {
+	props := &client.KeysProperties{
+		Timeout:  cfg.ClientKeys.Timeout,
+		CacheTTL: cfg.ClientKeys.CacheTTL,
+	}
+	if err := props.Validate(); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+func newRegistrationProperties(cfg *config) *client.RegistrationProperties {
+	return &client.RegistrationProperties{
+		InitialAccessToken: cfg.Registration.InitialAccessToken,
+	}
+}
+
+func newTokenProperties(cfg *config) (*token.Properties, error) {
+	props := &token.Properties{
+		AccessTokenLifespan:  cfg.Token.AccessTokenLifespan,
+		IDTokenLifespan:      cfg.Token.IDTokenLifespan,
+		RefreshTokenLifespan: cfg.Token.RefreshTokenLifespan,
+	}
+	if err := props.Validate(); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+func newLogoutProperties(cfg *config) (*logout.Properties, error) {
+	props := &logout.Properties{
+		BackChannelAttempts: cfg.Logout.BackChannelAttempts,
+		BackChannelTimeout:  cfg.Logout.BackChannelTimeout,
+	}
+	if err := props.Validate(); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+func newStorageProperties(cfg *config) (*storage.Properties, error) {
+	props := &storage.Properties{
+		Backend:        cfg.Storage.Backend,
+		Path:           cfg.Storage.Path,
+		RedisURL:       cfg.Storage.RedisURL,
+		RedisKeyPrefix: cfg.Storage.RedisKeyPrefix,
+		SweepInterval:  cfg.Storage.SweepInterval,
+	}
+	if err := props.Validate(); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+func newStorage(props *storage.Properties, lc fx.Lifecycle) (storage.Interface, error) {
+	var (
+		s   storage.Interface
+		err error
+	)
+
+	switch props.Backend {
+	case storage.BackendMemory:
+		s = memory.New(props.SweepInterval)
+	case storage.BackendBolt:
+		if s, err = bolt.Open(props.Path, props.SweepInterval); err != nil {
+			return nil, err
+		}
+	case storage.BackendRedis:
+		if s, err = redis.Open(props.RedisURL, props.RedisKeyPrefix); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported storage backend %s", props.Backend)
+	}
+
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			return s.Close()
+		},
+	})
+
+	return s, nil
+}
+
 func newHealth() (*health.Health, error) {
 	return health.New(
 		health.WithComponent(health.Component{
@@ -0,0 +1,101 @@
+package authorize
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	providerv1 "github.com/absurdlab/tigerd/proto/gen/go/proto/provider/v1"
+	"github.com/absurdlab/tigerd/proto/gen/go/proto/provider/v1/providerv1connect"
+	"github.com/bufbuild/connect-go"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"net/http"
+	"strings"
+)
+
+// NewCallbackServer returns the providerv1connect.CallbackServiceHandler through which providers report End-User
+// interaction results of redirected authorization sessions to the Service. Providers authenticate by presenting their
+// configured secret as bearer token.
+func NewCallbackServer(service *Service, providers []*ProviderProperties) providerv1connect.CallbackServiceHandler {
+	return &callbackServer{service: service, providers: providers}
+}
+
+type callbackServer struct {
+	service   *Service
+	providers []*ProviderProperties
+}
+
+func (s *callbackServer) CallbackLogin(
+	ctx context.Context,
+	req *connect.Request[providerv1.CallbackLoginRequest],
+) (*connect.Response[providerv1.CallbackLoginResponse], error) {
+	providerKey, err := s.authenticate(req.Header())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.service.ReportLogin(ctx, providerKey, req.Msg.GetSessionId(), req.Msg.GetResult()); err != nil {
+		return nil, connectError(err)
+	}
+	return connect.NewResponse(&providerv1.CallbackLoginResponse{Empty: new(emptypb.Empty)}), nil
+}
+
+func (s *callbackServer) CallbackSelectAccount(
+	ctx context.Context,
+	req *connect.Request[providerv1.CallbackSelectAccountRequest],
+) (*connect.Response[providerv1.CallbackSelectAccountResponse], error) {
+	providerKey, err := s.authenticate(req.Header())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.service.ReportSelectAccount(ctx, providerKey, req.Msg.GetSessionId(), req.Msg.GetResult()); err != nil {
+		return nil, connectError(err)
+	}
+	return connect.NewResponse(&providerv1.CallbackSelectAccountResponse{Empty: new(emptypb.Empty)}), nil
+}
+
+func (s *callbackServer) CallbackConsent(
+	ctx context.Context,
+	req *connect.Request[providerv1.CallbackConsentRequest],
+) (*connect.Response[providerv1.CallbackConsentResponse], error) {
+	providerKey, err := s.authenticate(req.Header())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.service.ReportConsent(ctx, providerKey, req.Msg.GetSessionId(), req.Msg.GetResult()); err != nil {
+		return nil, connectError(err)
+	}
+	return connect.NewResponse(&providerv1.CallbackConsentResponse{Empty: new(emptypb.Empty)}), nil
+}
+
+// authenticate returns the key of the provider whose secret is presented as bearer token in the header.
+func (s *callbackServer) authenticate(header http.Header) (string, error) {
+	authorization := header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return "", connect.NewError(connect.CodeUnauthenticated, errors.New("provider secret missing"))
+	}
+
+	secret := []byte(strings.TrimPrefix(authorization, "Bearer "))
+	for _, p := range s.providers {
+		if len(p.Secret) > 0 && subtle.ConstantTimeCompare([]byte(p.Secret), secret) == 1 {
+			return p.Key, nil
+		}
+	}
+
+	return "", connect.NewError(connect.CodeUnauthenticated, errors.New("provider secret invalid"))
+}
+
+// connectError translates the Service errors into connect errors understood by providers.
+func connectError(err error) error {
+	switch {
+	case errors.Is(err, ErrSessionNotFound):
+		return connect.NewError(connect.CodeNotFound, err)
+	case errors.Is(err, ErrSessionState):
+		return connect.NewError(connect.CodeFailedPrecondition, err)
+	case errors.Is(err, ErrProvider):
+		return connect.NewError(connect.CodeInvalidArgument, err)
+	default:
+		return connect.NewError(connect.CodeInternal, err)
+	}
+}
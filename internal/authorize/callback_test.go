@@ -0,0 +1,82 @@
+//go:build unit
+
+package authorize_test
+
+import (
+	"context"
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/storage/memory"
+	providerv1 "github.com/absurdlab/tigerd/proto/gen/go/proto/provider/v1"
+	"github.com/absurdlab/tigerd/proto/gen/go/proto/provider/v1/providerv1connect"
+	"github.com/bufbuild/connect-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCallbackServer(t *testing.T) {
+	var sessionID string
+
+	service := newTestService(t, &testProvider{
+		login: func(req *providerv1.LoginRequest) *providerv1.LoginResponse {
+			sessionID = req.GetSessionId()
+			return &providerv1.LoginResponse{
+				ResultOrRedirect: &providerv1.LoginResponse_Redirection{
+					Redirection: &providerv1.Redirection{Target: "https://provider.com/login"},
+				},
+			}
+		},
+	}, memory.New(time.Minute))
+
+	_, err := service.Authorize(context.Background(), &authorize.Request{
+		ResponseType: spec.ResponseTypeCode.ToSet(),
+		ClientID:     "foo",
+		RedirectURI:  "https://foo.com/callback",
+		Scopes:       []string{"openid"},
+	}, "", "")
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.Handle(providerv1connect.NewCallbackServiceHandler(authorize.NewCallbackServer(service, []*authorize.ProviderProperties{
+		{Key: "test", Address: "localhost:30000", Secret: "test-secret"},
+		{Key: "other", Address: "localhost:30001", Secret: "other-secret"},
+	})))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	callback := providerv1connect.NewCallbackServiceClient(http.DefaultClient, server.URL)
+
+	cases := []struct {
+		name   string
+		header string
+		expect connect.Code
+	}{
+		{name: "without secret", expect: connect.CodeUnauthenticated},
+		{name: "wrong secret", header: "Bearer wrong", expect: connect.CodeUnauthenticated},
+		{name: "secret of another provider", header: "Bearer other-secret", expect: connect.CodeNotFound},
+		{name: "secret of the provider", header: "Bearer test-secret"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := connect.NewRequest(&providerv1.CallbackLoginRequest{
+				SessionId: sessionID,
+				Result:    &providerv1.LoginResult{Authentication: &providerv1.Authentication{Subject: "alice"}},
+			})
+			if len(c.header) > 0 {
+				req.Header().Set("Authorization", c.header)
+			}
+
+			_, err := callback.CallbackLogin(context.Background(), req)
+			if c.expect == 0 {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, c.expect, connect.CodeOf(err))
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package authorize
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrGrantNotFound is returned by GrantStore when the grant does not exist or has expired.
+	ErrGrantNotFound = errors.New("grant not found")
+)
+
+// Grant records the scopes an End-User has consented to grant a client, as reported by a non-ephemeral consent
+// result, so that consent is not asked again for the same scopes.
+type Grant struct {
+	ClientID  string    `json:"client_id"`
+	Subject   string    `json:"sub"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// ExpiresAt is the moment the Grant is no longer valid. A zero value means the Grant never expires.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// IsExpired returns true if the Grant is no longer valid.
+func (g *Grant) IsExpired() bool {
+	return !g.ExpiresAt.IsZero() && time.Now().After(g.ExpiresAt)
+}
+
+// GrantStore persists grants.
+type GrantStore interface {
+	// SaveGrant creates or replaces the grant of the subject to the client.
+	SaveGrant(ctx context.Context, grant *Grant) error
+	// GetGrant returns the grant of the subject to the client, or ErrGrantNotFound if the grant does not exist or has
+	// expired.
+	GetGrant(ctx context.Context, clientID string, subject string) (*Grant, error)
+	// DeleteGrant removes the grant of the subject to the client. Deleting a non-existing grant is not an error.
+	DeleteGrant(ctx context.Context, clientID string, subject string) error
+}
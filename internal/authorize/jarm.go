@@ -0,0 +1,74 @@
+package authorize
+
+import (
+	"context"
+	"github.com/Southclaws/fault"
+	"github.com/Southclaws/fault/fmsg"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"time"
+)
+
+// responseLifespan is the lifespan of the authorization response JWT, which only needs to outlive the redirection to
+// the client, as recommended by JARM Section 2.1.
+const responseLifespan = 10 * time.Minute
+
+// responseEncoder encodes authorization responses in JWT response modes, as defined in JWT Secured Authorization
+// Response Mode for OAuth 2.0 (JARM).
+type responseEncoder struct {
+	issuer string
+	jwks   *jose.JSONWebKeySet
+	// alg is the signing algorithm used for clients not registering authorization_signed_response_alg.
+	alg spec.SignatureAlgorithm
+}
+
+// encode returns the Response in the plain variant of its JWT response mode, whose params are replaced by the single
+// response param carrying them as a JWT signed, and optionally encrypted, according to the client registration.
+// Responses in other response modes are returned as is.
+func (e *responseEncoder) encode(ctx context.Context, c *client.Client, resp *Response) (*Response, error) {
+	if !resp.Mode.IsJWT() {
+		return resp, nil
+	}
+
+	claims := make(map[string]any, len(resp.Params)+3)
+	for k, v := range resp.Params {
+		claims[k] = v
+	}
+	claims["iss"] = e.issuer
+	claims["aud"] = c.ID
+	claims["exp"] = time.Now().Add(responseLifespan).Unix()
+
+	alg := c.AuthorizationSignedResponseAlg
+	if alg.IsNoneOrEmpty() {
+		alg = e.alg
+	}
+
+	opts := []jose.EncoderOpt{jose.WithSignature(alg, e.jwks)}
+
+	if encAlg := c.AuthorizationEncryptedResponseAlg; !encAlg.IsNoneOrEmpty() {
+		keys, err := c.JSONWebKeys(ctx)
+		if err != nil {
+			return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError), fmsg.With("failed to obtain client keys"))
+		}
+
+		enc := c.AuthorizationEncryptedResponseEnc
+		if enc == 0 {
+			enc = spec.A128CBC_HS256
+		}
+
+		opts = append(opts, jose.WithEncryption(encAlg, enc, keys))
+	}
+
+	jwt, err := jose.Encode(claims, opts...)
+	if err != nil {
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError), fmsg.With("failed to encode authorization response"))
+	}
+
+	encoded := *resp
+	encoded.Params = map[string]string{"response": jwt}
+	encoded.Mode = resp.Mode.Plain()
+
+	return &encoded, nil
+}
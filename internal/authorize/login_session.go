@@ -0,0 +1,96 @@
+package authorize
+
+import (
+	"context"
+	"errors"
+	"github.com/oklog/ulid/v2"
+	"github.com/samber/lo"
+	"time"
+)
+
+var (
+	// ErrLoginSessionNotFound is returned by LoginSessionStore when the login session does not exist or has expired.
+	ErrLoginSessionNotFound = errors.New("login session not found")
+)
+
+// LoginSession remembers the End-User authentications established within a user agent, so that later authorization
+// requests from the same user agent can reuse or select from them. Its id is bound to the user agent by cookie.
+type LoginSession struct {
+	ID string `json:"id"`
+	// Sid is the public identifier of the LoginSession, carried by the sid claim of tokens and logout notifications.
+	// Unlike ID, it is never bound to a user agent, so that disclosing it does not hand over the LoginSession.
+	Sid             string            `json:"sid"`
+	Authentications []*Authentication `json:"authentications,omitempty"`
+	// Participants are the clients issued an authorization within this LoginSession, to be notified upon logout.
+	Participants []*Participant `json:"participants,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+	ExpiresAt    time.Time      `json:"expires_at"`
+}
+
+func newLoginSession(lifespan time.Duration) *LoginSession {
+	now := time.Now()
+	return &LoginSession{
+		ID:        ulid.Make().String(),
+		Sid:       ulid.Make().String(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(lifespan),
+	}
+}
+
+// IsExpired returns true if the LoginSession can no longer be used.
+func (s *LoginSession) IsExpired() bool {
+	return time.Now().After(s.ExpiresAt)
+}
+
+// Options returns the authentications that have not yet expired, most recent first.
+func (s *LoginSession) Options() []*Authentication {
+	return lo.Filter(s.Authentications, func(item *Authentication, _ int) bool {
+		return !item.IsExpired()
+	})
+}
+
+// Find returns the unexpired authentication by its id, or nil if not found.
+func (s *LoginSession) Find(id string) *Authentication {
+	authentication, _ := lo.Find(s.Options(), func(item *Authentication) bool {
+		return item.ID == id
+	})
+	return authentication
+}
+
+// Remember records the authentication in this LoginSession as the most recent one. Any previous authentication of
+// the same subject is replaced.
+func (s *LoginSession) Remember(authentication *Authentication) {
+	s.Authentications = append([]*Authentication{authentication}, lo.Filter(s.Options(), func(item *Authentication, _ int) bool {
+		return item.Subject != authentication.Subject
+	})...)
+}
+
+// Participate records the client as issued an authorization for the subject within this LoginSession.
+func (s *LoginSession) Participate(clientID string, subject string) {
+	if lo.ContainsBy(s.Participants, func(item *Participant) bool {
+		return item.ClientID == clientID && item.Subject == subject
+	}) {
+		return
+	}
+	s.Participants = append(s.Participants, &Participant{ClientID: clientID, Subject: subject})
+}
+
+// Participant is a client issued an authorization for the End-User within a LoginSession.
+type Participant struct {
+	ClientID string `json:"client_id"`
+	Subject  string `json:"sub"`
+}
+
+// LoginSessionStore persists login sessions.
+type LoginSessionStore interface {
+	// SaveLoginSession creates or replaces the login session.
+	SaveLoginSession(ctx context.Context, session *LoginSession) error
+	// GetLoginSession returns the login session by its id, or ErrLoginSessionNotFound if the login session does not
+	// exist or has expired.
+	GetLoginSession(ctx context.Context, id string) (*LoginSession, error)
+	// GetLoginSessionBySid returns the login session by its public sid, or ErrLoginSessionNotFound if the login
+	// session does not exist or has expired.
+	GetLoginSessionBySid(ctx context.Context, sid string) (*LoginSession, error)
+	// DeleteLoginSession removes the login session. Deleting a non-existing login session is not an error.
+	DeleteLoginSession(ctx context.Context, id string) error
+}
@@ -21,6 +21,9 @@ type ProviderProperties struct {
 	// Address is the dial string address to connect to the provider. Non-localhost is supported, however, will
 	// print a WARNING message to console.
 	Address string `json:"address" yaml:"address"`
+	// Secret is shared with the provider, which presents it as bearer token to authenticate its calls to the
+	// CallbackService.
+	Secret string `json:"secret" yaml:"secret"`
 }
 
 // Validate performs validation to this ProviderProperties.
@@ -31,6 +34,7 @@ func (p *ProviderProperties) Validate() error {
 			validation.Required,
 			is.DialString,
 		),
+		"secret": validation.Validate(p.Secret, validation.Required),
 	}.Filter()
 	if err != nil {
 		return err
@@ -38,10 +42,16 @@ func (p *ProviderProperties) Validate() error {
 	return nil
 }
 
+// baseURL returns the base url to reach the provider services. Providers are expected to serve plain HTTP, as they
+// are deployed on the same physical host.
+func (p *ProviderProperties) baseURL() string {
+	return "http://" + p.Address
+}
+
 func NewProviderHealthProbes(configs []*ProviderProperties) healthprobe.Interface {
 	probe := &providerHealthProbes{services: map[string]providerv1connect.PingServiceClient{}}
 	for _, c := range configs {
-		probe.services[c.Key] = providerv1connect.NewPingServiceClient(http.DefaultClient, c.Address)
+		probe.services[c.Key] = providerv1connect.NewPingServiceClient(http.DefaultClient, c.baseURL())
 	}
 	return probe
 }
@@ -16,21 +16,28 @@ func TestProviderProperties_Validate(t *testing.T) {
 	}{
 		{
 			name: "correct",
-			prop: &authorize.ProviderProperties{Key: "foo", Address: "localhost:30000"},
+			prop: &authorize.ProviderProperties{Key: "foo", Address: "localhost:30000", Secret: "secret"},
 			assert: func(t *testing.T, err error) {
 				assert.NoError(t, err)
 			},
 		},
 		{
 			name: "missing key",
-			prop: &authorize.ProviderProperties{Key: "", Address: "localhost:30000"},
+			prop: &authorize.ProviderProperties{Key: "", Address: "localhost:30000", Secret: "secret"},
+			assert: func(t *testing.T, err error) {
+				assert.Error(t, err)
+			},
+		},
+		{
+			name: "missing secret",
+			prop: &authorize.ProviderProperties{Key: "foo", Address: "localhost:30000"},
 			assert: func(t *testing.T, err error) {
 				assert.Error(t, err)
 			},
 		},
 		{
 			name: "invalid address",
-			prop: &authorize.ProviderProperties{Key: "foo", Address: "bar"},
+			prop: &authorize.ProviderProperties{Key: "foo", Address: "bar", Secret: "secret"},
 			assert: func(t *testing.T, err error) {
 				assert.Error(t, err)
 			},
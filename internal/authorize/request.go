@@ -0,0 +1,227 @@
+package authorize
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Southclaws/fault"
+	"github.com/Southclaws/fault/fmsg"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/should"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/token"
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/samber/lo"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrRequest is the root error returned when the authorization request is malformed or contains invalid values.
+	ErrRequest = errors.New("authorization request is invalid")
+)
+
+// Request is the authorization request defined in OAuth 2.0 and OpenID Connect 1.0.
+type Request struct {
+	ResponseType spec.ResponseTypeSet `json:"response_type,omitempty"`
+	ResponseMode spec.ResponseMode    `json:"response_mode,omitempty"`
+	ClientID     string               `json:"client_id"`
+	RedirectURI  string               `json:"redirect_uri"`
+	Scopes       []string             `json:"scopes,omitempty"`
+	State        string               `json:"state,omitempty"`
+	Nonce        string               `json:"nonce,omitempty"`
+	Prompt       spec.PromptSet       `json:"prompt,omitempty"`
+	Display      spec.Display         `json:"display,omitempty"`
+	UILocales    []string             `json:"ui_locales,omitempty"`
+	LoginHint    string               `json:"login_hint,omitempty"`
+	ACRValues    []string             `json:"acr_values,omitempty"`
+	Claims       *token.ClaimsRequest `json:"claims,omitempty"`
+
+	CodeChallenge       string                   `json:"code_challenge,omitempty"`
+	CodeChallengeMethod spec.CodeChallengeMethod `json:"code_challenge_method,omitempty"`
+
+	// values are the parameters the Request is parsed from, which are merged with the request object, if any.
+	values url.Values
+}
+
+// ParseRequest parses the authorization request from query or form parameters. Only the format of each parameter is
+// checked, call Request.Validate to check the request as a whole. Upon error, the returned Request still carries the
+// parameters parsed so far, so that the error can be returned to the client.
+func ParseRequest(values url.Values) (*Request, error) {
+	req := &Request{
+		ClientID:    values.Get("client_id"),
+		RedirectURI: values.Get("redirect_uri"),
+		Scopes:      splitSpaces(values.Get("scope")),
+		State:       values.Get("state"),
+		Nonce:       values.Get("nonce"),
+		UILocales:   splitSpaces(values.Get("ui_locales")),
+		LoginHint:   values.Get("login_hint"),
+		ACRValues:   splitSpaces(values.Get("acr_values")),
+
+		CodeChallenge: values.Get("code_challenge"),
+
+		values: values,
+	}
+
+	var err error
+
+	if req.ResponseType, err = spec.ResponseTypeSet(0).AddValues(splitSpaces(values.Get("response_type"))...); err != nil {
+		return req, fault.Wrap(ErrRequest,
+			ftag.With(spec.ErrKindUnsupportedResponseType),
+			fmsg.WithDesc(err.Error(), "Unsupported response_type."),
+		)
+	}
+
+	if mode := values.Get("response_mode"); len(mode) > 0 {
+		if err = spec.Parse(mode, &req.ResponseMode); err != nil {
+			return req, fault.Wrap(ErrRequest,
+				ftag.With(spec.ErrKindInvalidRequest),
+				fmsg.WithDesc(err.Error(), "Unsupported response_mode."),
+			)
+		}
+	}
+
+	if req.Prompt, err = spec.PromptSet(0).AddValues(splitSpaces(values.Get("prompt"))...); err != nil {
+		return req, fault.Wrap(ErrRequest,
+			ftag.With(spec.ErrKindInvalidRequest),
+			fmsg.WithDesc(err.Error(), "Invalid prompt."),
+		)
+	}
+
+	if display := values.Get("display"); len(display) > 0 {
+		if err = spec.Parse(display, &req.Display); err != nil {
+			return req, fault.Wrap(ErrRequest,
+				ftag.With(spec.ErrKindInvalidRequest),
+				fmsg.WithDesc(err.Error(), "Invalid display."),
+			)
+		}
+	}
+
+	if claims := values.Get("claims"); len(claims) > 0 {
+		req.Claims = new(token.ClaimsRequest)
+		if err = json.Unmarshal([]byte(claims), req.Claims); err != nil {
+			return req, fault.Wrap(ErrRequest,
+				ftag.With(spec.ErrKindInvalidRequest),
+				fmsg.WithDesc(err.Error(), "Invalid claims."),
+			)
+		}
+	}
+
+	if method := values.Get("code_challenge_method"); len(method) > 0 {
+		if err = spec.Parse(method, &req.CodeChallengeMethod); err != nil {
+			return req, fault.Wrap(ErrRequest,
+				ftag.With(spec.ErrKindInvalidRequest),
+				fmsg.WithDesc(err.Error(), "Unsupported code_challenge_method."),
+			)
+		}
+	} else if len(req.CodeChallenge) > 0 {
+		req.CodeChallengeMethod = spec.CodeChallengeMethodPlain
+	}
+
+	return req, nil
+}
+
+// Validate performs validation on the Request and returns an error if exists violation. The returned error will be
+// a ErrRequest.
+func (r *Request) Validate() error {
+	if r.ResponseType != 0 && r.ResponseType != spec.ResponseTypeCode.ToSet() {
+		return fault.Wrap(ErrRequest,
+			ftag.With(spec.ErrKindUnsupportedResponseType),
+			fmsg.WithDesc("unsupported response_type", "Only the code response_type is supported."),
+		)
+	}
+
+	err := v.Errors{
+		"response_type": v.Validate(r.ResponseType, v.Required),
+		"client_id":     v.Validate(r.ClientID, v.Required),
+		"redirect_uri": v.Validate(r.RedirectURI,
+			v.Required,
+			v.By(should.AbsoluteURL),
+			should.URL().Http().Https().CustomScheme().NoFragment(),
+		),
+		"scope": v.Validate(r.Scopes, v.Required),
+		"prompt": v.Validate(r.Prompt, v.By(func(_ any) error {
+			if !r.Prompt.IsValid() {
+				return errors.New("invalid combination")
+			}
+			return nil
+		})),
+		"code_challenge": v.Validate(r.CodeChallenge,
+			v.When(r.CodeChallengeMethod != 0, v.Required),
+			v.Length(43, 128),
+		),
+	}.Filter()
+
+	if err != nil {
+		return fault.Wrap(ErrRequest,
+			ftag.With(spec.ErrKindInvalidRequest),
+			fmsg.WithDesc(err.Error(), err.Error()),
+		)
+	}
+
+	return nil
+}
+
+// responseMode returns the requested response mode, or the default response mode of the response type. The generic
+// jwt response mode resolves to the JWT variant of the default response mode, as defined in JARM Section 2.3.4.
+func (r *Request) responseMode() spec.ResponseMode {
+	switch r.ResponseMode {
+	case 0:
+		return r.ResponseType.DefaultResponseMode()
+	case spec.ResponseModeJWT:
+		return r.ResponseType.DefaultResponseMode().ToJWT()
+	default:
+		return r.ResponseMode
+	}
+}
+
+// validateResponseMode checks the requested response_mode, if any, is one of the supported response modes. Any
+// response mode is accepted when supported is empty, as the server advertises no restriction.
+func (r *Request) validateResponseMode(supported []spec.ResponseMode) error {
+	if r.ResponseMode == 0 || len(supported) == 0 || lo.Contains(supported, r.ResponseMode) {
+		return nil
+	}
+
+	return fault.Wrap(ErrRequest,
+		ftag.With(spec.ErrKindInvalidRequest),
+		fmsg.WithDesc(
+			fmt.Sprintf("response_mode %s not supported", r.ResponseMode),
+			"Unsupported response_mode.",
+		),
+	)
+}
+
+// validateRedirectURI checks the redirect_uri of the Request is registered by its client. Errors afterwards are
+// returned to the client at the redirect_uri. The returned error will be a ErrRequest.
+func (r *Request) validateRedirectURI(c *client.Client) error {
+	if len(r.RedirectURI) == 0 || !c.AllowsRedirectURI(r.RedirectURI) {
+		return fault.Wrap(ErrRequest,
+			ftag.With(spec.ErrKindInvalidRequest),
+			fmsg.WithDesc("redirect_uri not registered", "The redirect_uri is not registered for the client."),
+		)
+	}
+	return nil
+}
+
+// validateClient checks the Request against the registration of its client. The returned error will be a ErrRequest.
+func (r *Request) validateClient(c *client.Client) error {
+	switch {
+	case !c.AllowsResponseType(r.ResponseType):
+		return fault.Wrap(ErrRequest,
+			ftag.With(spec.ErrKindUnauthorizedClient),
+			fmsg.WithDesc("response_type not registered", "The response_type is not registered for the client."),
+		)
+	case !c.AllowsGrantType(spec.GrantTypeAuthorizationCode):
+		return fault.Wrap(ErrRequest,
+			ftag.With(spec.ErrKindUnauthorizedClient),
+			fmsg.WithDesc("grant_type not registered", "The client is not registered for the authorization_code grant_type."),
+		)
+	}
+
+	return nil
+}
+
+func splitSpaces(value string) []string {
+	return strings.Fields(value)
+}
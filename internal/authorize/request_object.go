@@ -0,0 +1,284 @@
+package authorize
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Southclaws/fault"
+	"github.com/Southclaws/fault/fmsg"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/samber/lo"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// requestObjectLeeway is the clock skew tolerated when checking the time claims of request objects.
+const requestObjectLeeway = time.Minute
+
+// expand returns the Request merged with its request object, passed by value in the request parameter as defined in
+// OpenID Connect Core 1.0 Section 6.1. Parameters in the request object supersede those in the query, except that
+// client_id and response_type must match. A Request without request object is returned as is.
+func (s *Service) expand(ctx context.Context, req *Request) (*Request, error) {
+	if req == nil || len(req.values.Get("request")) == 0 {
+		return req, nil
+	}
+
+	if !s.discovery.RequestParameterSupported {
+		return nil, fault.Wrap(ErrRequest,
+			ftag.With(spec.ErrKindRequestNotSupported),
+			fmsg.WithDesc("request parameter not supported", "The request parameter is not supported."),
+		)
+	}
+
+	c, err := s.client(ctx, req.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, alg, err := s.decodeRequestObject(ctx, req.values.Get("request"), c)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.validateRequestObject(claims, alg, req); err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	for k, v := range req.values {
+		values[k] = v
+	}
+	values.Del("request")
+
+	for k, v := range claims {
+		switch k {
+		case "iss", "aud", "exp", "iat", "nbf", "jti", "request", "request_uri":
+			continue
+		}
+
+		if str, ok := v.(string); ok {
+			values.Set(k, str)
+			continue
+		}
+
+		// non-string values, such as the claims parameter, are carried as their JSON encoding like in the query.
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, requestObjectError(err.Error())
+		}
+		values.Set(k, string(raw))
+	}
+
+	expanded, err := ParseRequest(values)
+	if err != nil {
+		return nil, err
+	}
+
+	return expanded, nil
+}
+
+// decodeRequestObject decrypts the request object with the server keys if it is encrypted, and verifies its signature
+// with the client keys, or accepts it unsigned if the none algorithm is allowed. Algorithms must be the ones
+// registered by the client, or else be advertised in Discovery. The claims are returned along with the signing
+// algorithm verified.
+func (s *Service) decodeRequestObject(ctx context.Context, raw string, c *client.Client) (map[string]any, spec.SignatureAlgorithm, error) {
+	var (
+		encrypted = strings.Count(raw, ".") == 4
+		opts      []jose.DecoderOpt
+		algs      []spec.SignatureAlgorithm
+	)
+
+	if encrypted {
+		token, err := jwt.ParseEncrypted(raw)
+		if err != nil || len(token.Headers) == 0 {
+			return nil, 0, requestObjectError("request object malformed")
+		}
+
+		var (
+			alg spec.EncryptionAlgorithm
+			enc spec.EncryptionEncoding
+		)
+		encValue, _ := token.Headers[0].ExtraHeaders["enc"].(string)
+		if spec.Parse(token.Headers[0].Algorithm, &alg) != nil || spec.Parse(encValue, &enc) != nil {
+			return nil, 0, requestObjectError("request object encryption algorithm unsupported")
+		}
+
+		if !s.allowsRequestObjectEncryption(c, alg, enc) {
+			return nil, 0, requestObjectError("request object encryption algorithm not allowed")
+		}
+
+		opts = append(opts, jose.ExpectEncryption(alg, s.jwks))
+
+		// the signing algorithm of a nested token is only known after decryption, hence all allowed algorithms
+		// are attempted.
+		algs = s.requestObjectSigningAlgs(c)
+	} else {
+		token, err := jwt.ParseSigned(raw)
+		if err != nil || len(token.Headers) == 0 {
+			return nil, 0, requestObjectError("request object malformed")
+		}
+
+		var alg spec.SignatureAlgorithm
+		if spec.Parse(token.Headers[0].Algorithm, &alg) != nil {
+			return nil, 0, requestObjectError("request object signing algorithm unsupported")
+		}
+
+		if !lo.Contains(s.requestObjectSigningAlgs(c), alg) {
+			return nil, 0, requestObjectError("request object signing algorithm not allowed")
+		}
+
+		algs = []spec.SignatureAlgorithm{alg}
+	}
+
+	for _, alg := range algs {
+		var (
+			claims = map[string]any{}
+			err    error
+		)
+
+		switch {
+		case alg == spec.NoSignature && encrypted:
+			err = jose.Decode(raw, opts...).Into(&claims)
+		case alg == spec.NoSignature:
+			err = jose.Decode(raw, jose.PeekOnly()).Into(&claims)
+		default:
+			keys, kErr := requestObjectKeys(ctx, c, alg, jose.KeyID(raw))
+			if kErr != nil {
+				return nil, 0, fault.Wrap(kErr,
+					ftag.With(spec.ErrKindInvalidRequestObject),
+					fmsg.WithDesc("client keys unavailable", "The request object cannot be verified."),
+				)
+			}
+			err = jose.Decode(raw, append(opts, jose.ExpectSignature(alg, keys))...).Into(&claims)
+		}
+
+		if err == nil {
+			return claims, alg, nil
+		}
+	}
+
+	return nil, 0, requestObjectError("request object cannot be decoded or verified")
+}
+
+// validateRequestObject checks the claims of the request object against the client and the query parameters of the
+// Request, as required by OpenID Connect Core 1.0 Section 6.3. Signed request objects must also be issued by the
+// client to this server, and be limited in time, as required by RFC 9101 Section 4 and 6.3.
+func (s *Service) validateRequestObject(claims map[string]any, alg spec.SignatureAlgorithm, req *Request) error {
+	signed := alg != spec.NoSignature
+
+	if clientID, ok := claims["client_id"]; ok && clientID != req.ClientID {
+		return requestObjectError("client_id mismatch")
+	}
+
+	if responseType, ok := claims["response_type"].(string); ok {
+		set, err := spec.ResponseTypeSet(0).AddValues(splitSpaces(responseType)...)
+		if err != nil || set != req.ResponseType {
+			return requestObjectError("response_type mismatch")
+		}
+	} else if _, ok = claims["response_type"]; ok {
+		return requestObjectError("response_type mismatch")
+	}
+
+	if iss, ok := claims["iss"]; ok && iss != req.ClientID {
+		return requestObjectError("iss mismatch")
+	} else if !ok && signed {
+		return requestObjectError("iss missing")
+	}
+
+	if aud, ok := claims["aud"]; ok {
+		var audiences []any
+		switch value := aud.(type) {
+		case string:
+			audiences = []any{value}
+		case []any:
+			audiences = value
+		}
+		if !lo.ContainsBy(audiences, func(each any) bool { return each == s.discovery.Issuer }) {
+			return requestObjectError("aud mismatch")
+		}
+	} else if signed {
+		return requestObjectError("aud missing")
+	}
+
+	now := time.Now()
+
+	if exp, ok := claims["exp"]; ok {
+		seconds, isNumber := exp.(float64)
+		if !isNumber || now.Add(-requestObjectLeeway).After(time.Unix(int64(seconds), 0)) {
+			return requestObjectError("request object expired")
+		}
+	} else if signed {
+		return requestObjectError("exp missing")
+	}
+
+	if nbf, ok := claims["nbf"]; ok {
+		seconds, isNumber := nbf.(float64)
+		if !isNumber || now.Add(requestObjectLeeway).Before(time.Unix(int64(seconds), 0)) {
+			return requestObjectError("request object not yet valid")
+		}
+	}
+
+	return nil
+}
+
+// requestObjectSigningAlgs returns the signing algorithms allowed for the request objects of the client: the one
+// registered by the client, or else all advertised in Discovery. HMAC algorithms are never allowed for clients without
+// secret.
+func (s *Service) requestObjectSigningAlgs(c *client.Client) []spec.SignatureAlgorithm {
+	algs := s.discovery.RequestObjectSigningAlgValuesSupported
+	if c.RequestObjectSigningAlg != 0 {
+		algs = []spec.SignatureAlgorithm{c.RequestObjectSigningAlg}
+	}
+
+	return lo.Reject(algs, func(alg spec.SignatureAlgorithm, _ int) bool {
+		return isHMAC(alg) && len(c.Secret) == 0
+	})
+}
+
+// allowsRequestObjectEncryption returns true if the encryption algorithm and encoding are the ones registered by the
+// client, or else are advertised in Discovery.
+func (s *Service) allowsRequestObjectEncryption(c *client.Client, alg spec.EncryptionAlgorithm, enc spec.EncryptionEncoding) bool {
+	if c.RequestObjectEncryptionAlg != 0 {
+		registeredEnc := c.RequestObjectEncryptionEnc
+		if registeredEnc == 0 {
+			registeredEnc = spec.A128CBC_HS256
+		}
+		return alg == c.RequestObjectEncryptionAlg && enc == registeredEnc
+	}
+
+	return lo.Contains(s.discovery.RequestObjectEncryptionAlgValuesSupported, alg) &&
+		lo.Contains(s.discovery.RequestObjectEncryptionEncValuesSupported, enc)
+}
+
+// requestObjectKeys returns the keys to verify request objects of the client signed with the algorithm: the client
+// secret for HMAC algorithms, or the client keys otherwise, including the key identified by kid if any.
+func requestObjectKeys(ctx context.Context, c *client.Client, alg spec.SignatureAlgorithm, kid string) (*jose.JSONWebKeySet, error) {
+	switch {
+	case isHMAC(alg) && len(c.Secret) == 0:
+		return nil, errors.New("client has no secret")
+	case isHMAC(alg):
+		return jose.NewJSONWebKeySet(&jose.JSONWebKey{
+			Key:       []byte(c.Secret),
+			Algorithm: alg.String(),
+			Use:       jose.UseSig,
+		}), nil
+	default:
+		return c.VerificationKeys(ctx, kid)
+	}
+}
+
+func isHMAC(alg spec.SignatureAlgorithm) bool {
+	return alg == spec.HS256 || alg == spec.HS384 || alg == spec.HS512
+}
+
+func requestObjectError(message string) error {
+	return fault.Wrap(ErrRequest,
+		ftag.With(spec.ErrKindInvalidRequestObject),
+		fmsg.WithDesc(message, "The request object is invalid."),
+	)
+}
@@ -0,0 +1,298 @@
+//go:build unit
+
+package authorize_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestService_Authorize_RequestObject(t *testing.T) {
+	provider := &testProvider{
+		login:   loginResult("alice"),
+		consent: consentResult("openid"),
+	}
+
+	// signed returns the request object of the signer client, whose iss, aud and exp are valid unless overridden by the
+	// claims. Claims with nil values are removed.
+	signed := func(claims map[string]any) string {
+		object := map[string]any{
+			"iss": "signer",
+			"aud": "https://tigerd.test",
+			"exp": time.Now().Add(time.Minute).Unix(),
+		}
+		for k, v := range claims {
+			if v == nil {
+				delete(object, k)
+			} else {
+				object[k] = v
+			}
+		}
+
+		raw, err := jose.Encode(object, jose.WithSignature(spec.RS256, signerKeys))
+		require.NoError(t, err)
+		return raw
+	}
+
+	cases := []struct {
+		name   string
+		query  url.Values
+		assert func(t *testing.T, resp *authorize.Response, err error)
+	}{
+		{
+			name: "signed request object supersedes query",
+			query: url.Values{
+				"client_id":     {"signer"},
+				"response_type": {"code"},
+				"scope":         {"openid"},
+				"redirect_uri":  {"https://signer.com/other"},
+				"state":         {"query"},
+				"request": {signed(map[string]any{
+					"client_id":     "signer",
+					"response_type": "code",
+					"redirect_uri":  "https://signer.com/callback",
+					"state":         "object",
+				})},
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error) {
+				if assert.NoError(t, err) {
+					assert.Equal(t, "https://signer.com/callback", resp.Target)
+					assert.Equal(t, "object", resp.Params["state"])
+				}
+			},
+		},
+		{
+			name: "signed and encrypted request object",
+			query: url.Values{
+				"client_id":     {"signer"},
+				"response_type": {"code"},
+				"request": {func() string {
+					raw, err := jose.Encode(map[string]any{
+						"iss":          "signer",
+						"aud":          []string{"https://tigerd.test"},
+						"exp":          time.Now().Add(time.Minute).Unix(),
+						"scope":        "openid",
+						"redirect_uri": "https://signer.com/callback",
+						"claims":       map[string]any{"userinfo": map[string]any{"email": nil}},
+					},
+						jose.WithSignature(spec.RS256, signerKeys),
+						jose.WithEncryption(spec.RSA_OAEP_256, spec.A128CBC_HS256, serverKeys.Public()),
+					)
+					require.NoError(t, err)
+					return raw
+				}()},
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error) {
+				if assert.NoError(t, err) {
+					assert.Equal(t, "https://signer.com/callback", resp.Target)
+				}
+			},
+		},
+		{
+			name: "unsigned request object",
+			query: url.Values{
+				"client_id":     {"foo"},
+				"response_type": {"code"},
+				"request": {unsigned(t, map[string]any{
+					"scope":        "openid",
+					"redirect_uri": "https://foo.com/callback",
+				})},
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "unsigned request object when signing is registered",
+			query: url.Values{
+				"client_id":     {"signer"},
+				"response_type": {"code"},
+				"redirect_uri":  {"https://signer.com/callback"},
+				"request":       {unsigned(t, map[string]any{"scope": "openid"})},
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error) {
+				assert.Equal(t, spec.ErrKindInvalidRequestObject, ftag.Get(err))
+				assert.True(t, errors.As(err, new(*authorize.RedirectError)))
+			},
+		},
+		{
+			name: "signed by another key",
+			query: url.Values{
+				"client_id":     {"signer"},
+				"response_type": {"code"},
+				"redirect_uri":  {"https://signer.com/callback"},
+				"request": {func() string {
+					raw, err := jose.Encode(map[string]any{"scope": "openid"}, jose.WithSignature(spec.RS256, serverKeys))
+					require.NoError(t, err)
+					return raw
+				}()},
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error) {
+				assert.Equal(t, spec.ErrKindInvalidRequestObject, ftag.Get(err))
+			},
+		},
+		{
+			name: "client_id mismatch",
+			query: url.Values{
+				"client_id":     {"signer"},
+				"response_type": {"code"},
+				"redirect_uri":  {"https://signer.com/callback"},
+				"request":       {signed(map[string]any{"client_id": "foo", "scope": "openid"})},
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error) {
+				assert.Equal(t, spec.ErrKindInvalidRequestObject, ftag.Get(err))
+			},
+		},
+		{
+			name: "response_type mismatch",
+			query: url.Values{
+				"client_id":     {"signer"},
+				"response_type": {"code"},
+				"redirect_uri":  {"https://signer.com/callback"},
+				"request":       {signed(map[string]any{"response_type": "code id_token", "scope": "openid"})},
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error) {
+				assert.Equal(t, spec.ErrKindInvalidRequestObject, ftag.Get(err))
+			},
+		},
+		{
+			name: "issuer mismatch",
+			query: url.Values{
+				"client_id":     {"signer"},
+				"response_type": {"code"},
+				"redirect_uri":  {"https://signer.com/callback"},
+				"request":       {signed(map[string]any{"iss": "foo", "scope": "openid"})},
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error) {
+				assert.Equal(t, spec.ErrKindInvalidRequestObject, ftag.Get(err))
+			},
+		},
+		{
+			name: "audience mismatch",
+			query: url.Values{
+				"client_id":     {"signer"},
+				"response_type": {"code"},
+				"redirect_uri":  {"https://signer.com/callback"},
+				"request":       {signed(map[string]any{"aud": []string{"https://other.test"}, "scope": "openid"})},
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error) {
+				assert.Equal(t, spec.ErrKindInvalidRequestObject, ftag.Get(err))
+			},
+		},
+		{
+			name: "expired",
+			query: url.Values{
+				"client_id":     {"signer"},
+				"response_type": {"code"},
+				"redirect_uri":  {"https://signer.com/callback"},
+				"request":       {signed(map[string]any{"exp": time.Now().Add(-2 * time.Minute).Unix(), "scope": "openid"})},
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error) {
+				assert.Equal(t, spec.ErrKindInvalidRequestObject, ftag.Get(err))
+			},
+		},
+		{
+			name: "not yet valid",
+			query: url.Values{
+				"client_id":     {"signer"},
+				"response_type": {"code"},
+				"redirect_uri":  {"https://signer.com/callback"},
+				"request":       {signed(map[string]any{"nbf": time.Now().Add(2 * time.Minute).Unix(), "scope": "openid"})},
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error) {
+				assert.Equal(t, spec.ErrKindInvalidRequestObject, ftag.Get(err))
+			},
+		},
+		{
+			name: "signed without iss",
+			query: url.Values{
+				"client_id":     {"signer"},
+				"response_type": {"code"},
+				"redirect_uri":  {"https://signer.com/callback"},
+				"request":       {signed(map[string]any{"iss": nil, "scope": "openid"})},
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error) {
+				assert.Equal(t, spec.ErrKindInvalidRequestObject, ftag.Get(err))
+			},
+		},
+		{
+			name: "signed without aud",
+			query: url.Values{
+				"client_id":     {"signer"},
+				"response_type": {"code"},
+				"redirect_uri":  {"https://signer.com/callback"},
+				"request":       {signed(map[string]any{"aud": nil, "scope": "openid"})},
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error) {
+				assert.Equal(t, spec.ErrKindInvalidRequestObject, ftag.Get(err))
+			},
+		},
+		{
+			name: "signed without exp",
+			query: url.Values{
+				"client_id":     {"signer"},
+				"response_type": {"code"},
+				"redirect_uri":  {"https://signer.com/callback"},
+				"request":       {signed(map[string]any{"exp": nil, "scope": "openid"})},
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error) {
+				assert.Equal(t, spec.ErrKindInvalidRequestObject, ftag.Get(err))
+			},
+		},
+		{
+			name: "signed with empty secret of client without secret",
+			query: url.Values{
+				"client_id":     {"foo"},
+				"response_type": {"code"},
+				"redirect_uri":  {"https://foo.com/callback"},
+				"request": {func() string {
+					keys := jose.NewJSONWebKeySet(&jose.JSONWebKey{Key: []byte{}, Algorithm: spec.HS256.String(), Use: jose.UseSig})
+					raw, err := jose.Encode(map[string]any{
+						"iss":   "foo",
+						"aud":   "https://tigerd.test",
+						"exp":   time.Now().Add(time.Minute).Unix(),
+						"scope": "openid",
+					}, jose.WithSignature(spec.HS256, keys))
+					require.NoError(t, err)
+					return raw
+				}()},
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error) {
+				assert.Equal(t, spec.ErrKindInvalidRequestObject, ftag.Get(err))
+			},
+		},
+	}
+
+	service := newTestService(t, provider, memory.New(time.Minute))
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, err := authorize.ParseRequest(c.query)
+			require.NoError(t, err)
+
+			resp, err := service.Authorize(context.Background(), req, "", "")
+			c.assert(t, resp, err)
+		})
+	}
+}
+
+// unsigned returns the claims as an unsecured JWT, whose alg is none.
+func unsigned(t *testing.T, claims map[string]any) string {
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"none"}`)) + "." + encode(payload) + "."
+}
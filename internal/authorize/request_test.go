@@ -0,0 +1,210 @@
+//go:build unit
+
+package authorize_test
+
+import (
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func TestParseRequest(t *testing.T) {
+	cases := []struct {
+		name   string
+		values url.Values
+		assert func(t *testing.T, req *authorize.Request, err error)
+	}{
+		{
+			name: "correct",
+			values: url.Values{
+				"response_type": {"code"},
+				"client_id":     {"foo"},
+				"redirect_uri":  {"https://foo.com/callback"},
+				"scope":         {"openid profile"},
+				"state":         {"xyz"},
+				"prompt":        {"login consent"},
+				"display":       {"page"},
+				"ui_locales":    {"zh-CN en-US"},
+				"acr_values":    {"urn:a urn:b"},
+			},
+			assert: func(t *testing.T, req *authorize.Request, err error) {
+				if assert.NoError(t, err) {
+					assert.NoError(t, req.Validate())
+					assert.Equal(t, spec.ResponseTypeCode.ToSet(), req.ResponseType)
+					assert.Equal(t, []string{"openid", "profile"}, req.Scopes)
+					assert.True(t, req.Prompt.Contains(spec.PromptLogin))
+					assert.True(t, req.Prompt.Contains(spec.PromptConsent))
+					assert.Equal(t, spec.DisplayPage, req.Display)
+					assert.Equal(t, []string{"zh-CN", "en-US"}, req.UILocales)
+					assert.Equal(t, []string{"urn:a", "urn:b"}, req.ACRValues)
+				}
+			},
+		},
+		{
+			name: "unknown response type",
+			values: url.Values{
+				"response_type": {"code foo"},
+			},
+			assert: func(t *testing.T, req *authorize.Request, err error) {
+				assert.ErrorIs(t, err, authorize.ErrRequest)
+				assert.Equal(t, spec.ErrKindUnsupportedResponseType, ftag.Get(err))
+			},
+		},
+		{
+			name: "response mode",
+			values: url.Values{
+				"response_mode": {"fragment"},
+			},
+			assert: func(t *testing.T, req *authorize.Request, err error) {
+				if assert.NoError(t, err) {
+					assert.Equal(t, spec.ResponseModeFragment, req.ResponseMode)
+				}
+			},
+		},
+		{
+			name: "form post response mode",
+			values: url.Values{
+				"response_mode": {"form_post"},
+			},
+			assert: func(t *testing.T, req *authorize.Request, err error) {
+				if assert.NoError(t, err) {
+					assert.Equal(t, spec.ResponseModeFormPost, req.ResponseMode)
+				}
+			},
+		},
+		{
+			name: "unknown response mode keeps parsed parameters",
+			values: url.Values{
+				"client_id":     {"foo"},
+				"redirect_uri":  {"https://foo.com/callback"},
+				"state":         {"xyz"},
+				"response_mode": {"foo"},
+			},
+			assert: func(t *testing.T, req *authorize.Request, err error) {
+				assert.Equal(t, spec.ErrKindInvalidRequest, ftag.Get(err))
+				if assert.NotNil(t, req) {
+					assert.Equal(t, "foo", req.ClientID)
+					assert.Equal(t, "https://foo.com/callback", req.RedirectURI)
+					assert.Equal(t, "xyz", req.State)
+				}
+			},
+		},
+		{
+			name: "claims",
+			values: url.Values{
+				"claims": {`{"userinfo":{"email":null,"name":{"essential":true}},"id_token":{"acr":{"values":["urn:a"]}}}`},
+			},
+			assert: func(t *testing.T, req *authorize.Request, err error) {
+				if assert.NoError(t, err) && assert.NotNil(t, req.Claims) {
+					assert.Contains(t, req.Claims.UserInfo, "email")
+					assert.Nil(t, req.Claims.UserInfo["email"])
+					assert.True(t, req.Claims.UserInfo["name"].Essential)
+					assert.Equal(t, []any{"urn:a"}, req.Claims.IDToken["acr"].Values)
+				}
+			},
+		},
+		{
+			name: "malformed claims",
+			values: url.Values{
+				"claims": {`{"userinfo":`},
+			},
+			assert: func(t *testing.T, req *authorize.Request, err error) {
+				assert.Equal(t, spec.ErrKindInvalidRequest, ftag.Get(err))
+			},
+		},
+		{
+			name: "unknown prompt",
+			values: url.Values{
+				"prompt": {"foo"},
+			},
+			assert: func(t *testing.T, req *authorize.Request, err error) {
+				assert.ErrorIs(t, err, authorize.ErrRequest)
+				assert.Equal(t, spec.ErrKindInvalidRequest, ftag.Get(err))
+			},
+		},
+		{
+			name: "code challenge defaults to plain",
+			values: url.Values{
+				"code_challenge": {"dBjftJeZ4CVP-mJ92K9D8kRNp3UyHd0I3lFhOfEaIqM"},
+			},
+			assert: func(t *testing.T, req *authorize.Request, err error) {
+				if assert.NoError(t, err) {
+					assert.Equal(t, spec.CodeChallengeMethodPlain, req.CodeChallengeMethod)
+				}
+			},
+		},
+		{
+			name: "unknown display",
+			values: url.Values{
+				"display": {"foo"},
+			},
+			assert: func(t *testing.T, req *authorize.Request, err error) {
+				assert.ErrorIs(t, err, authorize.ErrRequest)
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, err := authorize.ParseRequest(c.values)
+			c.assert(t, req, err)
+		})
+	}
+}
+
+func TestRequest_Validate(t *testing.T) {
+	gold := func() *authorize.Request {
+		return &authorize.Request{
+			ResponseType: spec.ResponseTypeCode.ToSet(),
+			ClientID:     "foo",
+			RedirectURI:  "https://foo.com/callback",
+			Scopes:       []string{"openid"},
+		}
+	}
+
+	cases := []struct {
+		name   string
+		hook   func(r *authorize.Request)
+		expect ftag.Kind
+	}{
+		{name: "gold", hook: func(r *authorize.Request) {}},
+		{name: "custom scheme redirect uri", hook: func(r *authorize.Request) { r.RedirectURI = "com.foo.app:/callback" }},
+		{name: "missing client id", hook: func(r *authorize.Request) { r.ClientID = "" }, expect: spec.ErrKindInvalidRequest},
+		{name: "missing scope", hook: func(r *authorize.Request) { r.Scopes = nil }, expect: spec.ErrKindInvalidRequest},
+		{name: "relative redirect uri", hook: func(r *authorize.Request) { r.RedirectURI = "/callback" }, expect: spec.ErrKindInvalidRequest},
+		{name: "redirect uri with fragment", hook: func(r *authorize.Request) { r.RedirectURI = "https://foo.com/callback#bar" }, expect: spec.ErrKindInvalidRequest},
+		{
+			name:   "invalid prompt combination",
+			hook:   func(r *authorize.Request) { r.Prompt = spec.PromptSet(0).Add(spec.PromptLogin, spec.PromptNone) },
+			expect: spec.ErrKindInvalidRequest,
+		},
+		{
+			name:   "code challenge method without code challenge",
+			hook:   func(r *authorize.Request) { r.CodeChallengeMethod = spec.CodeChallengeMethodS256 },
+			expect: spec.ErrKindInvalidRequest,
+		},
+		{
+			name:   "unsupported response type",
+			hook:   func(r *authorize.Request) { r.ResponseType = spec.ResponseTypeToken.ToSet() },
+			expect: spec.ErrKindUnsupportedResponseType,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := gold()
+			c.hook(req)
+
+			err := req.Validate()
+			if len(c.expect) == 0 {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, authorize.ErrRequest)
+				assert.Equal(t, c.expect, ftag.Get(err))
+			}
+		})
+	}
+}
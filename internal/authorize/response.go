@@ -0,0 +1,116 @@
+package authorize
+
+import (
+	"context"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/spec"
+	providerv1 "github.com/absurdlab/tigerd/proto/gen/go/proto/provider/v1"
+	"net/http"
+	"net/url"
+)
+
+// Response is the outcome of an authorization step, which instructs the user agent to be redirected, either to the
+// provider for End-User interaction, or back to the client with the authorization response.
+type Response struct {
+	// Status is the HTTP redirection status.
+	Status int
+	// Target is the base url of the redirection.
+	Target string
+	// Params are the parameters to be included in the redirection url.
+	Params map[string]string
+	// Mode determines how Params are rendered in the redirection url.
+	Mode spec.ResponseMode
+	// Headers are extra headers to be set in the HTTP response.
+	Headers map[string]string
+	// Sid is the id of the LoginSession the user agent is bound to.
+	Sid string
+	// Binding is the secret of the authorization session handed over to the provider, to be bound to the user agent,
+	// so that only the same user agent resumes the session.
+	Binding string
+}
+
+func newRedirectionResponse(r *providerv1.Redirection, sid string) *Response {
+	resp := &Response{
+		Status:  int(r.GetStatus()),
+		Target:  r.GetTarget(),
+		Params:  r.GetParams(),
+		Mode:    spec.ResponseModeQuery,
+		Headers: r.GetHeaders(),
+		Sid:     sid,
+	}
+	if resp.Status == 0 {
+		resp.Status = http.StatusFound
+	}
+	switch r.GetMode() {
+	case providerv1.Redirection_MODE_FRAGMENT:
+		resp.Mode = spec.ResponseModeFragment
+	case providerv1.Redirection_MODE_FORM_POST:
+		resp.Mode = spec.ResponseModeFormPost
+	}
+	return resp
+}
+
+// Location renders the redirection url from Target and Params according to Mode. Responses in the form_post mode are
+// not redirections, and should be rendered as a form posting Params to Target instead.
+func (r *Response) Location() (string, error) {
+	u, err := url.Parse(r.Target)
+	if err != nil {
+		return "", err
+	}
+
+	switch r.Mode {
+	case spec.ResponseModeFragment:
+		params := url.Values{}
+		for k, v := range r.Params {
+			params.Set(k, v)
+		}
+		u.Fragment = ""
+		u.RawFragment = ""
+		return u.String() + "#" + params.Encode(), nil
+	default:
+		query := u.Query()
+		for k, v := range r.Params {
+			query.Set(k, v)
+		}
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+}
+
+// RedirectError is an error of an authorization request whose redirect_uri has been validated against the client
+// registration, which is hence returned to the client at the redirect_uri rather than displayed to the End-User.
+type RedirectError struct {
+	Err     error
+	Request *Request
+
+	client  *client.Client
+	encoder *responseEncoder
+}
+
+func (e *RedirectError) Error() string { return e.Err.Error() }
+func (e *RedirectError) Unwrap() error { return e.Err }
+
+// Response returns the error response defined in RFC 6749 Section 4.1.2.1, which redirects the user agent to the
+// client with the error params and the state of the request, using the response mode of the request. In JWT response
+// modes, the params are encoded as a JWT.
+func (e *RedirectError) Response(ctx context.Context, params map[string]string) (*Response, error) {
+	resp := &Response{
+		Status: http.StatusFound,
+		Target: e.Request.RedirectURI,
+		Params: make(map[string]string, len(params)+1),
+		Mode:   e.Request.responseMode(),
+	}
+	for k, v := range params {
+		resp.Params[k] = v
+	}
+	if len(e.Request.State) > 0 {
+		resp.Params["state"] = e.Request.State
+	}
+
+	if e.encoder == nil {
+		resp.Mode = resp.Mode.Plain()
+		return resp, nil
+	}
+
+	return e.encoder.encode(ctx, e.client, resp)
+}
@@ -0,0 +1,700 @@
+package authorize
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/Southclaws/fault"
+	"github.com/Southclaws/fault/fmsg"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/token"
+	"github.com/absurdlab/tigerd/internal/wellknown"
+	providerv1 "github.com/absurdlab/tigerd/proto/gen/go/proto/provider/v1"
+	"github.com/absurdlab/tigerd/proto/gen/go/proto/provider/v1/providerv1connect"
+	"github.com/bufbuild/connect-go"
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/samber/lo"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrProvider is the root error returned when the provider fails or responds with unexpected results.
+	ErrProvider = errors.New("provider error")
+	// ErrSessionState is the root error returned when an authorization session is not in the state to accept the
+	// operation.
+	ErrSessionState = errors.New("unexpected authorization session state")
+)
+
+// Properties is the configuration properties for the authorization service.
+type Properties struct {
+	// SessionLifespan is the maximum duration an authorization session can last.
+	SessionLifespan time.Duration `json:"session_lifespan" yaml:"session_lifespan"`
+	// LoginSessionLifespan is the maximum duration End-User authentications are remembered in a user agent.
+	LoginSessionLifespan time.Duration `json:"login_session_lifespan" yaml:"login_session_lifespan"`
+	// CodeLifespan is the duration an authorization code remains redeemable.
+	CodeLifespan time.Duration `json:"code_lifespan" yaml:"code_lifespan"`
+}
+
+// Validate performs validation to this Properties.
+func (p *Properties) Validate() error {
+	return v.Errors{
+		"session_lifespan":       v.Validate(p.SessionLifespan, v.Required),
+		"login_session_lifespan": v.Validate(p.LoginSessionLifespan, v.Required),
+		"code_lifespan":          v.Validate(p.CodeLifespan, v.Required, v.Max(10*time.Minute)),
+	}.Filter()
+}
+
+// NewService creates a Service that talks to the configured providers. Authorization sessions are delegated to the
+// provider bound to the client, or the first configured provider if the client is not bound to any. Authorization
+// responses in JWT response modes are signed with the algorithm registered by the client, or else the first
+// algorithm from the authorization signing algorithms advertised in Discovery that has a key in the JSONWebKeySet, or
+// RS256 when none is advertised.
+func NewService(
+	props *Properties,
+	providers []*ProviderProperties,
+	discovery *wellknown.Discovery,
+	jwks *jose.JSONWebKeySet,
+	clients client.Registry,
+	sessions SessionStore,
+	loginSessions LoginSessionStore,
+	grants GrantStore,
+	codes token.CodeStore,
+) (*Service, error) {
+	if len(providers) == 0 {
+		return nil, errors.New("at least one provider is required")
+	}
+
+	alg, ok := lo.Find(discovery.AuthorizationSigningAlgValuesSupported, func(alg spec.SignatureAlgorithm) bool {
+		return !alg.IsNoneOrEmpty() && jwks.FindForSigning(alg) != nil
+	})
+	if !ok {
+		alg = spec.RS256
+	}
+
+	s := &Service{
+		props:              props,
+		providers:          map[string]providerv1connect.ProviderServiceClient{},
+		defaultProviderKey: providers[0].Key,
+		discovery:          discovery,
+		jwks:               jwks,
+		encoder:            &responseEncoder{issuer: discovery.Issuer, jwks: jwks, alg: alg},
+		clients:            clients,
+		sessions:           sessions,
+		loginSessions:      loginSessions,
+		grants:             grants,
+		codes:              codes,
+	}
+	for _, p := range providers {
+		s.providers[p.Key] = providerv1connect.NewProviderServiceClient(http.DefaultClient, p.baseURL())
+	}
+
+	return s, nil
+}
+
+// Service drives authorization sessions through the End-User interactions delegated to the ProviderService, and
+// completes them with an authorization response to the client.
+type Service struct {
+	props              *Properties
+	providers          map[string]providerv1connect.ProviderServiceClient
+	defaultProviderKey string
+	discovery          *wellknown.Discovery
+	jwks               *jose.JSONWebKeySet
+	encoder            *responseEncoder
+	clients            client.Registry
+	sessions           SessionStore
+	loginSessions      LoginSessionStore
+	grants             GrantStore
+	codes              token.CodeStore
+}
+
+// Authorize starts a new authorization session for the request, after merging its request object, if any. The sid is
+// the id of the LoginSession bound to the user agent, and may be empty or stale. The binding is the secret bound to
+// the user agent by previous authorization sessions, which is reused if present. Errors after the redirect_uri is
+// validated are returned as RedirectError.
+func (s *Service) Authorize(ctx context.Context, req *Request, sid string, binding string) (*Response, error) {
+	expanded, err := s.expand(ctx, req)
+	if err != nil {
+		return nil, s.Reject(ctx, req, err)
+	}
+	req = expanded
+
+	c, err := s.redirectable(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = req.validateResponseMode(s.discovery.ResponseModesSupported); err != nil {
+		// the error cannot be returned in the unsupported response mode, but in the default one of the response type.
+		fallback := *req
+		fallback.ResponseMode = 0
+		return nil, s.redirectError(err, &fallback, c)
+	}
+
+	resp, err := s.authorize(ctx, req, c, sid, binding)
+	if err != nil {
+		return nil, s.redirectError(err, req, c)
+	}
+
+	return resp, nil
+}
+
+// Reject returns the error of the authorization request that failed to parse as RedirectError, so that it is
+// returned to the client, if the client_id and redirect_uri of the request are valid. Otherwise, the error about the
+// client_id or redirect_uri is returned.
+func (s *Service) Reject(ctx context.Context, req *Request, err error) error {
+	c, cErr := s.redirectable(ctx, req)
+	if cErr != nil {
+		return cErr
+	}
+	return s.redirectError(err, req, c)
+}
+
+func (s *Service) redirectError(err error, req *Request, c *client.Client) *RedirectError {
+	return &RedirectError{Err: err, Request: req, client: c, encoder: s.encoder}
+}
+
+// redirectable returns the client of the request, after checking the redirect_uri of the request is registered by
+// the client, so that errors of the request can be returned to the client.
+func (s *Service) redirectable(ctx context.Context, req *Request) (*client.Client, error) {
+	if req == nil || len(req.ClientID) == 0 {
+		return nil, fault.Wrap(ErrRequest,
+			ftag.With(spec.ErrKindInvalidRequest),
+			fmsg.WithDesc("client_id is required", "The client_id is required."),
+		)
+	}
+
+	c, err := s.client(ctx, req.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = req.validateRedirectURI(c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (s *Service) authorize(ctx context.Context, req *Request, c *client.Client, sid string, binding string) (*Response, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := req.validateClient(c); err != nil {
+		return nil, err
+	}
+
+	providerKey := c.ProviderKey
+	if len(providerKey) == 0 {
+		providerKey = s.defaultProviderKey
+	}
+
+	session := newSession(req, providerKey, sid, binding, s.props.SessionLifespan)
+	session.client = c
+
+	return s.proceed(ctx, session)
+}
+
+// Resume continues the authorization session after the provider has reported the result of the step the session
+// was redirected for. A session can only be resumed once per reported step, and only by the user agent that started
+// it, which presents its binding. Errors after the session is claimed are returned as RedirectError.
+func (s *Service) Resume(ctx context.Context, sessionID string, binding string) (*Response, error) {
+	session, err := s.session(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(session.Binding) == 0 || subtle.ConstantTimeCompare([]byte(session.Binding), []byte(binding)) != 1:
+		return nil, fault.Wrap(ErrSessionState,
+			ftag.With(spec.ErrKindInvalidRequest),
+			fmsg.WithDesc(
+				"session resumed by another user agent",
+				"The authorization session was started in another browser.",
+			),
+		)
+	case session.Step == 0:
+		return nil, fault.Wrap(ErrSessionState,
+			ftag.With(spec.ErrKindInvalidRequest),
+			fmsg.WithDesc("session is not awaiting resumption", "The authorization session cannot be resumed."),
+		)
+	case !session.Reported:
+		return nil, fault.Wrap(ErrSessionState,
+			ftag.With(spec.ErrKindInvalidRequest),
+			fmsg.WithDesc(
+				fmt.Sprintf("session resumed before %s result is reported", session.Step),
+				"The authorization session cannot be resumed before the End-User interaction is finished.",
+			),
+		)
+	}
+
+	// claim the resumption before talking to the provider again, so repeated resumptions are rejected.
+	claimed, err := s.sessions.ClaimSession(ctx, session.ID)
+	switch {
+	case errors.Is(err, ErrSessionNotFound), errors.Is(err, ErrSessionState):
+		return nil, fault.Wrap(err,
+			ftag.With(spec.ErrKindInvalidRequest),
+			fmsg.WithDesc("session resumed concurrently", "The authorization session cannot be resumed."),
+		)
+	case err != nil:
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+	claimed.client = session.client
+	session = claimed
+
+	resp, err := s.proceed(ctx, session)
+	if err != nil {
+		return nil, s.redirectError(err, session.Request, session.client)
+	}
+
+	return resp, nil
+}
+
+// ReportLogin records the login result reported by the provider for a session that was redirected to the provider
+// for login. The session is ready to be resumed afterwards.
+func (s *Service) ReportLogin(ctx context.Context, providerKey string, sessionID string, result *providerv1.LoginResult) error {
+	return s.report(ctx, providerKey, sessionID, StepLogin, func(session *Session) error {
+		return s.loggedIn(ctx, session, result)
+	})
+}
+
+// ReportSelectAccount records the select account result reported by the provider for a session that was redirected
+// to the provider for account selection. The session is ready to be resumed afterwards.
+func (s *Service) ReportSelectAccount(ctx context.Context, providerKey string, sessionID string, result *providerv1.SelectAccountResult) error {
+	return s.report(ctx, providerKey, sessionID, StepSelectAccount, func(session *Session) error {
+		return s.accountSelected(ctx, session, result)
+	})
+}
+
+// ReportConsent records the consent result reported by the provider for a session that was redirected to the
+// provider for consent. The session is ready to be resumed afterwards.
+func (s *Service) ReportConsent(ctx context.Context, providerKey string, sessionID string, result *providerv1.ConsentResult) error {
+	return s.report(ctx, providerKey, sessionID, StepConsent, func(session *Session) error {
+		return s.consented(ctx, session, result)
+	})
+}
+
+// report applies the result reported by the provider identified by providerKey. Providers can only report the sessions
+// handed over to themselves.
+func (s *Service) report(ctx context.Context, providerKey string, sessionID string, step Step, apply func(session *Session) error) error {
+	session, err := s.session(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if session.ProviderKey != providerKey {
+		return fault.Wrap(ErrSessionNotFound,
+			ftag.With(spec.ErrKindInvalidRequest),
+			fmsg.WithDesc("session of another provider", "The authorization session does not exist or has expired."),
+		)
+	}
+
+	if session.Step != step || session.Reported {
+		return fault.Wrap(ErrSessionState,
+			ftag.With(spec.ErrKindInvalidRequest),
+			fmsg.With(fmt.Sprintf("session does not expect %s result", step)),
+		)
+	}
+
+	if err = apply(session); err != nil {
+		return err
+	}
+
+	session.Reported = true
+	if err = s.sessions.SaveSession(ctx, session); err != nil {
+		return fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	return nil
+}
+
+// proceed advances the session until it either requires a redirection to the provider, or is completed.
+func (s *Service) proceed(ctx context.Context, session *Session) (*Response, error) {
+	for {
+		var (
+			resp *Response
+			err  error
+		)
+
+		switch {
+		case session.Authentication == nil:
+			resp, err = s.authenticate(ctx, session)
+		case !session.Consented:
+			resp, err = s.consent(ctx, session)
+		default:
+			return s.complete(ctx, session)
+		}
+
+		if err != nil || resp != nil {
+			return resp, err
+		}
+	}
+}
+
+func (s *Service) authenticate(ctx context.Context, session *Session) (*Response, error) {
+	loginSession, err := s.loginSession(ctx, session.Sid)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		prompt  = session.Request.Prompt
+		options = loginSession.Options()
+	)
+
+	switch {
+	case prompt.Contains(spec.PromptLogin):
+		return s.login(ctx, session)
+
+	case len(options) == 0:
+		if prompt.Contains(spec.PromptNone) {
+			return nil, fault.Wrap(ErrRequest,
+				ftag.With(spec.ErrKindLoginRequired),
+				fmsg.With("no authentication for prompt=none"),
+			)
+		}
+		return s.login(ctx, session)
+
+	case len(options) == 1 && !prompt.Contains(spec.PromptSelectAccount):
+		session.authenticated(options[0], nil)
+		return nil, nil
+
+	default:
+		if prompt.Contains(spec.PromptNone) {
+			return nil, fault.Wrap(ErrRequest,
+				ftag.With(spec.ErrKindSelectAccountRequired),
+				fmsg.With("multiple authentications for prompt=none"),
+			)
+		}
+		return s.selectAccount(ctx, session, options)
+	}
+}
+
+func (s *Service) login(ctx context.Context, session *Session) (*Response, error) {
+	res, err := s.provider(session).Login(ctx, connect.NewRequest(&providerv1.LoginRequest{
+		SessionId: session.ID,
+		Context:   session.context(),
+		LoginHint: session.Request.LoginHint,
+		AcrValues: session.Request.ACRValues,
+	}))
+	if err != nil {
+		return nil, providerError(err, StepLogin)
+	}
+
+	switch {
+	case res.Msg.GetRedirection() != nil:
+		return s.redirect(ctx, session, StepLogin, res.Msg.GetRedirection())
+	case res.Msg.GetResult() != nil:
+		return nil, s.loggedIn(ctx, session, res.Msg.GetResult())
+	default:
+		return nil, providerError(errors.New("empty login response"), StepLogin)
+	}
+}
+
+func (s *Service) loggedIn(ctx context.Context, session *Session, result *providerv1.LoginResult) error {
+	if len(result.GetAuthentication().GetSubject()) == 0 {
+		return providerError(errors.New("login result without subject"), StepLogin)
+	}
+
+	authentication := newAuthentication(result.GetAuthentication())
+	if err := s.remember(ctx, session, authentication); err != nil {
+		return err
+	}
+
+	session.authenticated(authentication, result.GetClaims())
+
+	return nil
+}
+
+func (s *Service) selectAccount(ctx context.Context, session *Session, options []*Authentication) (*Response, error) {
+	req := &providerv1.SelectAccountRequest{
+		SessionId: session.ID,
+		Context:   session.context(),
+	}
+	for _, option := range options {
+		req.Options = append(req.Options, option.proto())
+	}
+
+	res, err := s.provider(session).SelectAccount(ctx, connect.NewRequest(req))
+	if err != nil {
+		return nil, providerError(err, StepSelectAccount)
+	}
+
+	switch {
+	case res.Msg.GetRedirection() != nil:
+		return s.redirect(ctx, session, StepSelectAccount, res.Msg.GetRedirection())
+	case res.Msg.GetResult() != nil:
+		return nil, s.accountSelected(ctx, session, res.Msg.GetResult())
+	default:
+		return nil, providerError(errors.New("empty select account response"), StepSelectAccount)
+	}
+}
+
+func (s *Service) accountSelected(ctx context.Context, session *Session, result *providerv1.SelectAccountResult) error {
+	loginSession, err := s.loginSession(ctx, session.Sid)
+	if err != nil {
+		return err
+	}
+
+	authentication := loginSession.Find(result.GetSelection().GetId())
+	if authentication == nil {
+		return providerError(errors.New("selection is not one of the options"), StepSelectAccount)
+	}
+
+	session.authenticated(authentication, result.GetClaims())
+
+	return nil
+}
+
+// consent asks the provider for consent to the requested scopes that were not previously granted to the client,
+// unless the request forces consent with prompt=consent.
+func (s *Service) consent(ctx context.Context, session *Session) (*Response, error) {
+	if !session.Request.Prompt.Contains(spec.PromptConsent) {
+		grant, err := s.grant(ctx, session)
+		if err != nil {
+			return nil, err
+		}
+		if grant != nil {
+			session.PriorScopes = lo.Intersect(session.Request.Scopes, grant.Scopes)
+		}
+	}
+
+	scopes := lo.Without(session.Request.Scopes, session.PriorScopes...)
+	if len(scopes) == 0 {
+		session.consented(new(providerv1.ConsentResult))
+		return nil, nil
+	}
+
+	if session.Request.Prompt.Contains(spec.PromptNone) {
+		return nil, fault.Wrap(ErrRequest,
+			ftag.With(spec.ErrKindConsentRequired),
+			fmsg.With("consent required for prompt=none"),
+		)
+	}
+
+	res, err := s.provider(session).Consent(ctx, connect.NewRequest(&providerv1.ConsentRequest{
+		SessionId: session.ID,
+		Context:   session.context(),
+		Subject:   session.Authentication.Subject,
+		Scopes:    scopes,
+	}))
+	if err != nil {
+		return nil, providerError(err, StepConsent)
+	}
+
+	switch {
+	case res.Msg.GetRedirection() != nil:
+		return s.redirect(ctx, session, StepConsent, res.Msg.GetRedirection())
+	case res.Msg.GetResult() != nil:
+		return nil, s.consented(ctx, session, res.Msg.GetResult())
+	default:
+		return nil, providerError(errors.New("empty consent response"), StepConsent)
+	}
+}
+
+// consented applies the consent result to the session, and adds the granted scopes to the grant of the End-User to
+// the client, unless the result is ephemeral.
+func (s *Service) consented(ctx context.Context, session *Session, result *providerv1.ConsentResult) error {
+	session.consented(result)
+
+	if result.GetEphemeral() {
+		return nil
+	}
+
+	granted := lo.Intersect(session.Request.Scopes, result.GetGrantedScopes())
+	if len(granted) == 0 {
+		return nil
+	}
+
+	grant, err := s.grant(ctx, session)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if grant == nil {
+		grant = &Grant{
+			ClientID:  session.Request.ClientID,
+			Subject:   session.Authentication.Subject,
+			CreatedAt: now,
+		}
+	}
+	grant.Scopes = lo.Union(grant.Scopes, granted)
+	grant.UpdatedAt = now
+
+	if err = s.grants.SaveGrant(ctx, grant); err != nil {
+		return fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	return nil
+}
+
+// grant returns the grant of the authenticated End-User to the client of the session, or nil if there is none.
+func (s *Service) grant(ctx context.Context, session *Session) (*Grant, error) {
+	grant, err := s.grants.GetGrant(ctx, session.Request.ClientID, session.Authentication.Subject)
+	switch {
+	case err == nil:
+		return grant, nil
+	case errors.Is(err, ErrGrantNotFound):
+		return nil, nil
+	default:
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+}
+
+// redirect saves the session as handed over to the provider for the step, and returns the provider redirection.
+func (s *Service) redirect(ctx context.Context, session *Session, step Step, redirection *providerv1.Redirection) (*Response, error) {
+	if len(redirection.GetTarget()) == 0 {
+		return nil, providerError(errors.New("redirection without target"), step)
+	}
+
+	session.Step = step
+	session.Reported = false
+	if err := s.sessions.SaveSession(ctx, session); err != nil {
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	resp := newRedirectionResponse(redirection, session.Sid)
+	resp.Binding = session.Binding
+
+	return resp, nil
+}
+
+// complete issues the authorization response to the client and ends the session.
+func (s *Service) complete(ctx context.Context, session *Session) (*Response, error) {
+	if len(session.GrantedScopes) == 0 {
+		return nil, fault.Wrap(ErrRequest,
+			ftag.With(spec.ErrKindAccessDenied),
+			fmsg.WithDesc("no scope granted", "The End-User did not grant any of the requested scopes."),
+		)
+	}
+
+	sid, err := s.participate(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+
+	code := token.NewCode(session.authorization(sid), session.Request.RedirectURI, s.props.CodeLifespan).
+		WithChallenge(session.Request.CodeChallenge, session.Request.CodeChallengeMethod)
+	if err := s.codes.SaveCode(ctx, code); err != nil {
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	if err := s.sessions.DeleteSession(ctx, session.ID); err != nil {
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	resp := &Response{
+		Status: http.StatusFound,
+		Target: session.Request.RedirectURI,
+		Params: map[string]string{"code": code.Value},
+		Mode:   session.Request.responseMode(),
+		Sid:    session.Sid,
+	}
+	if len(session.Request.State) > 0 {
+		resp.Params["state"] = session.Request.State
+	}
+
+	return s.encoder.encode(ctx, session.client, resp)
+}
+
+func (s *Service) session(ctx context.Context, id string) (*Session, error) {
+	session, err := s.sessions.GetSession(ctx, id)
+	switch {
+	case err == nil:
+		if session.client, err = s.client(ctx, session.Request.ClientID); err != nil {
+			return nil, err
+		}
+		return session, nil
+	case errors.Is(err, ErrSessionNotFound):
+		return nil, fault.Wrap(err,
+			ftag.With(spec.ErrKindInvalidRequest),
+			fmsg.WithDesc("session not found", "The authorization session does not exist or has expired."),
+		)
+	default:
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+}
+
+func (s *Service) client(ctx context.Context, id string) (*client.Client, error) {
+	c, err := s.clients.Find(ctx, id)
+	switch {
+	case err == nil:
+		return c, nil
+	case errors.Is(err, client.ErrNotFound):
+		return nil, fault.Wrap(ErrRequest,
+			ftag.With(spec.ErrKindInvalidRequest),
+			fmsg.WithDesc("client not found", "The client_id is not registered."),
+		)
+	default:
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+}
+
+// loginSession returns the LoginSession by its id, or a new LoginSession if it does not exist.
+func (s *Service) loginSession(ctx context.Context, sid string) (*LoginSession, error) {
+	if len(sid) > 0 {
+		loginSession, err := s.loginSessions.GetLoginSession(ctx, sid)
+		switch {
+		case err == nil:
+			return loginSession, nil
+		case !errors.Is(err, ErrLoginSessionNotFound):
+			return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+		}
+	}
+
+	return newLoginSession(s.props.LoginSessionLifespan), nil
+}
+
+// remember records the authentication in the LoginSession of the authorization session.
+func (s *Service) remember(ctx context.Context, session *Session, authentication *Authentication) error {
+	loginSession, err := s.loginSession(ctx, session.Sid)
+	if err != nil {
+		return err
+	}
+
+	loginSession.Remember(authentication)
+	session.Sid = loginSession.ID
+
+	if err = s.loginSessions.SaveLoginSession(ctx, loginSession); err != nil {
+		return fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	return nil
+}
+
+// participate records the client of the session as a participant of the LoginSession, so it is notified upon logout,
+// and returns the public sid of the LoginSession, or an empty sid if the LoginSession no longer exists.
+func (s *Service) participate(ctx context.Context, session *Session) (string, error) {
+	loginSession, err := s.loginSessions.GetLoginSession(ctx, session.Sid)
+	switch {
+	case errors.Is(err, ErrLoginSessionNotFound):
+		return "", nil
+	case err != nil:
+		return "", fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	loginSession.Participate(session.Request.ClientID, session.Authentication.Subject)
+
+	if err = s.loginSessions.SaveLoginSession(ctx, loginSession); err != nil {
+		return "", fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	return loginSession.Sid, nil
+}
+
+func (s *Service) provider(session *Session) providerv1connect.ProviderServiceClient {
+	return s.providers[session.ProviderKey]
+}
+
+func providerError(err error, step Step) error {
+	return fault.Wrap(ErrProvider,
+		ftag.With(spec.ErrKindServerError),
+		fmsg.With(fmt.Sprintf("provider %s: %s", step, err)),
+	)
+}
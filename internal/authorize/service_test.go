@@ -0,0 +1,727 @@
+//go:build unit
+
+package authorize_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Southclaws/fault"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/storage/memory"
+	"github.com/absurdlab/tigerd/internal/token"
+	"github.com/absurdlab/tigerd/internal/wellknown"
+	providerv1 "github.com/absurdlab/tigerd/proto/gen/go/proto/provider/v1"
+	"github.com/absurdlab/tigerd/proto/gen/go/proto/provider/v1/providerv1connect"
+	"github.com/bufbuild/connect-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestService_Authorize(t *testing.T) {
+	cases := []struct {
+		name     string
+		provider *testProvider
+		request  func(r *authorize.Request)
+		assert   func(t *testing.T, resp *authorize.Response, err error, codes token.CodeStore)
+	}{
+		{
+			name: "direct login and consent",
+			provider: &testProvider{
+				login:   loginResult("alice"),
+				consent: consentResult("openid"),
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error, codes token.CodeStore) {
+				if assert.NoError(t, err) {
+					assert.Equal(t, "https://foo.com/callback", resp.Target)
+					assert.Equal(t, "xyz", resp.Params["state"])
+
+					code, err := codes.RedeemCode(context.Background(), resp.Params["code"])
+					if assert.NoError(t, err) {
+						assert.Equal(t, "alice", code.Subject)
+						assert.Equal(t, []string{"openid"}, code.Scopes)
+						assert.Equal(t, "foo", code.ClientID)
+					}
+				}
+			},
+		},
+		{
+			name: "login redirection",
+			provider: &testProvider{
+				login: func(req *providerv1.LoginRequest) *providerv1.LoginResponse {
+					return &providerv1.LoginResponse{
+						ResultOrRedirect: &providerv1.LoginResponse_Redirection{
+							Redirection: &providerv1.Redirection{
+								Target: "https://provider.com/login",
+								Params: map[string]string{"session_id": req.GetSessionId()},
+								Mode:   providerv1.Redirection_MODE_FRAGMENT,
+							},
+						},
+					}
+				},
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error, codes token.CodeStore) {
+				if assert.NoError(t, err) {
+					assert.Equal(t, 302, resp.Status)
+					assert.Equal(t, spec.ResponseModeFragment, resp.Mode)
+
+					location, err := resp.Location()
+					if assert.NoError(t, err) {
+						assert.True(t, strings.HasPrefix(location, "https://provider.com/login#session_id="))
+					}
+				}
+			},
+		},
+		{
+			name: "no scope granted",
+			provider: &testProvider{
+				login:   loginResult("alice"),
+				consent: consentResult(),
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error, codes token.CodeStore) {
+				assert.Equal(t, spec.ErrKindAccessDenied, ftag.Get(err))
+			},
+		},
+		{
+			name:     "invalid request returned to client",
+			provider: &testProvider{},
+			request:  func(r *authorize.Request) { r.Scopes = nil },
+			assert: func(t *testing.T, resp *authorize.Response, err error, codes token.CodeStore) {
+				var redirectErr *authorize.RedirectError
+				if assert.ErrorAs(t, err, &redirectErr) {
+					assert.Equal(t, spec.ErrKindInvalidRequest, ftag.Get(err))
+
+					errResp, err := redirectErr.Response(context.Background(), map[string]string{"error": "invalid_request"})
+					require.NoError(t, err)
+
+					location, err := errResp.Location()
+					if assert.NoError(t, err) {
+						assert.Equal(t, "https://foo.com/callback?error=invalid_request&state=xyz", location)
+					}
+				}
+			},
+		},
+		{
+			name:     "error returned in requested response mode",
+			provider: &testProvider{},
+			request: func(r *authorize.Request) {
+				r.Scopes = nil
+				r.ResponseMode = spec.ResponseModeFragment
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error, codes token.CodeStore) {
+				var redirectErr *authorize.RedirectError
+				if assert.ErrorAs(t, err, &redirectErr) {
+					errResp, err := redirectErr.Response(context.Background(), map[string]string{"error": "invalid_request"})
+					require.NoError(t, err)
+
+					location, err := errResp.Location()
+					if assert.NoError(t, err) {
+						assert.Equal(t, "https://foo.com/callback#error=invalid_request&state=xyz", location)
+					}
+				}
+			},
+		},
+		{
+			name:     "unsupported response mode returned in default response mode",
+			provider: &testProvider{},
+			request:  func(r *authorize.Request) { r.ResponseMode = spec.ResponseModeQueryJWT },
+			assert: func(t *testing.T, resp *authorize.Response, err error, codes token.CodeStore) {
+				var redirectErr *authorize.RedirectError
+				if assert.ErrorAs(t, err, &redirectErr) {
+					assert.Equal(t, spec.ErrKindInvalidRequest, ftag.Get(err))
+
+					errResp, err := redirectErr.Response(context.Background(), map[string]string{"error": "invalid_request"})
+					require.NoError(t, err)
+					assert.Equal(t, spec.ResponseModeQuery, errResp.Mode)
+
+					location, err := errResp.Location()
+					if assert.NoError(t, err) {
+						assert.Equal(t, "https://foo.com/callback?error=invalid_request&state=xyz", location)
+					}
+				}
+			},
+		},
+		{
+			name: "code returned in requested response mode",
+			provider: &testProvider{
+				login:   loginResult("alice"),
+				consent: consentResult("openid"),
+			},
+			request: func(r *authorize.Request) { r.ResponseMode = spec.ResponseModeFragment },
+			assert: func(t *testing.T, resp *authorize.Response, err error, codes token.CodeStore) {
+				if assert.NoError(t, err) {
+					assert.Equal(t, spec.ResponseModeFragment, resp.Mode)
+				}
+			},
+		},
+		{
+			name: "login redirection in form post mode",
+			provider: &testProvider{
+				login: func(req *providerv1.LoginRequest) *providerv1.LoginResponse {
+					return &providerv1.LoginResponse{
+						ResultOrRedirect: &providerv1.LoginResponse_Redirection{
+							Redirection: &providerv1.Redirection{
+								Target: "https://provider.com/login",
+								Params: map[string]string{"session_id": req.GetSessionId()},
+								Mode:   providerv1.Redirection_MODE_FORM_POST,
+							},
+						},
+					}
+				},
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error, codes token.CodeStore) {
+				if assert.NoError(t, err) {
+					assert.Equal(t, spec.ResponseModeFormPost, resp.Mode)
+					assert.Equal(t, "https://provider.com/login", resp.Target)
+					assert.NotEmpty(t, resp.Params["session_id"])
+				}
+			},
+		},
+		{
+			name: "code returned in form post response mode",
+			provider: &testProvider{
+				login:   loginResult("alice"),
+				consent: consentResult("openid"),
+			},
+			request: func(r *authorize.Request) { r.ResponseMode = spec.ResponseModeFormPost },
+			assert: func(t *testing.T, resp *authorize.Response, err error, codes token.CodeStore) {
+				if assert.NoError(t, err) {
+					assert.Equal(t, spec.ResponseModeFormPost, resp.Mode)
+					assert.Equal(t, "https://foo.com/callback", resp.Target)
+					assert.Equal(t, "xyz", resp.Params["state"])
+					assert.NotEmpty(t, resp.Params["code"])
+				}
+			},
+		},
+		{
+			name:     "unknown client",
+			provider: &testProvider{},
+			request:  func(r *authorize.Request) { r.ClientID = "unknown" },
+			assert: func(t *testing.T, resp *authorize.Response, err error, codes token.CodeStore) {
+				assert.Equal(t, spec.ErrKindInvalidRequest, ftag.Get(err))
+			},
+		},
+		{
+			name:     "unregistered redirect uri",
+			provider: &testProvider{},
+			request:  func(r *authorize.Request) { r.RedirectURI = "https://evil.com/callback" },
+			assert: func(t *testing.T, resp *authorize.Response, err error, codes token.CodeStore) {
+				assert.Equal(t, spec.ErrKindInvalidRequest, ftag.Get(err))
+				assert.False(t, errors.As(err, new(*authorize.RedirectError)), "never redirect to unregistered uri")
+			},
+		},
+		{
+			name: "client information sent to provider",
+			provider: &testProvider{
+				login: func(req *providerv1.LoginRequest) *providerv1.LoginResponse {
+					if req.GetContext().GetClient().GetName() != "Foo" {
+						return &providerv1.LoginResponse{}
+					}
+					return loginResult("alice")(req)
+				},
+				consent: consentResult("openid"),
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error, codes token.CodeStore) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name:     "prompt none without authentication",
+			provider: &testProvider{},
+			request: func(r *authorize.Request) {
+				r.Prompt = spec.PromptSet(0).Add(spec.PromptNone)
+			},
+			assert: func(t *testing.T, resp *authorize.Response, err error, codes token.CodeStore) {
+				assert.Equal(t, spec.ErrKindLoginRequired, ftag.Get(err))
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			codes := memory.New(time.Minute)
+			service := newTestService(t, c.provider, codes)
+
+			req := &authorize.Request{
+				ResponseType: spec.ResponseTypeCode.ToSet(),
+				ClientID:     "foo",
+				RedirectURI:  "https://foo.com/callback",
+				Scopes:       []string{"openid"},
+				State:        "xyz",
+			}
+			if c.request != nil {
+				c.request(req)
+			}
+
+			resp, err := service.Authorize(context.Background(), req, "", "")
+			c.assert(t, resp, err, codes)
+		})
+	}
+}
+
+func TestService_Authorize_JWTResponseMode(t *testing.T) {
+	provider := &testProvider{
+		login:   loginResult("alice"),
+		consent: consentResult("openid"),
+	}
+
+	cases := []struct {
+		name    string
+		request *authorize.Request
+		decode  []jose.DecoderOpt
+		assert  func(t *testing.T, resp *authorize.Response, claims map[string]any)
+	}{
+		{
+			name: "signed code in default response mode",
+			request: &authorize.Request{
+				ResponseType: spec.ResponseTypeCode.ToSet(),
+				ResponseMode: spec.ResponseModeJWT,
+				ClientID:     "foo",
+				RedirectURI:  "https://foo.com/callback",
+				Scopes:       []string{"openid"},
+				State:        "xyz",
+			},
+			decode: []jose.DecoderOpt{jose.ExpectSignature(spec.RS256, serverKeys)},
+			assert: func(t *testing.T, resp *authorize.Response, claims map[string]any) {
+				assert.Equal(t, spec.ResponseModeQuery, resp.Mode)
+				assert.NotEmpty(t, claims["code"])
+				assert.Equal(t, "xyz", claims["state"])
+				assert.Equal(t, "https://tigerd.test", claims["iss"])
+				assert.Equal(t, "foo", claims["aud"])
+				assert.NotEmpty(t, claims["exp"])
+			},
+		},
+		{
+			name: "signed and encrypted code in form post",
+			request: &authorize.Request{
+				ResponseType: spec.ResponseTypeCode.ToSet(),
+				ResponseMode: spec.ResponseModeFormPostJWT,
+				ClientID:     "sealed",
+				RedirectURI:  "https://sealed.com/callback",
+				Scopes:       []string{"openid"},
+			},
+			decode: []jose.DecoderOpt{
+				jose.ExpectSignature(spec.RS256, serverKeys),
+				jose.ExpectEncryption(spec.RSA_OAEP_256, sealedKeys),
+			},
+			assert: func(t *testing.T, resp *authorize.Response, claims map[string]any) {
+				assert.Equal(t, spec.ResponseModeFormPost, resp.Mode)
+				assert.NotEmpty(t, claims["code"])
+				assert.Equal(t, "sealed", claims["aud"])
+			},
+		},
+		{
+			name: "signed error",
+			request: &authorize.Request{
+				ResponseType: spec.ResponseTypeCode.ToSet(),
+				ResponseMode: spec.ResponseModeFragmentJWT,
+				ClientID:     "foo",
+				RedirectURI:  "https://foo.com/callback",
+				State:        "xyz",
+			},
+			decode: []jose.DecoderOpt{jose.ExpectSignature(spec.RS256, serverKeys)},
+			assert: func(t *testing.T, resp *authorize.Response, claims map[string]any) {
+				assert.Equal(t, spec.ResponseModeFragment, resp.Mode)
+				assert.Equal(t, "invalid_request", claims["error"])
+				assert.Equal(t, "xyz", claims["state"])
+			},
+		},
+	}
+
+	service := newTestService(t, provider, memory.New(time.Minute))
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp, err := service.Authorize(context.Background(), c.request, "", "")
+
+			var redirectErr *authorize.RedirectError
+			if errors.As(err, &redirectErr) {
+				resp, err = redirectErr.Response(context.Background(), map[string]string{"error": "invalid_request"})
+			}
+			require.NoError(t, err)
+
+			if assert.Len(t, resp.Params, 1) {
+				var claims map[string]any
+				err = jose.Decode(resp.Params["response"], c.decode...).Into(&claims)
+				if assert.NoError(t, err) {
+					c.assert(t, resp, claims)
+				}
+			}
+		})
+	}
+}
+
+func TestService_Authorize_ResponseModesUnrestricted(t *testing.T) {
+	service := newTestService(t, &testProvider{}, memory.New(time.Minute), func(d *wellknown.Discovery) {
+		d.ResponseModesSupported = nil
+	})
+
+	_, err := service.Authorize(context.Background(), &authorize.Request{
+		ResponseType: spec.ResponseTypeCode.ToSet(),
+		ResponseMode: spec.ResponseModeQueryJWT,
+		ClientID:     "foo",
+		RedirectURI:  "https://foo.com/callback",
+		State:        "xyz",
+	}, "", "")
+
+	var redirectErr *authorize.RedirectError
+	require.ErrorAs(t, err, &redirectErr)
+	assert.Equal(t, spec.ErrKindInvalidRequest, ftag.Get(err))
+
+	resp, err := redirectErr.Response(context.Background(), map[string]string{"error": "invalid_request"})
+	require.NoError(t, err)
+	assert.Equal(t, spec.ResponseModeQuery, resp.Mode)
+	assert.Contains(t, resp.Params, "response", "error returned in the requested query.jwt response mode")
+}
+
+func TestService_Reject(t *testing.T) {
+	service := newTestService(t, &testProvider{}, memory.New(time.Minute))
+	cause := fault.Wrap(authorize.ErrRequest, ftag.With(spec.ErrKindInvalidRequest))
+
+	err := service.Reject(context.Background(), &authorize.Request{
+		ClientID:    "foo",
+		RedirectURI: "https://foo.com/callback",
+	}, cause)
+	assert.ErrorAs(t, err, new(*authorize.RedirectError))
+	assert.ErrorIs(t, err, authorize.ErrRequest)
+
+	err = service.Reject(context.Background(), &authorize.Request{
+		ClientID:    "foo",
+		RedirectURI: "https://evil.com/callback",
+	}, cause)
+	assert.False(t, errors.As(err, new(*authorize.RedirectError)))
+
+	err = service.Reject(context.Background(), nil, cause)
+	assert.Equal(t, spec.ErrKindInvalidRequest, ftag.Get(err))
+}
+
+func TestService_Authorize_SelectAccount(t *testing.T) {
+	var options []*providerv1.Authentication
+
+	provider := &testProvider{
+		login:   loginResult("alice"),
+		consent: consentResult("openid"),
+		selectAccount: func(req *providerv1.SelectAccountRequest) *providerv1.SelectAccountResponse {
+			options = req.GetOptions()
+			return &providerv1.SelectAccountResponse{
+				ResultOrRedirect: &providerv1.SelectAccountResponse_Result{
+					Result: &providerv1.SelectAccountResult{Selection: req.GetOptions()[0]},
+				},
+			}
+		},
+	}
+	service := newTestService(t, provider, memory.New(time.Minute))
+
+	req := func(prompt spec.Prompt) *authorize.Request {
+		return &authorize.Request{
+			ResponseType: spec.ResponseTypeCode.ToSet(),
+			ClientID:     "foo",
+			RedirectURI:  "https://foo.com/callback",
+			Scopes:       []string{"openid"},
+			Prompt:       spec.PromptSet(0).Add(prompt),
+		}
+	}
+
+	first, err := service.Authorize(context.Background(), req(spec.PromptLogin), "", "")
+	require.NoError(t, err)
+	require.NotEmpty(t, first.Sid)
+
+	_, err = service.Authorize(context.Background(), req(spec.PromptSelectAccount), first.Sid, "")
+	require.NoError(t, err)
+
+	if assert.Len(t, options, 1) {
+		assert.Equal(t, "alice", options[0].GetSubject())
+	}
+}
+
+func TestService_Authorize_Grant(t *testing.T) {
+	var (
+		consented [][]string
+		ephemeral bool
+	)
+
+	provider := &testProvider{
+		login: loginResult("alice"),
+		consent: func(req *providerv1.ConsentRequest) *providerv1.ConsentResponse {
+			consented = append(consented, req.GetScopes())
+			return &providerv1.ConsentResponse{
+				ResultOrRedirect: &providerv1.ConsentResponse_Result{
+					Result: &providerv1.ConsentResult{GrantedScopes: req.GetScopes(), Ephemeral: ephemeral},
+				},
+			}
+		},
+	}
+	store := memory.New(time.Minute)
+	service := newTestService(t, provider, store)
+
+	var sid string
+	authorizeScopes := func(prompt spec.PromptSet, scopes ...string) []string {
+		resp, err := service.Authorize(context.Background(), &authorize.Request{
+			ResponseType: spec.ResponseTypeCode.ToSet(),
+			ClientID:     "foo",
+			RedirectURI:  "https://foo.com/callback",
+			Scopes:       scopes,
+			Prompt:       prompt,
+		}, sid, "")
+		require.NoError(t, err)
+
+		sid = resp.Sid
+		code, err := store.RedeemCode(context.Background(), resp.Params["code"])
+		require.NoError(t, err)
+
+		return code.Scopes
+	}
+
+	scopes := authorizeScopes(0, "openid", "email")
+	assert.Equal(t, []string{"openid", "email"}, scopes)
+	assert.Equal(t, [][]string{{"openid", "email"}}, consented, "all scopes are new")
+
+	ephemeral = true
+	scopes = authorizeScopes(0, "openid", "email", "profile")
+	assert.Equal(t, []string{"openid", "email", "profile"}, scopes)
+	assert.Equal(t, []string{"profile"}, consented[1], "only new scopes are consented")
+
+	scopes = authorizeScopes(spec.PromptSet(0).Add(spec.PromptNone), "openid", "email")
+	assert.Equal(t, []string{"openid", "email"}, scopes)
+	assert.Len(t, consented, 2, "no consent when nothing is new")
+
+	scopes = authorizeScopes(spec.PromptSet(0).Add(spec.PromptConsent), "openid", "email")
+	assert.Equal(t, []string{"openid", "email"}, scopes)
+	assert.Equal(t, []string{"openid", "email"}, consented[2], "prompt=consent forces consent")
+
+	grant, err := store.GetGrant(context.Background(), "foo", "alice")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"openid", "email"}, grant.Scopes, "ephemeral grants are not saved")
+	}
+}
+
+func TestService_ReportLogin(t *testing.T) {
+	var sessionID string
+
+	provider := &testProvider{
+		login: func(req *providerv1.LoginRequest) *providerv1.LoginResponse {
+			sessionID = req.GetSessionId()
+			return &providerv1.LoginResponse{
+				ResultOrRedirect: &providerv1.LoginResponse_Redirection{
+					Redirection: &providerv1.Redirection{Target: "https://provider.com/login"},
+				},
+			}
+		},
+	}
+	service := newTestService(t, provider, memory.New(time.Minute))
+
+	_, err := service.Authorize(context.Background(), &authorize.Request{
+		ResponseType: spec.ResponseTypeCode.ToSet(),
+		ClientID:     "foo",
+		RedirectURI:  "https://foo.com/callback",
+		Scopes:       []string{"openid"},
+	}, "", "")
+	require.NoError(t, err)
+	require.NotEmpty(t, sessionID)
+
+	result := &providerv1.LoginResult{Authentication: &providerv1.Authentication{Subject: "alice"}}
+
+	err = service.ReportConsent(context.Background(), "test", sessionID, &providerv1.ConsentResult{})
+	assert.ErrorIs(t, err, authorize.ErrSessionState)
+
+	err = service.ReportLogin(context.Background(), "other", sessionID, result)
+	assert.ErrorIs(t, err, authorize.ErrSessionNotFound, "reported by another provider")
+
+	err = service.ReportLogin(context.Background(), "test", sessionID, result)
+	assert.NoError(t, err)
+
+	err = service.ReportLogin(context.Background(), "test", sessionID, result)
+	assert.ErrorIs(t, err, authorize.ErrSessionState)
+
+	err = service.ReportLogin(context.Background(), "test", "unknown", result)
+	assert.ErrorIs(t, err, authorize.ErrSessionNotFound)
+}
+
+func TestService_Resume(t *testing.T) {
+	var sessionID string
+
+	codes := memory.New(time.Minute)
+	provider := &testProvider{
+		login: func(req *providerv1.LoginRequest) *providerv1.LoginResponse {
+			sessionID = req.GetSessionId()
+			return &providerv1.LoginResponse{
+				ResultOrRedirect: &providerv1.LoginResponse_Redirection{
+					Redirection: &providerv1.Redirection{Target: "https://provider.com/login"},
+				},
+			}
+		},
+		consent: consentResult("openid"),
+	}
+	service := newTestService(t, provider, codes)
+
+	first, err := service.Authorize(context.Background(), &authorize.Request{
+		ResponseType: spec.ResponseTypeCode.ToSet(),
+		ClientID:     "foo",
+		RedirectURI:  "https://foo.com/callback",
+		Scopes:       []string{"openid"},
+		State:        "xyz",
+	}, "", "")
+	require.NoError(t, err)
+	require.Equal(t, "https://provider.com/login", first.Target)
+	require.NotEmpty(t, first.Binding)
+
+	_, err = service.Resume(context.Background(), sessionID, first.Binding)
+	assert.ErrorIs(t, err, authorize.ErrSessionState, "resumed before callback")
+	assert.Equal(t, spec.ErrKindInvalidRequest, ftag.Get(err))
+
+	err = service.ReportLogin(context.Background(), "test", sessionID, &providerv1.LoginResult{
+		Authentication: &providerv1.Authentication{Subject: "alice"},
+	})
+	require.NoError(t, err)
+
+	_, err = service.Resume(context.Background(), sessionID, "")
+	assert.ErrorIs(t, err, authorize.ErrSessionState, "resumed without binding")
+	_, err = service.Resume(context.Background(), sessionID, "other")
+	assert.ErrorIs(t, err, authorize.ErrSessionState, "resumed by another user agent")
+
+	resp, err := service.Resume(context.Background(), sessionID, first.Binding)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://foo.com/callback", resp.Target)
+		assert.Equal(t, "xyz", resp.Params["state"])
+		assert.NotEmpty(t, resp.Sid)
+
+		code, err := codes.RedeemCode(context.Background(), resp.Params["code"])
+		if assert.NoError(t, err) {
+			assert.Equal(t, "alice", code.Subject)
+
+			loginSession, err := codes.GetLoginSession(context.Background(), resp.Sid)
+			if assert.NoError(t, err) {
+				assert.Equal(t, loginSession.Sid, code.Sid)
+				assert.NotEqual(t, resp.Sid, code.Sid, "login session cookie is never disclosed")
+			}
+		}
+	}
+
+	_, err = service.Resume(context.Background(), sessionID, first.Binding)
+	assert.ErrorIs(t, err, authorize.ErrSessionNotFound, "resumed twice")
+	assert.Equal(t, spec.ErrKindInvalidRequest, ftag.Get(err))
+}
+
+var (
+	serverKeys = jose.NewJSONWebKeySet(
+		jose.GenerateSignatureKey("server", spec.RS256, 2048),
+		jose.GenerateEncryptionKey("server-enc", spec.RSA_OAEP_256, 2048),
+	)
+	sealedKeys = jose.NewJSONWebKeySet(jose.GenerateEncryptionKey("sealed", spec.RSA_OAEP_256, 2048))
+	signerKeys = jose.NewJSONWebKeySet(jose.GenerateSignatureKey("signer", spec.RS256, 2048))
+)
+
+func newTestService(t *testing.T, provider *testProvider, store *memory.Storage, hooks ...func(d *wellknown.Discovery)) *authorize.Service {
+	_, h := providerv1connect.NewProviderServiceHandler(provider)
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	clients, err := client.NewStaticRegistry([]*client.Client{
+		{
+			ID:           "foo",
+			Name:         "Foo",
+			RedirectURIs: []string{"https://foo.com/callback"},
+		},
+		{
+			ID:                                "sealed",
+			RedirectURIs:                      []string{"https://sealed.com/callback"},
+			JSONWebKeySet:                     sealedKeys.Public(),
+			AuthorizationEncryptedResponseAlg: spec.RSA_OAEP_256,
+		},
+		{
+			ID:                      "signer",
+			RedirectURIs:            []string{"https://signer.com/callback", "https://signer.com/other"},
+			JSONWebKeySet:           signerKeys.Public(),
+			RequestObjectSigningAlg: spec.RS256,
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	discovery := &wellknown.Discovery{
+		Issuer:                                    "https://tigerd.test",
+		RequestParameterSupported:                 true,
+		RequestObjectSigningAlgValuesSupported:    []spec.SignatureAlgorithm{spec.RS256, spec.HS256, spec.NoSignature},
+		RequestObjectEncryptionAlgValuesSupported: []spec.EncryptionAlgorithm{spec.RSA_OAEP_256},
+		RequestObjectEncryptionEncValuesSupported: []spec.EncryptionEncoding{spec.A128CBC_HS256},
+		ResponseModesSupported: []spec.ResponseMode{
+			spec.ResponseModeQuery,
+			spec.ResponseModeFragment,
+			spec.ResponseModeFormPost,
+			spec.ResponseModeJWT,
+			spec.ResponseModeFragmentJWT,
+			spec.ResponseModeFormPostJWT,
+		},
+	}
+	discovery.Apply(hooks...)
+
+	service, err := authorize.NewService(
+		&authorize.Properties{
+			SessionLifespan:      time.Minute,
+			LoginSessionLifespan: time.Hour,
+			CodeLifespan:         time.Minute,
+		},
+		[]*authorize.ProviderProperties{{Key: "test", Address: u.Host, Secret: "test-secret"}},
+		discovery,
+		serverKeys,
+		clients,
+		store,
+		store,
+		store,
+		store,
+	)
+	require.NoError(t, err)
+
+	return service
+}
+
+func loginResult(subject string) func(req *providerv1.LoginRequest) *providerv1.LoginResponse {
+	return func(req *providerv1.LoginRequest) *providerv1.LoginResponse {
+		return &providerv1.LoginResponse{
+			ResultOrRedirect: &providerv1.LoginResponse_Result{
+				Result: &providerv1.LoginResult{
+					Authentication: &providerv1.Authentication{Subject: subject},
+				},
+			},
+		}
+	}
+}
+
+func consentResult(scopes ...string) func(req *providerv1.ConsentRequest) *providerv1.ConsentResponse {
+	return func(req *providerv1.ConsentRequest) *providerv1.ConsentResponse {
+		return &providerv1.ConsentResponse{
+			ResultOrRedirect: &providerv1.ConsentResponse_Result{
+				Result: &providerv1.ConsentResult{GrantedScopes: scopes},
+			},
+		}
+	}
+}
+
+type testProvider struct {
+	providerv1connect.UnimplementedProviderServiceHandler
+	login         func(req *providerv1.LoginRequest) *providerv1.LoginResponse
+	selectAccount func(req *providerv1.SelectAccountRequest) *providerv1.SelectAccountResponse
+	consent       func(req *providerv1.ConsentRequest) *providerv1.ConsentResponse
+}
+
+func (p *testProvider) Login(_ context.Context, req *connect.Request[providerv1.LoginRequest]) (*connect.Response[providerv1.LoginResponse], error) {
+	return connect.NewResponse(p.login(req.Msg)), nil
+}
+
+func (p *testProvider) SelectAccount(_ context.Context, req *connect.Request[providerv1.SelectAccountRequest]) (*connect.Response[providerv1.SelectAccountResponse], error) {
+	return connect.NewResponse(p.selectAccount(req.Msg)), nil
+}
+
+func (p *testProvider) Consent(_ context.Context, req *connect.Request[providerv1.ConsentRequest]) (*connect.Response[providerv1.ConsentResponse], error) {
+	return connect.NewResponse(p.consent(req.Msg)), nil
+}
@@ -0,0 +1,260 @@
+package authorize
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/token"
+	providerv1 "github.com/absurdlab/tigerd/proto/gen/go/proto/provider/v1"
+	"github.com/oklog/ulid/v2"
+	"github.com/samber/lo"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+)
+
+var (
+	// ErrSessionNotFound is returned by SessionStore when the session does not exist or has expired.
+	ErrSessionNotFound = errors.New("authorization session not found")
+)
+
+const (
+	StepLogin Step = 1 << iota
+	StepSelectAccount
+	StepConsent
+
+	stepLogin         = "login"
+	stepSelectAccount = "select_account"
+	stepConsent       = "consent"
+)
+
+// Step is the End-User interaction step that an authorization session delegates to the provider.
+type Step uint8
+
+func (s Step) String() string {
+	switch s {
+	case StepLogin:
+		return stepLogin
+	case StepSelectAccount:
+		return stepSelectAccount
+	case StepConsent:
+		return stepConsent
+	default:
+		return ""
+	}
+}
+
+// Session is the state of an authorization request while it is walked through the provider interactions. It is
+// identified by the session_id exchanged with the provider.
+type Session struct {
+	ID string `json:"id"`
+	// Sid is the id of the LoginSession of the user agent that started this Session.
+	Sid string `json:"sid"`
+	// Binding is the secret bound by cookie to the user agent that started this Session, which must be presented to
+	// resume it.
+	Binding string `json:"binding"`
+	// ProviderKey is the key of the provider that End-User interactions are delegated to.
+	ProviderKey string   `json:"provider_key"`
+	Request     *Request `json:"request"`
+	// Step is the interaction step that was handed over to the provider with a redirection, if any.
+	Step Step `json:"step,omitempty"`
+	// Reported is true when the provider has reported the result of Step through the CallbackService.
+	Reported       bool            `json:"reported,omitempty"`
+	Authentication *Authentication `json:"authentication,omitempty"`
+	// PriorScopes are the requested scopes previously granted to the client, which are not consented again.
+	PriorScopes   []string     `json:"prior_scopes,omitempty"`
+	Consented     bool         `json:"consented,omitempty"`
+	GrantedScopes []string     `json:"granted_scopes,omitempty"`
+	Claims        token.Claims `json:"claims"`
+	CreatedAt     time.Time    `json:"created_at"`
+	ExpiresAt     time.Time    `json:"expires_at"`
+
+	// client is the registration of the requesting client, resolved by the Service whenever the session is loaded.
+	client *client.Client
+}
+
+func newSession(req *Request, providerKey string, sid string, binding string, lifespan time.Duration) *Session {
+	if len(binding) == 0 {
+		binding = newBinding()
+	}
+
+	now := time.Now()
+	return &Session{
+		ID:          ulid.Make().String(),
+		Sid:         sid,
+		Binding:     binding,
+		ProviderKey: providerKey,
+		Request:     req,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(lifespan),
+	}
+}
+
+// newBinding returns a url safe secret encoded from 32 bytes of cryptographic random data.
+func newBinding() string {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// IsExpired returns true if the Session can no longer be continued.
+func (s *Session) IsExpired() bool {
+	return time.Now().After(s.ExpiresAt)
+}
+
+// Claim consumes the result reported for Step, so that the Session is resumed only once per reported step. It returns
+// ErrSessionState if no result is reported.
+func (s *Session) Claim() error {
+	if s.Step == 0 || !s.Reported {
+		return ErrSessionState
+	}
+
+	s.Step = 0
+	s.Reported = false
+
+	return nil
+}
+
+func (s *Session) context() *providerv1.Context {
+	return &providerv1.Context{
+		Client:    s.client.Proto(),
+		Display:   s.Request.Display.String(),
+		UiLocales: s.Request.UILocales,
+		Claims:    claimsRequestProto(s.Request.Claims.Expand(s.Request.Scopes)),
+	}
+}
+
+func (s *Session) authenticated(authentication *Authentication, claims *providerv1.ClaimsResponse) {
+	s.Authentication = authentication
+	s.Claims.Merge(newClaims(claims))
+}
+
+func (s *Session) consented(result *providerv1.ConsentResult) {
+	s.Consented = true
+	s.GrantedScopes = lo.Intersect(s.Request.Scopes, lo.Union(s.PriorScopes, result.GetGrantedScopes()))
+	s.Claims.Merge(newClaims(result.GetClaims()))
+}
+
+// authorization returns the authorization issued by this Session, within the LoginSession publicly identified by sid.
+func (s *Session) authorization(sid string) token.Authorization {
+	return token.Authorization{
+		ClientID: s.Request.ClientID,
+		Subject:  s.Authentication.Subject,
+		Scopes:   s.GrantedScopes,
+		Sid:      sid,
+		Nonce:    s.Request.Nonce,
+		AuthTime: s.Authentication.AuthTime,
+		ACR:      s.Authentication.ACR,
+		AMR:      s.Authentication.AMR,
+		Claims:   s.Claims,
+
+		ClaimsRequest: s.Request.Claims,
+	}
+}
+
+// SessionStore persists authorization sessions.
+type SessionStore interface {
+	// SaveSession creates or replaces the session.
+	SaveSession(ctx context.Context, session *Session) error
+	// GetSession returns the session by its id, or ErrSessionNotFound if the session does not exist or has expired.
+	GetSession(ctx context.Context, id string) (*Session, error)
+	// ClaimSession atomically applies Session.Claim to the session and saves it, so that concurrent resumptions of the
+	// session cannot both succeed. It returns the claimed session, ErrSessionNotFound if the session does not exist or
+	// has expired, or ErrSessionState if the session has no reported result to claim.
+	ClaimSession(ctx context.Context, id string) (*Session, error)
+	// DeleteSession removes the session. Deleting a non-existing session is not an error.
+	DeleteSession(ctx context.Context, id string) error
+}
+
+// Authentication is the End-User authentication established by the provider.
+type Authentication struct {
+	ID       string    `json:"id"`
+	Subject  string    `json:"sub"`
+	AuthTime time.Time `json:"auth_time"`
+	Expiry   time.Time `json:"expiry"`
+	AMR      []string  `json:"amr,omitempty"`
+	ACR      string    `json:"acr,omitempty"`
+	AZP      string    `json:"azp,omitempty"`
+}
+
+func newAuthentication(a *providerv1.Authentication) *Authentication {
+	authentication := &Authentication{
+		ID:       a.GetId(),
+		Subject:  a.GetSubject(),
+		AuthTime: time.Now(),
+		AMR:      a.GetAmr(),
+		ACR:      a.GetAcr(),
+		AZP:      a.GetAzp(),
+	}
+	if len(authentication.ID) == 0 {
+		authentication.ID = ulid.Make().String()
+	}
+	if a.GetAuthTime() != nil {
+		authentication.AuthTime = a.GetAuthTime().AsTime()
+	}
+	if a.GetExpiry() != nil {
+		authentication.Expiry = a.GetExpiry().AsTime()
+	}
+	return authentication
+}
+
+// IsExpired returns true if the Authentication can no longer be used. Authentication without expiry lasts as long as
+// the LoginSession it belongs to.
+func (a *Authentication) IsExpired() bool {
+	return !a.Expiry.IsZero() && time.Now().After(a.Expiry)
+}
+
+func (a *Authentication) proto() *providerv1.Authentication {
+	authentication := &providerv1.Authentication{
+		Id:       a.ID,
+		Subject:  a.Subject,
+		AuthTime: timestamppb.New(a.AuthTime),
+		Amr:      a.AMR,
+		Acr:      a.ACR,
+		Azp:      a.AZP,
+	}
+	if !a.Expiry.IsZero() {
+		authentication.Expiry = timestamppb.New(a.Expiry)
+	}
+	return authentication
+}
+
+func claimsRequestProto(r *token.ClaimsRequest) *providerv1.ClaimsRequest {
+	options := func(claims map[string]*token.ClaimOption) map[string]*providerv1.ClaimOption {
+		result := make(map[string]*providerv1.ClaimOption, len(claims))
+		for name, option := range claims {
+			o := new(providerv1.ClaimOption)
+			if option != nil {
+				o.Essential = option.Essential
+				if option.Value != nil {
+					o.Values = append(o.Values, fmt.Sprint(option.Value))
+				}
+				for _, value := range option.Values {
+					o.Values = append(o.Values, fmt.Sprint(value))
+				}
+			}
+			result[name] = o
+		}
+		return result
+	}
+
+	return &providerv1.ClaimsRequest{
+		IdToken:  options(r.IDToken),
+		Userinfo: options(r.UserInfo),
+	}
+}
+
+func newClaims(claims *providerv1.ClaimsResponse) token.Claims {
+	var c token.Claims
+	if claims.GetIdToken() != nil {
+		c.IDToken = claims.GetIdToken().AsMap()
+	}
+	if claims.GetUserinfo() != nil {
+		c.UserInfo = claims.GetUserinfo().AsMap()
+	}
+	return c
+}
@@ -0,0 +1,240 @@
+package client
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"github.com/Southclaws/fault"
+	"github.com/Southclaws/fault/fmsg"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/wellknown"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/samber/lo"
+	"net/url"
+	"time"
+)
+
+var (
+	// ErrAuthentication is the root error returned when the client of a request cannot be authenticated.
+	ErrAuthentication = errors.New("client authentication failed")
+	// ErrAssertionReplayed is returned by AssertionStore when the client assertion has been used before.
+	ErrAssertionReplayed = errors.New("client assertion replayed")
+)
+
+const (
+	// AssertionTypeJWTBearer is the client_assertion_type of JWT client assertions defined in RFC 7523.
+	AssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+	// assertionLeeway is the clock skew tolerated when checking the time claims of client assertions.
+	assertionLeeway = time.Minute
+)
+
+// Credentials are the client authentication parameters presented in a request to the token, introspection or
+// revocation endpoint.
+type Credentials struct {
+	ClientID     string
+	ClientSecret string
+	Assertion    string
+	// Basic is true when ClientID and ClientSecret were presented with HTTP Basic authentication.
+	Basic bool
+}
+
+// ParseCredentials parses the client credentials from form parameters, and from HTTP Basic authentication when
+// basicID is not empty. The basicID and basicSecret must already be form url decoded as required by RFC 6749 Section
+// 2.3.1. Presenting more than one authentication method is an invalid_request.
+func ParseCredentials(values url.Values, basicID string, basicSecret string) (*Credentials, error) {
+	creds := &Credentials{
+		ClientID:     values.Get("client_id"),
+		ClientSecret: values.Get("client_secret"),
+		Assertion:    values.Get("client_assertion"),
+	}
+
+	if assertionType := values.Get("client_assertion_type"); len(assertionType) > 0 || len(creds.Assertion) > 0 {
+		if assertionType != AssertionTypeJWTBearer {
+			return nil, credentialsError("unsupported client_assertion_type", "The client_assertion_type is not supported.")
+		}
+		if len(creds.Assertion) == 0 {
+			return nil, credentialsError("missing client_assertion", "The client_assertion is required.")
+		}
+	}
+
+	if len(basicID) > 0 {
+		switch {
+		case len(creds.ClientSecret) > 0 || len(creds.Assertion) > 0:
+			return nil, credentialsError("multiple authentication methods", "The client must use only one authentication method.")
+		case len(creds.ClientID) > 0 && creds.ClientID != basicID:
+			return nil, credentialsError("client_id mismatch", "The client_id parameter does not match the authenticated client.")
+		}
+		creds.ClientID, creds.ClientSecret, creds.Basic = basicID, basicSecret, true
+	}
+
+	if len(creds.ClientSecret) > 0 && len(creds.Assertion) > 0 {
+		return nil, credentialsError("multiple authentication methods", "The client must use only one authentication method.")
+	}
+
+	return creds, nil
+}
+
+// method returns the authentication method family used by the Credentials. Both JWT methods are reported as
+// client_secret_jwt, as they are indistinguishable until the client is known.
+func (c *Credentials) method() spec.AuthenticationMethod {
+	switch {
+	case len(c.Assertion) > 0:
+		return spec.ClientSecretJWT
+	case c.Basic:
+		return spec.ClientSecretBasic
+	case len(c.ClientSecret) > 0:
+		return spec.ClientSecretPost
+	default:
+		return spec.NoAuthenticationMethod
+	}
+}
+
+// AssertionStore remembers the jti of client assertions to prevent replay.
+type AssertionStore interface {
+	// SaveAssertionID records the assertion id until expiresAt, or returns ErrAssertionReplayed if it is already
+	// recorded and not yet expired.
+	SaveAssertionID(ctx context.Context, id string, expiresAt time.Time) error
+}
+
+// NewAuthenticator creates an Authenticator which accepts client assertions audienced at the issuer or any endpoint
+// that requires client authentication.
+func NewAuthenticator(discovery *wellknown.Discovery, clients Registry, assertions AssertionStore) *Authenticator {
+	audiences := lo.Compact([]string{
+		discovery.Issuer,
+		discovery.TokenEndpoint,
+		discovery.IntrospectionEndpoint,
+		discovery.RevocationEndpoint,
+	})
+
+	return &Authenticator{
+		audiences:  audiences,
+		clients:    clients,
+		assertions: assertions,
+	}
+}
+
+// Authenticator authenticates clients with the token endpoint authentication method they registered.
+type Authenticator struct {
+	audiences  []string
+	clients    Registry
+	assertions AssertionStore
+}
+
+// Authenticate returns the Client identified by the Credentials, after verifying the Credentials against its
+// registered authentication method. Failures are reported as invalid_client.
+func (a *Authenticator) Authenticate(ctx context.Context, creds *Credentials) (*Client, error) {
+	clientID := creds.ClientID
+	if len(clientID) == 0 && len(creds.Assertion) > 0 {
+		clientID = assertionSubject(creds.Assertion)
+	}
+	if len(clientID) == 0 {
+		return nil, authenticationError("missing client_id")
+	}
+
+	c, err := a.clients.Find(ctx, clientID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return nil, authenticationError("client not found")
+	case err != nil:
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	registered, presented := c.AuthMethod(), creds.method()
+	if registered.RequiresSigning() {
+		registered = spec.ClientSecretJWT
+	}
+	if registered != presented {
+		return nil, authenticationError("authentication method mismatch")
+	}
+
+	switch presented {
+	case spec.ClientSecretBasic, spec.ClientSecretPost:
+		if subtle.ConstantTimeCompare([]byte(c.Secret), []byte(creds.ClientSecret)) != 1 {
+			return nil, authenticationError("client secret mismatch")
+		}
+	case spec.ClientSecretJWT:
+		if err := a.verifyAssertion(ctx, c, creds.Assertion); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// verifyAssertion verifies the signature and the claims of the client assertion as required by RFC 7523 Section 3,
+// and records its jti to reject replays.
+func (a *Authenticator) verifyAssertion(ctx context.Context, c *Client, assertion string) error {
+	var (
+		keys *jose.JSONWebKeySet
+		err  error
+	)
+	if c.AuthMethod() == spec.ClientSecretJWT {
+		keys = jose.NewJSONWebKeySet(&jose.JSONWebKey{
+			Key:       []byte(c.Secret),
+			Algorithm: c.AuthSigningAlg().String(),
+			Use:       jose.UseSig,
+		})
+	} else if keys, err = c.VerificationKeys(ctx, jose.KeyID(assertion)); err != nil {
+		return fault.Wrap(err,
+			ftag.With(spec.ErrKindInvalidClient),
+			fmsg.WithDesc("client keys unavailable", "Client authentication failed."),
+		)
+	}
+
+	claims := new(jwt.Claims)
+	if err := jose.Decode(assertion, jose.ExpectSignature(c.AuthSigningAlg(), keys)).Into(claims); err != nil {
+		return authenticationError("client assertion signature invalid")
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Expiry == nil:
+		return authenticationError("client assertion missing exp")
+	case len(claims.ID) == 0:
+		return authenticationError("client assertion missing jti")
+	case !lo.Some(claims.Audience, a.audiences):
+		return authenticationError("client assertion audience mismatch")
+	}
+
+	err = claims.ValidateWithLeeway(jwt.Expected{Issuer: c.ID, Subject: c.ID, Time: now}, assertionLeeway)
+	if err != nil {
+		return authenticationError("client assertion claims invalid: " + err.Error())
+	}
+
+	err = a.assertions.SaveAssertionID(ctx, c.ID+":"+claims.ID, claims.Expiry.Time().Add(assertionLeeway))
+	switch {
+	case errors.Is(err, ErrAssertionReplayed):
+		return authenticationError("client assertion replayed")
+	case err != nil:
+		return fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	return nil
+}
+
+// assertionSubject returns the unverified subject of the client assertion, which identifies the client when the
+// client_id parameter is omitted.
+func assertionSubject(assertion string) string {
+	claims := new(jwt.Claims)
+	if err := jose.Decode(assertion, jose.PeekOnly()).Into(claims); err != nil {
+		return ""
+	}
+	return claims.Subject
+}
+
+func credentialsError(message string, description string) error {
+	return fault.Wrap(ErrAuthentication,
+		ftag.With(spec.ErrKindInvalidRequest),
+		fmsg.WithDesc(message, description),
+	)
+}
+
+func authenticationError(message string) error {
+	return fault.Wrap(ErrAuthentication,
+		ftag.With(spec.ErrKindInvalidClient),
+		fmsg.WithDesc(message, "Client authentication failed."),
+	)
+}
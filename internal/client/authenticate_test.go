@@ -0,0 +1,265 @@
+//go:build unit
+
+package client_test
+
+import (
+	"context"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/storage/memory"
+	"github.com/absurdlab/tigerd/internal/wellknown"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseCredentials(t *testing.T) {
+	cases := []struct {
+		name   string
+		values map[string][]string
+		basic  [2]string
+		expect ftag.Kind
+		assert func(t *testing.T, creds *client.Credentials)
+	}{
+		{
+			name:  "basic",
+			basic: [2]string{"foo", "s3cret"},
+			assert: func(t *testing.T, creds *client.Credentials) {
+				assert.Equal(t, "foo", creds.ClientID)
+				assert.Equal(t, "s3cret", creds.ClientSecret)
+				assert.True(t, creds.Basic)
+			},
+		},
+		{
+			name:   "post",
+			values: map[string][]string{"client_id": {"foo"}, "client_secret": {"s3cret"}},
+			assert: func(t *testing.T, creds *client.Credentials) {
+				assert.Equal(t, "s3cret", creds.ClientSecret)
+				assert.False(t, creds.Basic)
+			},
+		},
+		{
+			name: "assertion",
+			values: map[string][]string{
+				"client_assertion_type": {client.AssertionTypeJWTBearer},
+				"client_assertion":      {"a.b.c"},
+			},
+			assert: func(t *testing.T, creds *client.Credentials) {
+				assert.Equal(t, "a.b.c", creds.Assertion)
+			},
+		},
+		{
+			name:   "basic and post",
+			values: map[string][]string{"client_secret": {"s3cret"}},
+			basic:  [2]string{"foo", "s3cret"},
+			expect: spec.ErrKindInvalidRequest,
+		},
+		{
+			name:   "basic with mismatched client_id",
+			values: map[string][]string{"client_id": {"bar"}},
+			basic:  [2]string{"foo", "s3cret"},
+			expect: spec.ErrKindInvalidRequest,
+		},
+		{
+			name: "unsupported assertion type",
+			values: map[string][]string{
+				"client_assertion_type": {"urn:foo"},
+				"client_assertion":      {"a.b.c"},
+			},
+			expect: spec.ErrKindInvalidRequest,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			creds, err := client.ParseCredentials(c.values, c.basic[0], c.basic[1])
+			if len(c.expect) > 0 {
+				assert.Equal(t, c.expect, ftag.Get(err))
+				return
+			}
+			if assert.NoError(t, err) {
+				c.assert(t, creds)
+			}
+		})
+	}
+}
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	const (
+		tokenEndpoint = "https://tigerd.test/oauth/token"
+		sharedSecret  = "a-shared-secret-long-enough-for-hs256"
+	)
+
+	privateKeys := jose.NewJSONWebKeySet(jose.GenerateSignatureKey("k1", spec.RS256, 2048))
+	otherKeys := jose.NewJSONWebKeySet(jose.GenerateSignatureKey("k1", spec.RS256, 2048))
+
+	registry, err := client.NewStaticRegistry([]*client.Client{
+		{ID: "basic", Secret: "s3cret", ApplicationType: spec.AppTypeMachine, GrantTypes: []spec.GrantType{spec.GrantTypeClientCredentials}},
+		{ID: "post", Secret: "s3cret", TokenEndpointAuthMethod: spec.ClientSecretPost, ApplicationType: spec.AppTypeMachine, GrantTypes: []spec.GrantType{spec.GrantTypeClientCredentials}},
+		{ID: "public", RedirectURIs: []string{"https://public.com/callback"}},
+		{ID: "hmac", Secret: sharedSecret, TokenEndpointAuthMethod: spec.ClientSecretJWT, ApplicationType: spec.AppTypeMachine, GrantTypes: []spec.GrantType{spec.GrantTypeClientCredentials}},
+		{ID: "signed", JSONWebKeySet: privateKeys.Public(), TokenEndpointAuthMethod: spec.PrivateKeyJWT, ApplicationType: spec.AppTypeMachine, GrantTypes: []spec.GrantType{spec.GrantTypeClientCredentials}},
+	}, nil)
+	require.NoError(t, err)
+
+	assertion := func(clientID string, alg spec.SignatureAlgorithm, keys *jose.JSONWebKeySet, hook func(claims *jose.StdClaims)) string {
+		claims := new(jose.StdClaims).
+			GenerateID().
+			WithIssuer(clientID).
+			WithSubject(clientID).
+			WithAudience(tokenEndpoint).
+			WithIssuedAtNow().
+			WithExpiryIn(time.Minute)
+		if hook != nil {
+			hook(claims)
+		}
+		token, err := jose.Encode(claims, jose.WithSignature(alg, keys))
+		require.NoError(t, err)
+		return token
+	}
+
+	hmacKeys := jose.NewJSONWebKeySet(&jose.JSONWebKey{
+		Key:       []byte(sharedSecret),
+		Algorithm: spec.HS256.String(),
+		Use:       jose.UseSig,
+	})
+
+	cases := []struct {
+		name   string
+		creds  func() *client.Credentials
+		expect ftag.Kind
+	}{
+		{
+			name: "client_secret_basic",
+			creds: func() *client.Credentials {
+				return &client.Credentials{ClientID: "basic", ClientSecret: "s3cret", Basic: true}
+			},
+		},
+		{
+			name: "client_secret_basic with wrong secret",
+			creds: func() *client.Credentials {
+				return &client.Credentials{ClientID: "basic", ClientSecret: "wrong", Basic: true}
+			},
+			expect: spec.ErrKindInvalidClient,
+		},
+		{
+			name:   "client_secret_basic presented as post",
+			creds:  func() *client.Credentials { return &client.Credentials{ClientID: "basic", ClientSecret: "s3cret"} },
+			expect: spec.ErrKindInvalidClient,
+		},
+		{
+			name:  "client_secret_post",
+			creds: func() *client.Credentials { return &client.Credentials{ClientID: "post", ClientSecret: "s3cret"} },
+		},
+		{
+			name:  "none",
+			creds: func() *client.Credentials { return &client.Credentials{ClientID: "public"} },
+		},
+		{
+			name:   "none with secret",
+			creds:  func() *client.Credentials { return &client.Credentials{ClientID: "public", ClientSecret: "s3cret"} },
+			expect: spec.ErrKindInvalidClient,
+		},
+		{
+			name:   "unknown client",
+			creds:  func() *client.Credentials { return &client.Credentials{ClientID: "unknown"} },
+			expect: spec.ErrKindInvalidClient,
+		},
+		{
+			name: "client_secret_jwt",
+			creds: func() *client.Credentials {
+				return &client.Credentials{Assertion: assertion("hmac", spec.HS256, hmacKeys, nil)}
+			},
+		},
+		{
+			name: "private_key_jwt",
+			creds: func() *client.Credentials {
+				return &client.Credentials{ClientID: "signed", Assertion: assertion("signed", spec.RS256, privateKeys, nil)}
+			},
+		},
+		{
+			name: "private_key_jwt signed by unknown key",
+			creds: func() *client.Credentials {
+				return &client.Credentials{ClientID: "signed", Assertion: assertion("signed", spec.RS256, otherKeys, nil)}
+			},
+			expect: spec.ErrKindInvalidClient,
+		},
+		{
+			name: "assertion for another client",
+			creds: func() *client.Credentials {
+				return &client.Credentials{ClientID: "signed", Assertion: assertion("other", spec.RS256, privateKeys, nil)}
+			},
+			expect: spec.ErrKindInvalidClient,
+		},
+		{
+			name: "assertion with wrong audience",
+			creds: func() *client.Credentials {
+				return &client.Credentials{Assertion: assertion("signed", spec.RS256, privateKeys, func(claims *jose.StdClaims) {
+					claims.Audience = []string{"https://elsewhere.test"}
+				})}
+			},
+			expect: spec.ErrKindInvalidClient,
+		},
+		{
+			name: "expired assertion",
+			creds: func() *client.Credentials {
+				return &client.Credentials{Assertion: assertion("signed", spec.RS256, privateKeys, func(claims *jose.StdClaims) {
+					claims.WithExpiry(time.Now().Add(-time.Hour))
+				})}
+			},
+			expect: spec.ErrKindInvalidClient,
+		},
+		{
+			name: "assertion without jti",
+			creds: func() *client.Credentials {
+				return &client.Credentials{Assertion: assertion("signed", spec.RS256, privateKeys, func(claims *jose.StdClaims) {
+					claims.WithID("")
+				})}
+			},
+			expect: spec.ErrKindInvalidClient,
+		},
+		{
+			name: "assertion for secret client",
+			creds: func() *client.Credentials {
+				return &client.Credentials{Assertion: assertion("basic", spec.RS256, privateKeys, nil)}
+			},
+			expect: spec.ErrKindInvalidClient,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			authenticator := client.NewAuthenticator(
+				&wellknown.Discovery{Issuer: "https://tigerd.test", TokenEndpoint: tokenEndpoint},
+				registry,
+				memory.New(time.Minute),
+			)
+
+			_, err := authenticator.Authenticate(context.Background(), c.creds())
+			if len(c.expect) > 0 {
+				assert.Equal(t, c.expect, ftag.Get(err))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("replayed assertion", func(t *testing.T) {
+		authenticator := client.NewAuthenticator(
+			&wellknown.Discovery{Issuer: "https://tigerd.test", TokenEndpoint: tokenEndpoint},
+			registry,
+			memory.New(time.Minute),
+		)
+
+		creds := &client.Credentials{Assertion: assertion("signed", spec.RS256, privateKeys, nil)}
+
+		_, err := authenticator.Authenticate(context.Background(), creds)
+		require.NoError(t, err)
+
+		_, err = authenticator.Authenticate(context.Background(), creds)
+		assert.Equal(t, spec.ErrKindInvalidClient, ftag.Get(err))
+	})
+}
@@ -0,0 +1,310 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/should"
+	"github.com/absurdlab/tigerd/internal/spec"
+	providerv1 "github.com/absurdlab/tigerd/proto/gen/go/proto/provider/v1"
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned by Registry when the client does not exist.
+	ErrNotFound = errors.New("client not found")
+)
+
+// Client is the registered metadata of an OAuth 2.0 client. Field names follow the client metadata defined in
+// OAuth 2.0 Dynamic Client Registration (RFC 7591) and OpenID Connect Dynamic Client Registration 1.0.
+type Client struct {
+	ID                           string                    `json:"client_id"`
+	Secret                       string                    `json:"client_secret,omitempty"`
+	Name                         string                    `json:"client_name,omitempty"`
+	Contacts                     []string                  `json:"contacts,omitempty"`
+	LogoURI                      string                    `json:"logo_uri,omitempty"`
+	ClientURI                    string                    `json:"client_uri,omitempty"`
+	PolicyURI                    string                    `json:"policy_uri,omitempty"`
+	TosURI                       string                    `json:"tos_uri,omitempty"`
+	ApplicationType              spec.ApplicationType      `json:"application_type,omitempty"`
+	RedirectURIs                 []string                  `json:"redirect_uris,omitempty"`
+	ResponseTypes                []spec.ResponseTypeSet    `json:"response_types,omitempty"`
+	GrantTypes                   []spec.GrantType          `json:"grant_types,omitempty"`
+	Scope                        string                    `json:"scope,omitempty"`
+	TokenEndpointAuthMethod      spec.AuthenticationMethod `json:"token_endpoint_auth_method,omitempty"`
+	TokenEndpointAuthSigningAlg  spec.SignatureAlgorithm   `json:"token_endpoint_auth_signing_alg,omitempty"`
+	JSONWebKeySetURI             string                    `json:"jwks_uri,omitempty"`
+	JSONWebKeySet                *jose.JSONWebKeySet       `json:"jwks,omitempty"`
+	IDTokenSignedResponseAlg     spec.SignatureAlgorithm   `json:"id_token_signed_response_alg,omitempty"`
+	IDTokenEncryptedResponseAlg  spec.EncryptionAlgorithm  `json:"id_token_encrypted_response_alg,omitempty"`
+	IDTokenEncryptedResponseEnc  spec.EncryptionEncoding   `json:"id_token_encrypted_response_enc,omitempty"`
+	UserInfoSignedResponseAlg    spec.SignatureAlgorithm   `json:"userinfo_signed_response_alg,omitempty"`
+	UserInfoEncryptedResponseAlg spec.EncryptionAlgorithm  `json:"userinfo_encrypted_response_alg,omitempty"`
+	UserInfoEncryptedResponseEnc spec.EncryptionEncoding   `json:"userinfo_encrypted_response_enc,omitempty"`
+	// AuthorizationSignedResponseAlg, AuthorizationEncryptedResponseAlg and AuthorizationEncryptedResponseEnc secure
+	// the authorization responses in JWT response modes, as defined in JWT Secured Authorization Response Mode for
+	// OAuth 2.0 (JARM) Section 3.
+	AuthorizationSignedResponseAlg    spec.SignatureAlgorithm  `json:"authorization_signed_response_alg,omitempty"`
+	AuthorizationEncryptedResponseAlg spec.EncryptionAlgorithm `json:"authorization_encrypted_response_alg,omitempty"`
+	AuthorizationEncryptedResponseEnc spec.EncryptionEncoding  `json:"authorization_encrypted_response_enc,omitempty"`
+	RequestObjectSigningAlg           spec.SignatureAlgorithm  `json:"request_object_signing_alg,omitempty"`
+	RequestObjectEncryptionAlg        spec.EncryptionAlgorithm `json:"request_object_encryption_alg,omitempty"`
+	RequestObjectEncryptionEnc        spec.EncryptionEncoding  `json:"request_object_encryption_enc,omitempty"`
+	PostLogoutRedirectURIs            []string                 `json:"post_logout_redirect_uris,omitempty"`
+	BackChannelLogoutURI              string                   `json:"backchannel_logout_uri,omitempty"`
+	// BackChannelLogoutSessionRequired is true when the client requires the sid claim in logout tokens.
+	BackChannelLogoutSessionRequired bool   `json:"backchannel_logout_session_required,omitempty"`
+	FrontChannelLogoutURI            string `json:"frontchannel_logout_uri,omitempty"`
+	// FrontChannelLogoutSessionRequired is true when the client requires the iss and sid query parameters in the
+	// front-channel logout uri.
+	FrontChannelLogoutSessionRequired bool `json:"frontchannel_logout_session_required,omitempty"`
+	// ProviderKey is the key of the provider handling End-User interactions for this client. When empty, the first
+	// configured provider is used. This is a tigerd extension.
+	ProviderKey string `json:"provider_key,omitempty"`
+	// AccessTokenLifetime is the lifetime in seconds of access tokens issued to this client, overriding the server
+	// default when positive. This is a tigerd extension.
+	AccessTokenLifetime int64 `json:"access_token_lifetime,omitempty"`
+	// Introspection is true when the client is a protected resource allowed to introspect the tokens issued to any
+	// client, rather than only its own. This is a tigerd extension.
+	Introspection bool `json:"introspection,omitempty"`
+
+	// dynamic is true when the Client was dynamically registered rather than configured, which restricts where its
+	// jwks_uri may be fetched from. It is set by the Registry.
+	dynamic bool
+	// keys fetches the key set registered as jwks_uri. It is set by the Registry.
+	keys *KeyFetcher
+}
+
+// IsDynamic returns true if the Client was dynamically registered, hence the uris it registered must only be called
+// with a http.Client from NewHTTPClient refusing non-public addresses.
+func (c *Client) IsDynamic() bool {
+	return c.dynamic
+}
+
+// UnmarshalYAML decodes the Client from yaml with the same field names as its JSON representation.
+func (c *Client) UnmarshalYAML(node *yaml.Node) error {
+	var fields map[string]any
+	if err := node.Decode(&fields); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	type client Client
+	return json.Unmarshal(raw, (*client)(c))
+}
+
+// Validate performs validation to this Client.
+func (c *Client) Validate() error {
+	var (
+		method    = c.AuthMethod()
+		interacts = c.AllowsGrantType(spec.GrantTypeAuthorizationCode) || c.AllowsGrantType(spec.GrantTypeImplicit)
+		encrypts  = !c.IDTokenEncryptedResponseAlg.IsNoneOrEmpty()
+		sealsInfo = !c.UserInfoEncryptedResponseAlg.IsNoneOrEmpty()
+		sealsAuth = !c.AuthorizationEncryptedResponseAlg.IsNoneOrEmpty()
+		usesKeys  = method == spec.PrivateKeyJWT || encrypts || sealsInfo || sealsAuth
+		noSecret  = method == spec.NoAuthenticationMethod || method == spec.PrivateKeyJWT
+		infoURL   = should.URL().Http().Https()
+	)
+
+	return v.Errors{
+		"client_id": v.Validate(c.ID, v.Required),
+		"client_secret": v.Validate(c.Secret,
+			v.When(!noSecret, v.Required),
+			v.When(noSecret, v.Empty),
+		),
+		"logo_uri":   v.Validate(c.LogoURI, infoURL),
+		"client_uri": v.Validate(c.ClientURI, infoURL),
+		"policy_uri": v.Validate(c.PolicyURI, infoURL),
+		"tos_uri":    v.Validate(c.TosURI, infoURL),
+		"redirect_uris": v.Validate(c.RedirectURIs,
+			v.When(interacts, v.Required),
+			v.Each(v.By(should.AbsoluteURL), c.redirectURIRule()),
+		),
+		"post_logout_redirect_uris": v.Validate(c.PostLogoutRedirectURIs,
+			v.Each(v.By(should.AbsoluteURL), c.redirectURIRule()),
+		),
+		"backchannel_logout_uri": v.Validate(c.BackChannelLogoutURI,
+			v.By(should.AbsoluteURL),
+			should.URL().Http().Https().NoFragment(),
+		),
+		"backchannel_logout_session_required": v.Validate(c.BackChannelLogoutSessionRequired,
+			v.When(len(c.BackChannelLogoutURI) == 0, v.Empty.Error("requires backchannel_logout_uri")),
+		),
+		"frontchannel_logout_uri": v.Validate(c.FrontChannelLogoutURI,
+			v.By(should.AbsoluteURL),
+			should.URL().Http().Https().NoFragment(),
+		),
+		"frontchannel_logout_session_required": v.Validate(c.FrontChannelLogoutSessionRequired,
+			v.When(len(c.FrontChannelLogoutURI) == 0, v.Empty.Error("requires frontchannel_logout_uri")),
+		),
+		"response_types": v.Validate(c.ResponseTypes, v.By(func(_ any) error {
+			return c.checkResponseTypes()
+		})),
+		"grant_types": v.Validate(c.GrantTypes, v.By(func(_ any) error {
+			if c.AllowsGrantType(spec.GrantTypeClientCredentials) && method == spec.NoAuthenticationMethod {
+				return errors.New("client_credentials requires a confidential client")
+			}
+			return nil
+		})),
+		"token_endpoint_auth_signing_alg": v.Validate(c.TokenEndpointAuthSigningAlg,
+			v.When(!method.RequiresSigning(), v.Empty.Error("requires client_secret_jwt or private_key_jwt")),
+			v.When(method == spec.ClientSecretJWT, v.In(spec.HS256, spec.HS384, spec.HS512).Error("must be a HMAC algorithm")),
+			v.When(method == spec.PrivateKeyJWT, v.NotIn(spec.NoSignature, spec.HS256, spec.HS384, spec.HS512).Error("must be an asymmetric algorithm")),
+		),
+		"jwks_uri": v.Validate(c.JSONWebKeySetURI,
+			should.URL().Https(),
+			v.When(c.JSONWebKeySet != nil, v.Empty.Error("cannot be used together with jwks")),
+		),
+		"jwks": v.Validate(c.JSONWebKeySet,
+			v.When(usesKeys && len(c.JSONWebKeySetURI) == 0, v.Required),
+		),
+		"id_token_signed_response_alg": v.Validate(c.IDTokenSignedResponseAlg, v.By(func(_ any) error {
+			if c.IDTokenSignedResponseAlg == spec.NoSignature && !encrypts {
+				return errors.New("unsigned id_token must be encrypted")
+			}
+			return nil
+		})),
+		"id_token_encrypted_response_enc": v.Validate(c.IDTokenEncryptedResponseEnc,
+			v.When(!encrypts, v.Empty.Error("requires id_token_encrypted_response_alg")),
+		),
+		"userinfo_encrypted_response_enc": v.Validate(c.UserInfoEncryptedResponseEnc,
+			v.When(!sealsInfo, v.Empty.Error("requires userinfo_encrypted_response_alg")),
+		),
+		"authorization_signed_response_alg": v.Validate(c.AuthorizationSignedResponseAlg,
+			v.NotIn(spec.NoSignature).Error("must not be none"),
+		),
+		"authorization_encrypted_response_enc": v.Validate(c.AuthorizationEncryptedResponseEnc,
+			v.When(!sealsAuth, v.Empty.Error("requires authorization_encrypted_response_alg")),
+		),
+		"request_object_encryption_enc": v.Validate(c.RequestObjectEncryptionEnc,
+			v.When(c.RequestObjectEncryptionAlg.IsNoneOrEmpty(), v.Empty.Error("requires request_object_encryption_alg")),
+		),
+		"access_token_lifetime": v.Validate(c.AccessTokenLifetime, v.Min(int64(0))),
+	}.Filter()
+}
+
+// redirectURIRule returns the validation rule for each redirect uri according to the ApplicationType: native clients
+// use custom schemes or loopback http urls, other clients use web urls.
+func (c *Client) redirectURIRule() v.Rule {
+	if c.ApplicationType != spec.AppTypeNative {
+		return should.URL().Http().Https().NoFragment()
+	}
+
+	return v.By(func(value any) error {
+		raw, _ := value.(string)
+		if strings.HasPrefix(strings.ToLower(raw), "http:") {
+			return should.URL().Http().LocalhostOnly().NoFragment().Validate(raw)
+		}
+		return should.URL().CustomScheme().NoFragment().Validate(raw)
+	})
+}
+
+// checkResponseTypes checks the registered response types are consistent with the registered grant types, as
+// required by RFC 7591 Section 2.1.
+func (c *Client) checkResponseTypes() error {
+	for _, each := range c.ResponseTypes {
+		if each.Contains(spec.ResponseTypeCode) && !c.AllowsGrantType(spec.GrantTypeAuthorizationCode) {
+			return errors.New("code response type requires authorization_code grant type")
+		}
+		if (each.Contains(spec.ResponseTypeToken) || each.Contains(spec.ResponseTypeIDToken)) &&
+			!c.AllowsGrantType(spec.GrantTypeImplicit) {
+			return errors.New("token and id_token response types require implicit grant type")
+		}
+	}
+	return nil
+}
+
+// AuthMethod returns the registered token endpoint authentication method. When not registered, clients with a
+// secret default to client_secret_basic as defined in RFC 7591, and clients without one default to none.
+func (c *Client) AuthMethod() spec.AuthenticationMethod {
+	switch {
+	case c.TokenEndpointAuthMethod != 0:
+		return c.TokenEndpointAuthMethod
+	case len(c.Secret) > 0:
+		return spec.ClientSecretBasic
+	default:
+		return spec.NoAuthenticationMethod
+	}
+}
+
+// AuthSigningAlg returns the algorithm the Client signs its authentication assertions with. When not registered,
+// client_secret_jwt defaults to HS256, and private_key_jwt defaults to RS256.
+func (c *Client) AuthSigningAlg() spec.SignatureAlgorithm {
+	switch {
+	case c.TokenEndpointAuthSigningAlg != 0:
+		return c.TokenEndpointAuthSigningAlg
+	case c.AuthMethod() == spec.ClientSecretJWT:
+		return spec.HS256
+	default:
+		return spec.RS256
+	}
+}
+
+// IsConfidential returns true if the Client is capable of maintaining the confidentiality of its credentials.
+func (c *Client) IsConfidential() bool {
+	return c.AuthMethod() != spec.NoAuthenticationMethod
+}
+
+// AllowsGrantType returns true if the Client is registered to use the grant type. When no grant type is registered,
+// the Client is assumed to use authorization_code only, as defined in RFC 7591.
+func (c *Client) AllowsGrantType(grantType spec.GrantType) bool {
+	if len(c.GrantTypes) == 0 {
+		return grantType == spec.GrantTypeAuthorizationCode
+	}
+	return lo.Contains(c.GrantTypes, grantType)
+}
+
+// AllowsResponseType returns true if the Client is registered to use the response type. When no response type is
+// registered, the Client is assumed to use code only, as defined in RFC 7591.
+func (c *Client) AllowsResponseType(responseType spec.ResponseTypeSet) bool {
+	if len(c.ResponseTypes) == 0 {
+		return responseType == spec.ResponseTypeCode.ToSet()
+	}
+	return lo.Contains(c.ResponseTypes, responseType)
+}
+
+// AllowsRedirectURI returns true if the redirect uri exactly matches one of the registered redirect uris.
+func (c *Client) AllowsRedirectURI(redirectURI string) bool {
+	return lo.Contains(c.RedirectURIs, redirectURI)
+}
+
+// AllowsPostLogoutRedirectURI returns true if the post logout redirect uri exactly matches one of the registered post
+// logout redirect uris.
+func (c *Client) AllowsPostLogoutRedirectURI(redirectURI string) bool {
+	return lo.Contains(c.PostLogoutRedirectURIs, redirectURI)
+}
+
+// Scopes returns the scopes the Client is registered for.
+func (c *Client) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// AccessTokenLifespan returns the lifespan of access tokens issued to the Client, or the defaultLifespan if the
+// Client does not specify its own.
+func (c *Client) AccessTokenLifespan(defaultLifespan time.Duration) time.Duration {
+	if c.AccessTokenLifetime > 0 {
+		return time.Duration(c.AccessTokenLifetime) * time.Second
+	}
+	return defaultLifespan
+}
+
+// Proto returns the Client information shared with providers.
+func (c *Client) Proto() *providerv1.Client {
+	return &providerv1.Client{
+		Id:        c.ID,
+		Name:      c.Name,
+		Contacts:  c.Contacts,
+		LogoUri:   c.LogoURI,
+		ClientUri: c.ClientURI,
+		PolicyUri: c.PolicyURI,
+		TosUri:    c.TosURI,
+	}
+}
@@ -0,0 +1,173 @@
+//go:build unit
+
+package client_test
+
+import (
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+	"testing"
+	"time"
+)
+
+func TestClient_UnmarshalYAML(t *testing.T) {
+	var clients []*client.Client
+	err := yaml.Unmarshal([]byte(`
+- client_id: machine
+  client_secret: s3cret
+  application_type: machine
+  grant_types:
+    - client_credentials
+  scope: read write
+  access_token_lifetime: 300
+`), &clients)
+	require.NoError(t, err)
+	require.Len(t, clients, 1)
+
+	c := clients[0]
+	assert.NoError(t, c.Validate())
+	assert.Equal(t, "machine", c.ID)
+	assert.Equal(t, spec.AppTypeMachine, c.ApplicationType)
+	assert.True(t, c.IsConfidential())
+	assert.True(t, c.AllowsGrantType(spec.GrantTypeClientCredentials))
+	assert.False(t, c.AllowsGrantType(spec.GrantTypeAuthorizationCode))
+	assert.Equal(t, []string{"read", "write"}, c.Scopes())
+	assert.Equal(t, 5*time.Minute, c.AccessTokenLifespan(time.Hour))
+}
+
+func TestClient_Validate(t *testing.T) {
+	gold := func() *client.Client {
+		return &client.Client{
+			ID:              "foo",
+			Secret:          "s3cret",
+			ApplicationType: spec.AppTypeWeb,
+			RedirectURIs:    []string{"https://foo.com/callback"},
+			ResponseTypes:   []spec.ResponseTypeSet{spec.ResponseTypeCode.ToSet()},
+			GrantTypes:      []spec.GrantType{spec.GrantTypeAuthorizationCode, spec.GrantTypeRefreshToken},
+			LogoURI:         "https://foo.com/logo.png",
+		}
+	}
+
+	cases := []struct {
+		name    string
+		hook    func(c *client.Client)
+		invalid bool
+	}{
+		{name: "gold", hook: func(c *client.Client) {}},
+		{
+			name: "native custom scheme",
+			hook: func(c *client.Client) {
+				c.ApplicationType = spec.AppTypeNative
+				c.RedirectURIs = []string{"com.foo.app:/callback", "http://127.0.0.1:8080/callback"}
+			},
+		},
+		{
+			name: "native non-loopback http",
+			hook: func(c *client.Client) {
+				c.ApplicationType = spec.AppTypeNative
+				c.RedirectURIs = []string{"http://foo.com/callback"}
+			},
+			invalid: true,
+		},
+		{name: "missing redirect uris", hook: func(c *client.Client) { c.RedirectURIs = nil }, invalid: true},
+		{name: "relative redirect uri", hook: func(c *client.Client) { c.RedirectURIs = []string{"/callback"} }, invalid: true},
+		{name: "redirect uri with fragment", hook: func(c *client.Client) { c.RedirectURIs = []string{"https://foo.com/cb#x"} }, invalid: true},
+		{name: "invalid logo uri", hook: func(c *client.Client) { c.LogoURI = "ftp://foo.com/logo.png" }, invalid: true},
+		{name: "auth signing alg without jwt method", hook: func(c *client.Client) { c.TokenEndpointAuthSigningAlg = spec.HS256 }, invalid: true},
+		{
+			name: "asymmetric alg for client_secret_jwt",
+			hook: func(c *client.Client) {
+				c.TokenEndpointAuthMethod = spec.ClientSecretJWT
+				c.TokenEndpointAuthSigningAlg = spec.RS256
+			},
+			invalid: true,
+		},
+		{
+			name: "response type without grant type",
+			hook: func(c *client.Client) {
+				c.ResponseTypes = append(c.ResponseTypes, spec.ResponseTypeToken.ToSet())
+			},
+			invalid: true,
+		},
+		{
+			name:    "secret method without secret",
+			hook:    func(c *client.Client) { c.Secret = ""; c.TokenEndpointAuthMethod = spec.ClientSecretPost },
+			invalid: true,
+		},
+		{
+			name:    "none method with secret",
+			hook:    func(c *client.Client) { c.TokenEndpointAuthMethod = spec.NoAuthenticationMethod },
+			invalid: true,
+		},
+		{
+			name:    "private key jwt without keys",
+			hook:    func(c *client.Client) { c.Secret = ""; c.TokenEndpointAuthMethod = spec.PrivateKeyJWT },
+			invalid: true,
+		},
+		{
+			name:    "id_token encryption without keys",
+			hook:    func(c *client.Client) { c.IDTokenEncryptedResponseAlg = spec.RSA_OAEP_256 },
+			invalid: true,
+		},
+		{
+			name:    "id_token encryption encoding without algorithm",
+			hook:    func(c *client.Client) { c.IDTokenEncryptedResponseEnc = spec.A256GCM },
+			invalid: true,
+		},
+		{
+			name:    "unsigned id_token without encryption",
+			hook:    func(c *client.Client) { c.IDTokenSignedResponseAlg = spec.NoSignature },
+			invalid: true,
+		},
+		{
+			name:    "unsigned authorization response",
+			hook:    func(c *client.Client) { c.AuthorizationSignedResponseAlg = spec.NoSignature },
+			invalid: true,
+		},
+		{
+			name:    "authorization response encryption without keys",
+			hook:    func(c *client.Client) { c.AuthorizationEncryptedResponseAlg = spec.RSA_OAEP_256 },
+			invalid: true,
+		},
+		{
+			name:    "authorization response encryption encoding without algorithm",
+			hook:    func(c *client.Client) { c.AuthorizationEncryptedResponseEnc = spec.A256GCM },
+			invalid: true,
+		},
+		{
+			name:    "request object encryption encoding without algorithm",
+			hook:    func(c *client.Client) { c.RequestObjectEncryptionEnc = spec.A256GCM },
+			invalid: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cl := gold()
+			c.hook(cl)
+
+			if c.invalid {
+				assert.Error(t, cl.Validate())
+			} else {
+				assert.NoError(t, cl.Validate())
+			}
+		})
+	}
+}
+
+func TestNewStaticRegistry(t *testing.T) {
+	_, err := client.NewStaticRegistry([]*client.Client{
+		{ID: "foo", RedirectURIs: []string{"https://foo.com/callback"}},
+		{ID: "foo", RedirectURIs: []string{"https://foo.com/callback"}},
+	}, nil)
+	assert.Error(t, err, "duplicate client_id")
+
+	_, err = client.NewStaticRegistry([]*client.Client{{
+		ID:              "foo",
+		ApplicationType: spec.AppTypeMachine,
+		GrantTypes:      []spec.GrantType{spec.GrantTypeClientCredentials},
+	}}, nil)
+	assert.Error(t, err, "client_credentials without secret")
+}
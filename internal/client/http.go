@@ -0,0 +1,59 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+var (
+	// errNonPublicAddress is returned when a uri registered by a dynamically registered Client resolves to an address
+	// which is not publicly routable.
+	errNonPublicAddress = errors.New("address is not publicly routable")
+)
+
+// NewHTTPClient returns a http.Client to call the uris registered by clients, such as jwks_uri or
+// backchannel_logout_uri, with the timeout for every request including redirects and reading the body. When
+// publicOnly is true, the http.Client refuses to connect to loopback, private or otherwise non-public addresses, so
+// that dynamically registered clients cannot have the server probe its internal network. It also ignores proxy
+// settings, as the proxy address would be checked instead of the target.
+func NewHTTPClient(timeout time.Duration, publicOnly bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if publicOnly {
+		dialer := &net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+			Control:   publicAddressOnly,
+		}
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+	}
+
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// publicAddressOnly is a net.Dialer control function which refuses to connect to addresses that are not publicly
+// routable. It runs after name resolution, hence also covers host names resolving to such addresses.
+func publicAddressOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil ||
+		ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() {
+		return fmt.Errorf("%s: %w", host, errNonPublicAddress)
+	}
+
+	return nil
+}
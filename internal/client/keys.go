@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/absurdlab/tigerd/internal/jose"
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// keysMaxSize bounds the size of the key set read from the jwks_uri of a Client.
+	keysMaxSize = 1 << 20
+	// keysRefetchInterval is the minimum age of a cached key set before it is fetched again for an unknown kid, so
+	// that tokens with made up kid values cannot have the server hammer the jwks_uri.
+	keysRefetchInterval = 30 * time.Second
+)
+
+// KeysProperties is the configuration properties for fetching the key sets registered by jwks_uri.
+type KeysProperties struct {
+	// Timeout is the maximum duration of fetching a key set.
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+	// CacheTTL is the duration a fetched key set is reused before it is fetched again.
+	CacheTTL time.Duration `json:"cache_ttl" yaml:"cache_ttl"`
+}
+
+// Validate performs validation to this KeysProperties.
+func (p *KeysProperties) Validate() error {
+	return v.Errors{
+		"timeout":   v.Validate(p.Timeout, v.Required),
+		"cache_ttl": v.Validate(p.CacheTTL, v.Required),
+	}.Filter()
+}
+
+// JSONWebKeys returns the public keys of the Client, either registered by value, or fetched from the registered
+// jwks_uri. A Client without any registered keys yields an empty key set.
+func (c *Client) JSONWebKeys(ctx context.Context) (*jose.JSONWebKeySet, error) {
+	return c.jsonWebKeys(ctx, "")
+}
+
+// VerificationKeys returns the public keys of the Client like JSONWebKeys, to verify a token signed by the key
+// identified by kid. A cached key set without the kid is fetched again, so that the Client can rotate its keys
+// without its tokens being rejected until the cache expires.
+func (c *Client) VerificationKeys(ctx context.Context, kid string) (*jose.JSONWebKeySet, error) {
+	return c.jsonWebKeys(ctx, kid)
+}
+
+func (c *Client) jsonWebKeys(ctx context.Context, kid string) (*jose.JSONWebKeySet, error) {
+	switch {
+	case c.JSONWebKeySet != nil:
+		return c.JSONWebKeySet, nil
+	case len(c.JSONWebKeySetURI) == 0:
+		return jose.NewJSONWebKeySet(), nil
+	case c.keys == nil:
+		return nil, fmt.Errorf("fetch jwks_uri of client %s: no key fetcher", c.ID)
+	}
+
+	keys, err := c.keys.get(ctx, c.JSONWebKeySetURI, c.dynamic, kid)
+	if err != nil {
+		return nil, fmt.Errorf("fetch jwks_uri of client %s: %w", c.ID, err)
+	}
+
+	return keys, nil
+}
+
+// NewKeyFetcher returns a KeyFetcher with the given properties.
+func NewKeyFetcher(props *KeysProperties) *KeyFetcher {
+	return &KeyFetcher{
+		props:   props,
+		static:  NewHTTPClient(props.Timeout, false),
+		dynamic: NewHTTPClient(props.Timeout, true),
+		cache:   map[keysCacheKey]*cachedKeys{},
+	}
+}
+
+// KeyFetcher fetches the key sets registered by clients as jwks_uri, and caches them by uri. The jwks_uri of a
+// dynamically registered Client is never fetched from non-public addresses, see NewHTTPClient. It is handed to
+// clients by the Registry.
+type KeyFetcher struct {
+	props   *KeysProperties
+	static  *http.Client
+	dynamic *http.Client
+	mu      sync.Mutex
+	cache   map[keysCacheKey]*cachedKeys
+}
+
+// keysCacheKey keeps the key sets fetched for configured and dynamically registered clients apart, so the latter never
+// see a key set fetched from a non-public address.
+type keysCacheKey struct {
+	uri     string
+	dynamic bool
+}
+
+type cachedKeys struct {
+	keys      *jose.JSONWebKeySet
+	fetchedAt time.Time
+}
+
+func (f *KeyFetcher) get(ctx context.Context, uri string, dynamic bool, kid string) (*jose.JSONWebKeySet, error) {
+	key := keysCacheKey{uri: uri, dynamic: dynamic}
+
+	f.mu.Lock()
+	cached, ok := f.cache[key]
+	f.mu.Unlock()
+
+	now := time.Now()
+	if ok && now.Before(cached.fetchedAt.Add(f.props.CacheTTL)) {
+		known := len(kid) == 0 || cached.keys.FindByKeyID(kid) != nil
+		if known || now.Before(cached.fetchedAt.Add(keysRefetchInterval)) {
+			return cached.keys, nil
+		}
+	}
+
+	httpClient := f.static
+	if dynamic {
+		httpClient = f.dynamic
+	}
+
+	keys, err := fetchKeys(ctx, httpClient, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for each, entry := range f.cache {
+		if now.After(entry.fetchedAt.Add(f.props.CacheTTL)) {
+			delete(f.cache, each)
+		}
+	}
+	f.cache[key] = &cachedKeys{keys: keys, fetchedAt: now}
+
+	return keys, nil
+}
+
+func fetchKeys(ctx context.Context, httpClient *http.Client, uri string) (*jose.JSONWebKeySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return jose.ReadJSONWebKeySet(io.LimitReader(resp.Body, keysMaxSize))
+}
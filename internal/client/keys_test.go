@@ -0,0 +1,107 @@
+//go:build unit
+
+package client_test
+
+import (
+	"context"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_JSONWebKeys(t *testing.T) {
+	const jwks = `{"keys":[{"kty":"oct","kid":"foo","k":"c2VjcmV0"}]}`
+
+	var hits int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		_, _ = w.Write([]byte(jwks))
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"keys":[],"padding":"` + strings.Repeat("x", 2<<20) + `"}`))
+	})
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+
+	// key fetchers derive their transports from the default one, which must trust the test server.
+	transport := http.DefaultTransport.(*http.Transport)
+	tlsConfig := transport.TLSClientConfig
+	transport.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+	t.Cleanup(func() { transport.TLSClientConfig = tlsConfig })
+
+	// find returns the client foo configured, or the client dynamic dynamically registered, both with the jwks_uri.
+	find := func(t *testing.T, id string, jwksURI string) *client.Client {
+		store := memory.New(time.Minute)
+		require.NoError(t, store.SaveRegistration(context.Background(), &client.Registration{
+			Client: &client.Client{
+				ID:               "dynamic",
+				RedirectURIs:     []string{"https://dynamic.com/callback"},
+				JSONWebKeySetURI: jwksURI,
+			},
+		}))
+
+		registry, err := client.NewRegistry([]*client.Client{{
+			ID:               "foo",
+			RedirectURIs:     []string{"https://foo.com/callback"},
+			JSONWebKeySetURI: jwksURI,
+		}}, store, client.NewKeyFetcher(&client.KeysProperties{
+			Timeout:  time.Second,
+			CacheTTL: time.Minute,
+		}))
+		require.NoError(t, err)
+
+		c, err := registry.Find(context.Background(), id)
+		require.NoError(t, err)
+		return c
+	}
+
+	t.Run("cached by uri", func(t *testing.T) {
+		atomic.StoreInt32(&hits, 0)
+		c := find(t, "foo", server.URL+"/jwks")
+
+		for i := 0; i < 3; i++ {
+			keys, err := c.JSONWebKeys(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, 1, keys.Size())
+		}
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("unknown kid fetched again at most once in a while", func(t *testing.T) {
+		atomic.StoreInt32(&hits, 0)
+		c := find(t, "foo", server.URL+"/jwks")
+
+		_, err := c.VerificationKeys(context.Background(), "foo")
+		require.NoError(t, err)
+		_, err = c.VerificationKeys(context.Background(), "rotated")
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits), "recently fetched key set is not fetched again")
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		c := find(t, "foo", server.URL+"/large")
+
+		_, err := c.JSONWebKeys(context.Background())
+		assert.Error(t, err)
+	})
+
+	t.Run("dynamically registered client with loopback jwks_uri", func(t *testing.T) {
+		c := find(t, "foo", server.URL+"/jwks")
+		_, err := c.JSONWebKeys(context.Background())
+		require.NoError(t, err, "configured client may use internal addresses")
+
+		c = find(t, "dynamic", server.URL+"/jwks")
+		_, err = c.JSONWebKeys(context.Background())
+		assert.ErrorContains(t, err, "not publicly routable")
+	})
+}
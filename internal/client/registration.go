@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"time"
+)
+
+// Registration is a dynamically registered Client, along with the credential to manage it.
+type Registration struct {
+	Client *Client `json:"client"`
+	// AccessTokenHash is the hash of the registration_access_token issued to manage the registration. The token
+	// itself is only known to the registrant.
+	AccessTokenHash string    `json:"access_token_hash"`
+	IssuedAt        time.Time `json:"issued_at"`
+}
+
+// newRegistration creates a Registration for the Client, and returns it along with the plain registration access
+// token.
+func newRegistration(c *Client) (*Registration, string) {
+	accessToken := randomValue(32)
+	return &Registration{
+		Client:          c,
+		AccessTokenHash: hashValue(accessToken),
+		IssuedAt:        time.Now(),
+	}, accessToken
+}
+
+// VerifyAccessToken returns true if the accessToken is the registration access token of this Registration.
+func (r *Registration) VerifyAccessToken(accessToken string) bool {
+	return subtle.ConstantTimeCompare([]byte(r.AccessTokenHash), []byte(hashValue(accessToken))) == 1
+}
+
+// Store persists dynamic client registrations.
+type Store interface {
+	// SaveRegistration creates or replaces the registration.
+	SaveRegistration(ctx context.Context, registration *Registration) error
+	// GetRegistration returns the registration by client id, or ErrNotFound if the registration does not exist.
+	GetRegistration(ctx context.Context, clientID string) (*Registration, error)
+	// DeleteRegistration removes the registration. Deleting a non-existing registration is not an error.
+	DeleteRegistration(ctx context.Context, clientID string) error
+}
+
+// randomValue returns a url safe string encoded from n bytes of cryptographic random data.
+func randomValue(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func hashValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
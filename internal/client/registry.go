@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Registry looks up registered clients.
+type Registry interface {
+	// Find returns the Client by its id, or ErrNotFound if the client does not exist.
+	Find(ctx context.Context, id string) (*Client, error)
+}
+
+// NewStaticRegistry returns a Registry of the given clients, which usually come from the configuration file. Each
+// client is validated, and client ids must be unique. The keys fetch the key sets of clients registering jwks_uri.
+func NewStaticRegistry(clients []*Client, keys *KeyFetcher) (Registry, error) {
+	r := &staticRegistry{clients: map[string]*Client{}}
+
+	for _, each := range clients {
+		if err := each.Validate(); err != nil {
+			return nil, fmt.Errorf("client %s: %w", each.ID, err)
+		}
+		if _, ok := r.clients[each.ID]; ok {
+			return nil, fmt.Errorf("client %s: duplicate client_id", each.ID)
+		}
+		each.keys = keys
+		r.clients[each.ID] = each
+	}
+
+	return r, nil
+}
+
+type staticRegistry struct {
+	clients map[string]*Client
+}
+
+func (r *staticRegistry) Find(_ context.Context, id string) (*Client, error) {
+	c, ok := r.clients[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return c, nil
+}
+
+// NewRegistry returns a Registry of the static clients, and the clients dynamically registered in the Store. Static
+// clients take precedence.
+func NewRegistry(clients []*Client, store Store, keys *KeyFetcher) (Registry, error) {
+	static, err := NewStaticRegistry(clients, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &registry{static: static, store: store, keys: keys}, nil
+}
+
+type registry struct {
+	static Registry
+	store  Store
+	keys   *KeyFetcher
+}
+
+func (r *registry) Find(ctx context.Context, id string) (*Client, error) {
+	c, err := r.static.Find(ctx, id)
+	if !errors.Is(err, ErrNotFound) {
+		return c, err
+	}
+
+	registration, err := r.store.GetRegistration(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	dynamic := *registration.Client
+	dynamic.dynamic = true
+	dynamic.keys = r.keys
+
+	return &dynamic, nil
+}
@@ -0,0 +1,301 @@
+package client
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"github.com/Southclaws/fault"
+	"github.com/Southclaws/fault/fmsg"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/wellknown"
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/oklog/ulid/v2"
+	"github.com/samber/lo"
+	"strings"
+)
+
+var (
+	// ErrRegistration is the root error returned when a client registration request is rejected.
+	ErrRegistration = errors.New("client registration is rejected")
+)
+
+// RegistrationProperties is the configuration properties for dynamic client registration.
+type RegistrationProperties struct {
+	// InitialAccessToken, when not empty, is the bearer token required to register clients. Otherwise, registration
+	// is open to anyone.
+	InitialAccessToken string `json:"initial_access_token" yaml:"initial_access_token"`
+}
+
+// RegistrationResponse is the client information response defined in RFC 7591 Section 3.2.1.
+type RegistrationResponse struct {
+	*Client
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   *int64 `json:"client_secret_expires_at,omitempty"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri"`
+}
+
+// NewRegistrationService creates a RegistrationService which accepts client metadata within the capabilities
+// advertised in Discovery.
+func NewRegistrationService(props *RegistrationProperties, discovery *wellknown.Discovery, store Store) *RegistrationService {
+	return &RegistrationService{
+		props:     props,
+		discovery: discovery,
+		store:     store,
+	}
+}
+
+// RegistrationService implements OAuth 2.0 Dynamic Client Registration.
+type RegistrationService struct {
+	props     *RegistrationProperties
+	discovery *wellknown.Discovery
+	store     Store
+}
+
+// Register validates the client metadata, and registers the client with server issued client_id, client_secret and
+// registration_access_token. The tigerd extensions to the client metadata are reserved for static clients and hence
+// ignored. The initialAccessToken is the bearer token presented by the registrant, if any.
+func (s *RegistrationService) Register(ctx context.Context, initialAccessToken string, metadata *Client) (*RegistrationResponse, error) {
+	if len(s.props.InitialAccessToken) > 0 &&
+		subtle.ConstantTimeCompare([]byte(s.props.InitialAccessToken), []byte(initialAccessToken)) != 1 {
+		return nil, fault.Wrap(ErrRegistration,
+			ftag.With(spec.ErrKindInvalidToken),
+			fmsg.WithDesc("invalid initial access token", "A valid initial access token is required to register clients."),
+		)
+	}
+
+	c := s.prepare(metadata)
+	c.ID = ulid.Make().String()
+	s.issueSecret(c, "")
+
+	if err := s.validate(c); err != nil {
+		return nil, err
+	}
+
+	registration, accessToken := newRegistration(c)
+	if err := s.store.SaveRegistration(ctx, registration); err != nil {
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	return s.response(registration, accessToken), nil
+}
+
+// Read returns the current registration of the client, authenticated by its registration access token. As only the
+// hash of the token is kept, the token is not repeated in the response.
+func (s *RegistrationService) Read(ctx context.Context, clientID string, accessToken string) (*RegistrationResponse, error) {
+	registration, err := s.authorize(ctx, clientID, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.response(registration, ""), nil
+}
+
+// Update replaces the metadata of the client, authenticated by its registration access token, as defined in RFC 7592
+// Section 2.2. The client_id must match the registration, and client_secret, if present, must match the one issued.
+// Metadata is subject to the same validation as Register.
+func (s *RegistrationService) Update(ctx context.Context, clientID string, accessToken string, metadata *Client) (*RegistrationResponse, error) {
+	registration, err := s.authorize(ctx, clientID, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata.ID != registration.Client.ID {
+		return nil, fault.Wrap(ErrRegistration,
+			ftag.With(spec.ErrKindInvalidClientMetadata),
+			fmsg.WithDesc("client_id mismatch", "The client_id must match the registered client."),
+		)
+	}
+	if len(metadata.Secret) > 0 &&
+		subtle.ConstantTimeCompare([]byte(metadata.Secret), []byte(registration.Client.Secret)) != 1 {
+		return nil, fault.Wrap(ErrRegistration,
+			ftag.With(spec.ErrKindInvalidClientMetadata),
+			fmsg.WithDesc("client_secret mismatch", "The client_secret must match the issued secret."),
+		)
+	}
+
+	c := s.prepare(metadata)
+	c.ID = registration.Client.ID
+	s.issueSecret(c, registration.Client.Secret)
+
+	if err := s.validate(c); err != nil {
+		return nil, err
+	}
+
+	registration.Client = c
+	if err := s.store.SaveRegistration(ctx, registration); err != nil {
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	return s.response(registration, ""), nil
+}
+
+// Delete deregisters the client, authenticated by its registration access token. Tokens issued to the client stop
+// working, as every use looks the client up again: the token endpoint no longer authenticates the client, the
+// userinfo endpoint rejects its access tokens, and introspection reports its tokens as inactive.
+func (s *RegistrationService) Delete(ctx context.Context, clientID string, accessToken string) error {
+	if _, err := s.authorize(ctx, clientID, accessToken); err != nil {
+		return err
+	}
+
+	if err := s.store.DeleteRegistration(ctx, clientID); err != nil {
+		return fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	return nil
+}
+
+// authorize loads the registration of the client, and verifies the registration access token. As required by RFC 7592
+// Section 2, a non-existing client is indistinguishable from an invalid token. Static clients have no registration,
+// and hence can not be managed.
+func (s *RegistrationService) authorize(ctx context.Context, clientID string, accessToken string) (*Registration, error) {
+	registration, err := s.store.GetRegistration(ctx, clientID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		err = ErrRegistration
+	case err != nil:
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	case len(accessToken) == 0 || !registration.VerifyAccessToken(accessToken):
+		err = ErrRegistration
+	default:
+		return registration, nil
+	}
+
+	return nil, fault.Wrap(err,
+		ftag.With(spec.ErrKindInvalidToken),
+		fmsg.WithDesc("invalid registration access token", "A valid registration access token is required to manage the client."),
+	)
+}
+
+// issueSecret keeps the current secret, or generates a new one, when the authentication method of the client requires
+// a shared secret. Otherwise, the secret is cleared.
+func (s *RegistrationService) issueSecret(c *Client, current string) {
+	switch c.AuthMethod() {
+	case spec.NoAuthenticationMethod, spec.PrivateKeyJWT:
+		c.Secret = ""
+	default:
+		c.Secret = current
+		if len(c.Secret) == 0 {
+			c.Secret = randomValue(32)
+		}
+	}
+}
+
+// prepare resets the server managed fields of the client metadata, and applies defaults.
+func (s *RegistrationService) prepare(metadata *Client) *Client {
+	c := *metadata
+	c.ID = ""
+	c.Secret = ""
+	c.ProviderKey = ""
+	c.AccessTokenLifetime = 0
+	c.Introspection = false
+
+	if c.ApplicationType == 0 {
+		c.ApplicationType = spec.AppTypeWeb
+	}
+	if c.TokenEndpointAuthMethod == 0 {
+		c.TokenEndpointAuthMethod = spec.ClientSecretBasic
+	}
+
+	return &c
+}
+
+// validate checks the client metadata on its own, and against the capabilities of the server.
+func (s *RegistrationService) validate(c *Client) error {
+	if err := c.Validate(); err != nil {
+		kind := spec.ErrKindInvalidClientMetadata
+		if errs, ok := err.(v.Errors); ok && errs["redirect_uris"] != nil {
+			kind = spec.ErrKindInvalidRedirectURI
+		}
+		return fault.Wrap(ErrRegistration, ftag.With(kind), fmsg.WithDesc(err.Error(), err.Error()))
+	}
+
+	d := s.discovery
+	err := v.Errors{
+		"response_types": v.Validate(c.ResponseTypes, v.When(len(d.ResponseTypesSupported) > 0,
+			v.Each(v.In(lo.ToAnySlice(d.ResponseTypesSupported)...).Error("not supported")),
+		)),
+		"grant_types": v.Validate(c.GrantTypes, v.When(len(d.GrantTypesSupported) > 0,
+			v.Each(v.In(lo.ToAnySlice(d.GrantTypesSupported)...).Error("not supported")),
+		)),
+		"scope": v.Validate(c.Scopes(), v.When(len(d.ScopesSupported) > 0,
+			v.Each(v.In(lo.ToAnySlice(d.ScopesSupported)...).Error("not supported")),
+		)),
+		"token_endpoint_auth_method": v.Validate(c.TokenEndpointAuthMethod, v.When(len(d.TokenEndpointAuthMethodsSupported) > 0,
+			v.In(lo.ToAnySlice(d.TokenEndpointAuthMethodsSupported)...).Error("not supported"),
+		)),
+		"token_endpoint_auth_signing_alg": v.Validate(c.TokenEndpointAuthSigningAlg, v.When(len(d.TokenEndpointAuthSigningAlgValuesSupported) > 0,
+			v.In(lo.ToAnySlice(d.TokenEndpointAuthSigningAlgValuesSupported)...).Error("not supported"),
+		)),
+		"id_token_signed_response_alg": v.Validate(c.IDTokenSignedResponseAlg, v.When(len(d.IdTokenSigningAlgValuesSupported) > 0,
+			v.In(lo.ToAnySlice(d.IdTokenSigningAlgValuesSupported)...).Error("not supported"),
+		)),
+		"id_token_encrypted_response_alg": v.Validate(c.IDTokenEncryptedResponseAlg, v.When(len(d.IdTokenEncryptionAlgValuesSupported) > 0,
+			v.In(lo.ToAnySlice(d.IdTokenEncryptionAlgValuesSupported)...).Error("not supported"),
+		)),
+		"id_token_encrypted_response_enc": v.Validate(c.IDTokenEncryptedResponseEnc, v.When(len(d.IdTokenEncryptionEncValuesSupported) > 0,
+			v.In(lo.ToAnySlice(d.IdTokenEncryptionEncValuesSupported)...).Error("not supported"),
+		)),
+		"backchannel_logout_uri": v.Validate(c.BackChannelLogoutURI,
+			v.When(!d.BackChannelLogoutSupported, v.Empty.Error("not supported")),
+		),
+		"backchannel_logout_session_required": v.Validate(c.BackChannelLogoutSessionRequired,
+			v.When(!d.BackChannelLogoutSessionSupported, v.Empty.Error("not supported")),
+		),
+		"frontchannel_logout_uri": v.Validate(c.FrontChannelLogoutURI,
+			v.When(!d.FrontChannelLogoutSupported, v.Empty.Error("not supported")),
+		),
+		"frontchannel_logout_session_required": v.Validate(c.FrontChannelLogoutSessionRequired,
+			v.When(!d.FrontChannelLogoutSessionSupported, v.Empty.Error("not supported")),
+		),
+		"userinfo_signed_response_alg": v.Validate(c.UserInfoSignedResponseAlg, v.When(len(d.UserInfoSigningAlgValuesSupported) > 0,
+			v.In(lo.ToAnySlice(d.UserInfoSigningAlgValuesSupported)...).Error("not supported"),
+		)),
+		"userinfo_encrypted_response_alg": v.Validate(c.UserInfoEncryptedResponseAlg, v.When(len(d.UserInfoEncryptionAlgValuesSupported) > 0,
+			v.In(lo.ToAnySlice(d.UserInfoEncryptionAlgValuesSupported)...).Error("not supported"),
+		)),
+		"userinfo_encrypted_response_enc": v.Validate(c.UserInfoEncryptedResponseEnc, v.When(len(d.UserInfoEncryptionEncValuesSupported) > 0,
+			v.In(lo.ToAnySlice(d.UserInfoEncryptionEncValuesSupported)...).Error("not supported"),
+		)),
+		"authorization_signed_response_alg": v.Validate(c.AuthorizationSignedResponseAlg, v.When(len(d.AuthorizationSigningAlgValuesSupported) > 0,
+			v.In(lo.ToAnySlice(d.AuthorizationSigningAlgValuesSupported)...).Error("not supported"),
+		)),
+		"authorization_encrypted_response_alg": v.Validate(c.AuthorizationEncryptedResponseAlg, v.When(len(d.AuthorizationEncryptionAlgValuesSupported) > 0,
+			v.In(lo.ToAnySlice(d.AuthorizationEncryptionAlgValuesSupported)...).Error("not supported"),
+		)),
+		"authorization_encrypted_response_enc": v.Validate(c.AuthorizationEncryptedResponseEnc, v.When(len(d.AuthorizationEncryptionEncValuesSupported) > 0,
+			v.In(lo.ToAnySlice(d.AuthorizationEncryptionEncValuesSupported)...).Error("not supported"),
+		)),
+		"request_object_signing_alg": v.Validate(c.RequestObjectSigningAlg, v.When(len(d.RequestObjectSigningAlgValuesSupported) > 0,
+			v.In(lo.ToAnySlice(d.RequestObjectSigningAlgValuesSupported)...).Error("not supported"),
+		)),
+		"request_object_encryption_alg": v.Validate(c.RequestObjectEncryptionAlg, v.When(len(d.RequestObjectEncryptionAlgValuesSupported) > 0,
+			v.In(lo.ToAnySlice(d.RequestObjectEncryptionAlgValuesSupported)...).Error("not supported"),
+		)),
+		"request_object_encryption_enc": v.Validate(c.RequestObjectEncryptionEnc, v.When(len(d.RequestObjectEncryptionEncValuesSupported) > 0,
+			v.In(lo.ToAnySlice(d.RequestObjectEncryptionEncValuesSupported)...).Error("not supported"),
+		)),
+	}.Filter()
+	if err != nil {
+		return fault.Wrap(ErrRegistration,
+			ftag.With(spec.ErrKindInvalidClientMetadata),
+			fmsg.WithDesc(err.Error(), err.Error()),
+		)
+	}
+
+	return nil
+}
+
+func (s *RegistrationService) response(registration *Registration, accessToken string) *RegistrationResponse {
+	resp := &RegistrationResponse{
+		Client:                  registration.Client,
+		ClientIDIssuedAt:        registration.IssuedAt.Unix(),
+		RegistrationAccessToken: accessToken,
+		RegistrationClientURI:   strings.TrimSuffix(s.discovery.RegistrationEndpoint, "/") + "/" + registration.Client.ID,
+	}
+	if len(registration.Client.Secret) > 0 {
+		resp.ClientSecretExpiresAt = new(int64)
+	}
+	return resp
+}
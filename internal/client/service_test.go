@@ -0,0 +1,278 @@
+//go:build unit
+
+package client_test
+
+import (
+	"context"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/storage/memory"
+	"github.com/absurdlab/tigerd/internal/wellknown"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRegistrationService_Register(t *testing.T) {
+	discovery := &wellknown.Discovery{
+		RegistrationEndpoint:   "https://tigerd.com/oauth/register",
+		ScopesSupported:        []string{"openid", "profile", "offline_access"},
+		ResponseTypesSupported: []spec.ResponseTypeSet{spec.ResponseTypeCode.ToSet()},
+		GrantTypesSupported:    []spec.GrantType{spec.GrantTypeAuthorizationCode, spec.GrantTypeRefreshToken},
+		TokenEndpointAuthMethodsSupported: []spec.AuthenticationMethod{
+			spec.ClientSecretBasic,
+			spec.NoAuthenticationMethod,
+		},
+	}
+
+	gold := func() *client.Client {
+		return &client.Client{
+			Name:         "Foo",
+			RedirectURIs: []string{"https://foo.com/callback"},
+			Scope:        "openid profile",
+		}
+	}
+
+	cases := []struct {
+		name         string
+		props        *client.RegistrationProperties
+		initialToken string
+		hook         func(c *client.Client)
+		expect       ftag.Kind
+		assert       func(t *testing.T, resp *client.RegistrationResponse)
+	}{
+		{
+			name:  "gold",
+			props: &client.RegistrationProperties{},
+			hook:  func(c *client.Client) {},
+			assert: func(t *testing.T, resp *client.RegistrationResponse) {
+				assert.NotEmpty(t, resp.ID)
+				assert.NotEmpty(t, resp.Secret)
+				assert.NotEmpty(t, resp.RegistrationAccessToken)
+				assert.Equal(t, spec.ClientSecretBasic, resp.TokenEndpointAuthMethod)
+				assert.Equal(t, "https://tigerd.com/oauth/register/"+resp.ID, resp.RegistrationClientURI)
+				if assert.NotNil(t, resp.ClientSecretExpiresAt) {
+					assert.Zero(t, *resp.ClientSecretExpiresAt)
+				}
+			},
+		},
+		{
+			name:  "public client",
+			props: &client.RegistrationProperties{},
+			hook:  func(c *client.Client) { c.TokenEndpointAuthMethod = spec.NoAuthenticationMethod },
+			assert: func(t *testing.T, resp *client.RegistrationResponse) {
+				assert.Empty(t, resp.Secret)
+				assert.Nil(t, resp.ClientSecretExpiresAt)
+			},
+		},
+		{
+			name:  "extensions ignored",
+			props: &client.RegistrationProperties{},
+			hook: func(c *client.Client) {
+				c.ID = "chosen"
+				c.ProviderKey = "internal"
+				c.AccessTokenLifetime = 86400
+				c.Introspection = true
+			},
+			assert: func(t *testing.T, resp *client.RegistrationResponse) {
+				assert.NotEqual(t, "chosen", resp.ID)
+				assert.Empty(t, resp.ProviderKey)
+				assert.Zero(t, resp.AccessTokenLifetime)
+				assert.False(t, resp.Introspection)
+			},
+		},
+		{
+			name:         "initial access token accepted",
+			props:        &client.RegistrationProperties{InitialAccessToken: "t0ken"},
+			initialToken: "t0ken",
+			hook:         func(c *client.Client) {},
+		},
+		{
+			name:         "initial access token rejected",
+			props:        &client.RegistrationProperties{InitialAccessToken: "t0ken"},
+			initialToken: "wrong",
+			hook:         func(c *client.Client) {},
+			expect:       spec.ErrKindInvalidToken,
+		},
+		{
+			name:   "invalid redirect uri",
+			props:  &client.RegistrationProperties{},
+			hook:   func(c *client.Client) { c.RedirectURIs = []string{"/callback"} },
+			expect: spec.ErrKindInvalidRedirectURI,
+		},
+		{
+			name:   "unsupported scope",
+			props:  &client.RegistrationProperties{},
+			hook:   func(c *client.Client) { c.Scope = "openid admin" },
+			expect: spec.ErrKindInvalidClientMetadata,
+		},
+		{
+			name:  "unsupported grant type",
+			props: &client.RegistrationProperties{},
+			hook: func(c *client.Client) {
+				c.GrantTypes = []spec.GrantType{spec.GrantTypeAuthorizationCode, spec.GrantTypeClientCredentials}
+			},
+			expect: spec.ErrKindInvalidClientMetadata,
+		},
+		{
+			name:   "unsupported auth method",
+			props:  &client.RegistrationProperties{},
+			hook:   func(c *client.Client) { c.TokenEndpointAuthMethod = spec.ClientSecretPost },
+			expect: spec.ErrKindInvalidClientMetadata,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store := memory.New(time.Minute)
+			service := client.NewRegistrationService(c.props, discovery, store)
+
+			metadata := gold()
+			c.hook(metadata)
+
+			resp, err := service.Register(context.Background(), c.initialToken, metadata)
+			if len(c.expect) > 0 {
+				assert.Error(t, err)
+				assert.Equal(t, c.expect, spec.GetErrorKind(err))
+				return
+			}
+
+			require.NoError(t, err)
+			if c.assert != nil {
+				c.assert(t, resp)
+			}
+
+			registration, err := store.GetRegistration(context.Background(), resp.ID)
+			require.NoError(t, err)
+			assert.True(t, registration.VerifyAccessToken(resp.RegistrationAccessToken))
+			assert.False(t, registration.VerifyAccessToken("wrong"))
+
+			registry, err := client.NewRegistry(nil, store, nil)
+			require.NoError(t, err)
+			found, err := registry.Find(context.Background(), resp.ID)
+			require.NoError(t, err)
+			assert.Equal(t, resp.Secret, found.Secret)
+		})
+	}
+}
+
+func TestRegistrationService_Manage(t *testing.T) {
+	discovery := &wellknown.Discovery{
+		RegistrationEndpoint: "https://tigerd.com/oauth/register",
+	}
+
+	setup := func(t *testing.T) (*client.RegistrationService, client.Store, *client.RegistrationResponse) {
+		store := memory.New(time.Minute)
+		service := client.NewRegistrationService(&client.RegistrationProperties{}, discovery, store)
+		resp, err := service.Register(context.Background(), "", &client.Client{
+			Name:         "Foo",
+			RedirectURIs: []string{"https://foo.com/callback"},
+		})
+		require.NoError(t, err)
+		return service, store, resp
+	}
+
+	t.Run("read", func(t *testing.T) {
+		service, _, registered := setup(t)
+
+		resp, err := service.Read(context.Background(), registered.ID, registered.RegistrationAccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, registered.ID, resp.ID)
+		assert.Equal(t, registered.Secret, resp.Secret)
+		assert.Equal(t, "Foo", resp.Name)
+		assert.Empty(t, resp.RegistrationAccessToken)
+	})
+
+	t.Run("read with invalid token", func(t *testing.T) {
+		service, _, registered := setup(t)
+
+		_, err := service.Read(context.Background(), registered.ID, "wrong")
+		assert.Equal(t, spec.ErrKindInvalidToken, spec.GetErrorKind(err))
+	})
+
+	t.Run("read unknown client", func(t *testing.T) {
+		service, _, registered := setup(t)
+
+		_, err := service.Read(context.Background(), "unknown", registered.RegistrationAccessToken)
+		assert.Equal(t, spec.ErrKindInvalidToken, spec.GetErrorKind(err))
+	})
+
+	t.Run("update", func(t *testing.T) {
+		service, store, registered := setup(t)
+
+		resp, err := service.Update(context.Background(), registered.ID, registered.RegistrationAccessToken, &client.Client{
+			ID:           registered.ID,
+			Secret:       registered.Secret,
+			Name:         "Bar",
+			RedirectURIs: []string{"https://bar.com/callback"},
+			ProviderKey:  "internal",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, registered.Secret, resp.Secret)
+		assert.Equal(t, "Bar", resp.Name)
+		assert.Empty(t, resp.ProviderKey)
+
+		registration, err := store.GetRegistration(context.Background(), registered.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"https://bar.com/callback"}, registration.Client.RedirectURIs)
+		assert.True(t, registration.VerifyAccessToken(registered.RegistrationAccessToken))
+	})
+
+	t.Run("update to public client", func(t *testing.T) {
+		service, _, registered := setup(t)
+
+		resp, err := service.Update(context.Background(), registered.ID, registered.RegistrationAccessToken, &client.Client{
+			ID:                      registered.ID,
+			RedirectURIs:            []string{"https://foo.com/callback"},
+			TokenEndpointAuthMethod: spec.NoAuthenticationMethod,
+		})
+		require.NoError(t, err)
+		assert.Empty(t, resp.Secret)
+	})
+
+	t.Run("update with mismatched client_id", func(t *testing.T) {
+		service, _, registered := setup(t)
+
+		_, err := service.Update(context.Background(), registered.ID, registered.RegistrationAccessToken, &client.Client{
+			ID:           "other",
+			RedirectURIs: []string{"https://foo.com/callback"},
+		})
+		assert.Equal(t, spec.ErrKindInvalidClientMetadata, spec.GetErrorKind(err))
+	})
+
+	t.Run("update with mismatched client_secret", func(t *testing.T) {
+		service, _, registered := setup(t)
+
+		_, err := service.Update(context.Background(), registered.ID, registered.RegistrationAccessToken, &client.Client{
+			ID:           registered.ID,
+			Secret:       "guess",
+			RedirectURIs: []string{"https://foo.com/callback"},
+		})
+		assert.Equal(t, spec.ErrKindInvalidClientMetadata, spec.GetErrorKind(err))
+	})
+
+	t.Run("update with invalid metadata", func(t *testing.T) {
+		service, _, registered := setup(t)
+
+		_, err := service.Update(context.Background(), registered.ID, registered.RegistrationAccessToken, &client.Client{
+			ID:           registered.ID,
+			RedirectURIs: []string{"/callback"},
+		})
+		assert.Equal(t, spec.ErrKindInvalidRedirectURI, spec.GetErrorKind(err))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		service, store, registered := setup(t)
+
+		err := service.Delete(context.Background(), registered.ID, registered.RegistrationAccessToken)
+		require.NoError(t, err)
+
+		_, err = store.GetRegistration(context.Background(), registered.ID)
+		assert.ErrorIs(t, err, client.ErrNotFound)
+
+		err = service.Delete(context.Background(), registered.ID, registered.RegistrationAccessToken)
+		assert.Equal(t, spec.ErrKindInvalidToken, spec.GetErrorKind(err))
+	})
+}
@@ -35,6 +35,16 @@ func PeekOnly() DecoderOpt {
 	}
 }
 
+// KeyID returns the kid header of the signed token, or empty if the token is not a well-formed JWS or has no kid.
+// It does not verify the token, and only serves to look up the verification key.
+func KeyID(token string) string {
+	jsonWebToken, err := jwt.ParseSigned(token)
+	if err != nil || len(jsonWebToken.Headers) == 0 {
+		return ""
+	}
+	return jsonWebToken.Headers[0].KeyID
+}
+
 // ExpectSignature instructs the Decoder to expect the token to have been signed and therefore perform signature verification.
 func ExpectSignature(alg spec.SignatureAlgorithm, jwks *JSONWebKeySet) DecoderOpt {
 	return func(n *Decoder) {
@@ -124,7 +134,7 @@ func (n *Decoder) verify(dest ...any) error {
 		return err
 	}
 
-	return jsonWebToken.Claims(jsonWebKey.Public().Key, dest...)
+	return jsonWebToken.Claims(verificationKey(jsonWebKey), dest...)
 }
 
 func (n *Decoder) decrypt(dest ...any) error {
@@ -162,7 +172,7 @@ func (n *Decoder) decryptAndVerify(dest ...any) error {
 		return err
 	}
 
-	return jsonWebToken.Claims(verifyJsonWebKey.Public().Key, dest...)
+	return jsonWebToken.Claims(verificationKey(verifyJsonWebKey), dest...)
 }
 
 func (n *Decoder) expectSignature() bool {
@@ -175,13 +185,16 @@ func (n *Decoder) expectEncryption() bool {
 
 func (n *Decoder) extractVerificationKey(headers []jose.Header) (*JSONWebKey, error) {
 	kid, alg := getKeyIdFromHeaders(headers), getAlgFromHeaders(headers)
-	if len(kid) == 0 {
+	if len(kid) == 0 && n.verificationKeySet.Size() != 1 {
 		return nil, errors.New("jws missing kid header")
 	} else if len(alg) == 0 {
 		return nil, errors.New("jws missing alg header")
 	}
 
 	jsonWebKey := n.verificationKeySet.FindByKeyID(kid)
+	if len(kid) == 0 {
+		jsonWebKey = n.verificationKeySet.only()
+	}
 	if jsonWebKey == nil {
 		return nil, fmt.Errorf("no key by kid %s", kid)
 	}
@@ -219,6 +232,15 @@ func (n *Decoder) extractDecryptionKey(headers []jose.Header) (*JSONWebKey, erro
 	return jsonWebKey, nil
 }
 
+// verificationKey returns the key material to verify signatures with: the public key of an asymmetric key pair, or
+// the symmetric key itself for HMAC algorithms.
+func verificationKey(jsonWebKey *JSONWebKey) any {
+	if jsonWebKey.IsOctetKey() {
+		return jsonWebKey.Key
+	}
+	return jsonWebKey.Public().Key
+}
+
 func getKeyIdFromHeaders(headers []jose.Header) string {
 	for _, header := range headers {
 		if kid := header.KeyID; len(kid) > 0 {
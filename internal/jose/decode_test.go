@@ -61,3 +61,20 @@ func TestDecode(t *testing.T) {
 		})
 	}
 }
+
+func TestDecode_SymmetricKeyWithoutKeyID(t *testing.T) {
+	key := &JSONWebKey{Key: []byte(strings.Repeat("s", 32)), Algorithm: spec.HS256.String(), Use: UseSig}
+	jwks := NewJSONWebKeySet(key)
+
+	token, err := Encode(new(testStdClaims).init(), WithSignature(spec.HS256, jwks))
+	require.NoError(t, err)
+
+	claims := new(testStdClaims)
+	err = Decode(token, ExpectSignature(spec.HS256, jwks)).Into(&claims)
+	if assert.NoError(t, err) {
+		claims.assert(t)
+	}
+
+	other := NewJSONWebKeySet(&JSONWebKey{Key: []byte(strings.Repeat("x", 32)), Algorithm: spec.HS256.String(), Use: UseSig})
+	assert.Error(t, Decode(token, ExpectSignature(spec.HS256, other)).Into(&claims))
+}
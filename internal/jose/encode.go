@@ -71,6 +71,15 @@ func WithEncryption(alg spec.EncryptionAlgorithm, enc spec.EncryptionEncoding, j
 	}
 }
 
+// WithType instructs Encode to set the typ header of the signed token, for tokens that must be explicitly typed, such as
+// the logout+jwt logout token.
+func WithType(typ string) EncoderOpt {
+	return func(n *encoder) error {
+		n.typ = typ
+		return nil
+	}
+}
+
 func withFlattenedClaims(claims any) EncoderOpt {
 	return func(n *encoder) error {
 		if claims == nil {
@@ -89,6 +98,7 @@ func withFlattenedClaims(claims any) EncoderOpt {
 }
 
 type encoder struct {
+	typ           string
 	signingKey    *JSONWebKey
 	encryptionKey *JSONWebKey
 	encryptionEnc spec.EncryptionEncoding
@@ -157,12 +167,17 @@ func (n *encoder) createSigner() (jose.Signer, error) {
 		return nil, nil
 	}
 
+	opts := new(jose.SignerOptions).WithHeader("kid", n.signingKey.KeyID)
+	if len(n.typ) > 0 {
+		opts = opts.WithType(jose.ContentType(n.typ))
+	}
+
 	signer, err := jose.NewSigner(
 		jose.SigningKey{
 			Algorithm: jose.SignatureAlgorithm(n.signingKey.Algorithm),
 			Key:       n.signingKey.Key,
 		},
-		new(jose.SignerOptions).WithHeader("kid", n.signingKey.KeyID),
+		opts,
 	)
 	if err != nil {
 		return nil, err
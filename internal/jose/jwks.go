@@ -72,6 +72,18 @@ func (s *JSONWebKeySet) FindByKeyID(kid string) *JSONWebKey {
 	return s.keys[kid]
 }
 
+// only returns the single key in the set, or nil if the set does not hold exactly one key. It supports tokens that
+// omit the kid header, which is optional when the key set leaves no ambiguity.
+func (s *JSONWebKeySet) only() *JSONWebKey {
+	if s.Size() != 1 {
+		return nil
+	}
+	for _, k := range s.keys {
+		return k
+	}
+	return nil
+}
+
 // FindForSigning returns the JSONWebKey intended for signature use with the matching algorithm, or nil if not found.
 func (s *JSONWebKeySet) FindForSigning(alg spec.SignatureAlgorithm) *JSONWebKey {
 	return s.find(alg.String(), UseSig)
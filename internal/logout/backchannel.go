@@ -0,0 +1,188 @@
+package logout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// backChannelLogoutEvent is the member of the events claim identifying a logout token.
+	backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+	// logoutTokenType is the explicit typ header of logout tokens.
+	logoutTokenType = "logout+jwt"
+	// logoutTokenLifespan is the duration a logout token remains valid.
+	logoutTokenLifespan = 2 * time.Minute
+	// backChannelBackoff is the delay before the first retry of a failed delivery, doubled on every following retry.
+	backChannelBackoff = time.Second
+)
+
+// logoutTokenClaims are the claims of a logout token defined in OpenID Connect Back-Channel Logout 1.0 Section 2.4.
+type logoutTokenClaims struct {
+	std   *jose.StdClaims
+	extra *logoutTokenExtraClaims
+}
+
+type logoutTokenExtraClaims struct {
+	Events map[string]any `json:"events"`
+	Sid    string         `json:"sid,omitempty"`
+}
+
+func (c *logoutTokenClaims) MultipleClaims() []any {
+	return []any{c.std, c.extra}
+}
+
+// backChannelLogout notifies the participants of the terminated LoginSession, which registered a back-channel logout
+// uri, in the background. Failed deliveries are retried with exponential backoff, up to the configured attempts, or
+// until the Service is closed. The sid is the public sid of the LoginSession, never its id.
+func (s *Service) backChannelLogout(sid string, participants []*authorize.Participant) {
+	for _, participant := range participants {
+		s.deliveries.Add(1)
+		go func(participant *authorize.Participant) {
+			defer s.deliveries.Done()
+
+			c, err := s.clients.Find(s.ctx, participant.ClientID)
+			if err != nil {
+				if !errors.Is(err, client.ErrNotFound) {
+					s.logger.Err(err).Str("client_id", participant.ClientID).Msg("Failed to find client for back-channel logout.")
+				}
+				return
+			}
+
+			if len(c.BackChannelLogoutURI) == 0 {
+				return
+			}
+
+			logoutToken, err := s.logoutToken(s.ctx, c, participant.Subject, sid)
+			if err != nil {
+				s.logger.Err(err).Str("client_id", c.ID).Msg("Failed to encode logout token.")
+				return
+			}
+
+			if err = s.deliver(s.ctx, c, logoutToken); err != nil {
+				s.logger.Warn().Err(err).Str("client_id", c.ID).Msg("Failed to deliver back-channel logout.")
+			}
+		}(participant)
+	}
+}
+
+// Close stops retrying back-channel deliveries, and waits for the attempts in flight to finish, or until ctx is done.
+func (s *Service) Close(ctx context.Context) error {
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.deliveries.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// logoutToken encodes the logout token with the id_token signing and encryption preferences of the client.
+func (s *Service) logoutToken(ctx context.Context, c *client.Client, subject string, sid string) (string, error) {
+	claims := &logoutTokenClaims{
+		std: new(jose.StdClaims).
+			GenerateID().
+			WithIssuer(s.issuer).
+			WithSubject(subject).
+			WithAudience(c.ID).
+			WithIssuedAtNow().
+			WithExpiryIn(logoutTokenLifespan),
+		extra: &logoutTokenExtraClaims{
+			Events: map[string]any{backChannelLogoutEvent: map[string]any{}},
+			Sid:    sid,
+		},
+	}
+
+	alg := c.IDTokenSignedResponseAlg
+	if alg.IsNoneOrEmpty() {
+		alg = s.idTokenAlg
+	}
+
+	opts := []jose.EncoderOpt{jose.WithType(logoutTokenType), jose.WithSignature(alg, s.jwks)}
+
+	if !c.IDTokenEncryptedResponseAlg.IsNoneOrEmpty() {
+		keys, err := c.JSONWebKeys(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		enc := c.IDTokenEncryptedResponseEnc
+		if enc == 0 {
+			enc = spec.A128CBC_HS256
+		}
+
+		opts = append(opts, jose.WithEncryption(c.IDTokenEncryptedResponseAlg, enc, keys))
+	}
+
+	return jose.Encode(claims, opts...)
+}
+
+// deliver posts the logout token to the back-channel logout uri of the client. Network failures and server errors are
+// retried, while client errors are not, as the relying party would reject the same logout token again. An attempt in
+// flight is bounded by the configured timeout rather than ctx, so that it is not cut short when ctx is cancelled.
+func (s *Service) deliver(ctx context.Context, c *client.Client, logoutToken string) error {
+	var (
+		body    = url.Values{"logout_token": {logoutToken}}.Encode()
+		backoff = backChannelBackoff
+		err     error
+	)
+
+	httpClient := s.static
+	if c.IsDynamic() {
+		httpClient = s.dynamic
+	}
+
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		if retry, err = post(httpClient, c.BackChannelLogoutURI, body); err == nil || !retry || attempt >= s.props.BackChannelAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+func post(httpClient *http.Client, uri string, body string) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, uri, strings.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNoContent:
+		return false, nil
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return true, fmt.Errorf("back-channel logout uri responded with %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("back-channel logout uri responded with %d", resp.StatusCode)
+	}
+}
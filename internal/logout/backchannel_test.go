@@ -0,0 +1,212 @@
+//go:build unit
+
+package logout_test
+
+import (
+	"context"
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/logout"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/storage/memory"
+	"github.com/absurdlab/tigerd/internal/wellknown"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestService_Logout_BackChannel(t *testing.T) {
+	serverKeys := jose.NewJSONWebKeySet(jose.GenerateSignatureKey("server", spec.RS256, 2048))
+
+	cases := []struct {
+		name     string
+		failures int32
+		attempts int32
+	}{
+		{name: "delivered", attempts: 1},
+		{name: "delivered after retry", failures: 1, attempts: 2},
+		{name: "given up", failures: 5, attempts: 2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var (
+				attempts     int32
+				logoutTokens = make(chan string, 1)
+			)
+
+			rp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&attempts, 1) <= c.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				logoutTokens <- r.PostFormValue("logout_token")
+			}))
+			t.Cleanup(rp.Close)
+
+			registry, err := client.NewStaticRegistry([]*client.Client{
+				{
+					ID:                               "foo",
+					RedirectURIs:                     []string{"https://foo.com/callback"},
+					BackChannelLogoutURI:             rp.URL + "/logout",
+					BackChannelLogoutSessionRequired: true,
+				},
+				{
+					ID:           "bar",
+					RedirectURIs: []string{"https://bar.com/callback"},
+				},
+			}, nil)
+			require.NoError(t, err)
+
+			ctx := context.Background()
+			loginSessions := memory.New(time.Minute)
+			loginSession := &authorize.LoginSession{
+				ID:        "current",
+				Sid:       "public",
+				CreatedAt: time.Now(),
+				ExpiresAt: time.Now().Add(time.Hour),
+			}
+			loginSession.Participate("foo", "alice")
+			loginSession.Participate("bar", "alice")
+			loginSession.Participate("foo", "alice")
+			require.NoError(t, loginSessions.SaveLoginSession(ctx, loginSession))
+
+			service := logout.NewService(
+				&logout.Properties{BackChannelAttempts: 2, BackChannelTimeout: time.Second},
+				&wellknown.Discovery{
+					Issuer:                           "https://tigerd.test",
+					IdTokenSigningAlgValuesSupported: []spec.SignatureAlgorithm{spec.RS256},
+				},
+				serverKeys,
+				registry,
+				loginSessions,
+				lo.ToPtr(zerolog.Nop()),
+			)
+
+			_, err = service.Logout(ctx, &logout.Request{Confirmed: true}, "current")
+			require.NoError(t, err)
+
+			if c.failures >= c.attempts {
+				assert.Eventually(t, func() bool {
+					return atomic.LoadInt32(&attempts) == c.attempts
+				}, 5*time.Second, 10*time.Millisecond)
+				return
+			}
+
+			select {
+			case logoutToken := <-logoutTokens:
+				parsed, err := jwt.ParseSigned(logoutToken)
+				require.NoError(t, err)
+				assert.Equal(t, "logout+jwt", parsed.Headers[0].ExtraHeaders["typ"])
+
+				var claims map[string]any
+				err = jose.Decode(logoutToken, jose.ExpectSignature(spec.RS256, serverKeys)).Into(&claims)
+				if assert.NoError(t, err) {
+					assert.Equal(t, "https://tigerd.test", claims["iss"])
+					assert.Equal(t, "foo", claims["aud"])
+					assert.Equal(t, "alice", claims["sub"])
+					assert.Equal(t, "public", claims["sid"])
+					assert.NotEqual(t, "current", claims["sid"], "login session cookie is never disclosed")
+					assert.Contains(t, claims["events"], "http://schemas.openid.net/event/backchannel-logout")
+					assert.NotContains(t, claims, "nonce")
+					assert.NotEmpty(t, claims["jti"])
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("logout token not delivered")
+			}
+
+			assert.Equal(t, c.attempts, atomic.LoadInt32(&attempts))
+		})
+	}
+}
+
+func TestService_Close(t *testing.T) {
+	serverKeys := jose.NewJSONWebKeySet(jose.GenerateSignatureKey("server", spec.RS256, 2048))
+
+	var attempts int32
+	rp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(rp.Close)
+
+	ctx := context.Background()
+	store := memory.New(time.Minute)
+	require.NoError(t, store.SaveRegistration(ctx, &client.Registration{
+		Client: &client.Client{
+			ID:                   "dynamic",
+			RedirectURIs:         []string{"https://dynamic.com/callback"},
+			BackChannelLogoutURI: rp.URL + "/logout",
+		},
+	}))
+
+	registry, err := client.NewRegistry([]*client.Client{
+		{
+			ID:                   "foo",
+			RedirectURIs:         []string{"https://foo.com/callback"},
+			BackChannelLogoutURI: rp.URL + "/logout",
+		},
+	}, store, nil)
+	require.NoError(t, err)
+
+	newService := func(t *testing.T, participants ...string) *logout.Service {
+		loginSession := &authorize.LoginSession{
+			ID:        "current",
+			Sid:       "public",
+			CreatedAt: time.Now(),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		for _, clientID := range participants {
+			loginSession.Participate(clientID, "alice")
+		}
+		require.NoError(t, store.SaveLoginSession(ctx, loginSession))
+
+		return logout.NewService(
+			&logout.Properties{BackChannelAttempts: 5, BackChannelTimeout: time.Second},
+			&wellknown.Discovery{
+				Issuer:                           "https://tigerd.test",
+				IdTokenSigningAlgValuesSupported: []spec.SignatureAlgorithm{spec.RS256},
+			},
+			serverKeys,
+			registry,
+			store,
+			lo.ToPtr(zerolog.Nop()),
+		)
+	}
+
+	t.Run("retries abandoned", func(t *testing.T) {
+		atomic.StoreInt32(&attempts, 0)
+		service := newService(t, "foo")
+
+		_, err := service.Logout(ctx, &logout.Request{Confirmed: true}, "current")
+		require.NoError(t, err)
+
+		assert.Eventually(t, func() bool {
+			return atomic.LoadInt32(&attempts) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		closeCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+		defer cancel()
+		assert.NoError(t, service.Close(closeCtx), "pending retries do not hold up closing")
+		assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+	})
+
+	t.Run("dynamically registered client with loopback uri", func(t *testing.T) {
+		atomic.StoreInt32(&attempts, 0)
+		service := newService(t, "dynamic")
+
+		_, err := service.Logout(ctx, &logout.Request{Confirmed: true}, "current")
+		require.NoError(t, err)
+
+		require.NoError(t, service.Close(ctx))
+		assert.Zero(t, atomic.LoadInt32(&attempts))
+	})
+}
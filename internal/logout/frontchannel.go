@@ -0,0 +1,52 @@
+package logout
+
+import (
+	"context"
+	"errors"
+	"github.com/Southclaws/fault"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/samber/lo"
+	"net/url"
+)
+
+// frontChannelLogoutURIs returns the front-channel logout uris of the participants of the terminated LoginSession, to
+// be rendered in the user agent. The iss and sid parameters are added for clients requiring them, where sid is the
+// public sid of the LoginSession, never its id.
+func (s *Service) frontChannelLogoutURIs(ctx context.Context, sid string, participants []*authorize.Participant) ([]string, error) {
+	var uris []string
+
+	clientIDs := lo.Uniq(lo.Map(participants, func(item *authorize.Participant, _ int) string {
+		return item.ClientID
+	}))
+
+	for _, clientID := range clientIDs {
+		c, err := s.clients.Find(ctx, clientID)
+		switch {
+		case errors.Is(err, client.ErrNotFound):
+			continue
+		case err != nil:
+			return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+		case len(c.FrontChannelLogoutURI) == 0:
+			continue
+		}
+
+		u, err := url.Parse(c.FrontChannelLogoutURI)
+		if err != nil {
+			return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+		}
+
+		if c.FrontChannelLogoutSessionRequired {
+			query := u.Query()
+			query.Set("iss", s.issuer)
+			query.Set("sid", sid)
+			u.RawQuery = query.Encode()
+		}
+
+		uris = append(uris, u.String())
+	}
+
+	return uris, nil
+}
@@ -0,0 +1,83 @@
+//go:build unit
+
+package logout_test
+
+import (
+	"context"
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/logout"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/storage/memory"
+	"github.com/absurdlab/tigerd/internal/wellknown"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestService_Logout_FrontChannel(t *testing.T) {
+	registry, err := client.NewStaticRegistry([]*client.Client{
+		{
+			ID:                                "foo",
+			RedirectURIs:                      []string{"https://foo.com/callback"},
+			PostLogoutRedirectURIs:            []string{"https://foo.com/logged-out"},
+			FrontChannelLogoutURI:             "https://foo.com/logout?tenant=1",
+			FrontChannelLogoutSessionRequired: true,
+		},
+		{
+			ID:                    "bar",
+			RedirectURIs:          []string{"https://bar.com/callback"},
+			FrontChannelLogoutURI: "https://bar.com/logout",
+		},
+		{
+			ID:           "baz",
+			RedirectURIs: []string{"https://baz.com/callback"},
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	loginSessions := memory.New(time.Minute)
+	loginSession := &authorize.LoginSession{
+		ID:        "current",
+		Sid:       "public",
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	loginSession.Participate("foo", "alice")
+	loginSession.Participate("foo", "bob")
+	loginSession.Participate("bar", "alice")
+	loginSession.Participate("baz", "alice")
+	require.NoError(t, loginSessions.SaveLoginSession(ctx, loginSession))
+
+	service := logout.NewService(
+		&logout.Properties{BackChannelAttempts: 1, BackChannelTimeout: time.Second},
+		&wellknown.Discovery{Issuer: "https://tigerd.test"},
+		jose.NewJSONWebKeySet(jose.GenerateSignatureKey("server", spec.RS256, 2048)),
+		registry,
+		loginSessions,
+		lo.ToPtr(zerolog.Nop()),
+	)
+
+	resp, err := service.Logout(ctx, &logout.Request{
+		ClientID:              "foo",
+		PostLogoutRedirectURI: "https://foo.com/logged-out",
+		Confirmed:             true,
+	}, "current")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://foo.com/logged-out", resp.RedirectURI)
+		assert.Equal(t, []string{
+			"https://foo.com/logout?iss=https%3A%2F%2Ftigerd.test&sid=public&tenant=1",
+			"https://bar.com/logout",
+		}, resp.FrontChannelLogoutURIs)
+	}
+
+	resp, err = service.Logout(ctx, &logout.Request{Confirmed: true}, "current")
+	if assert.NoError(t, err) {
+		assert.Empty(t, resp.FrontChannelLogoutURIs, "terminated session")
+	}
+}
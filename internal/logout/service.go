@@ -0,0 +1,306 @@
+package logout
+
+import (
+	"context"
+	"errors"
+	"github.com/Southclaws/fault"
+	"github.com/Southclaws/fault/fmsg"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/wellknown"
+	"github.com/go-jose/go-jose/v3/jwt"
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrRequest is the root error returned when the logout request is invalid.
+	ErrRequest = errors.New("invalid logout request")
+)
+
+// Properties is the configuration properties for the logout service.
+type Properties struct {
+	// BackChannelAttempts is the maximum number of attempts to deliver a logout token to a back-channel logout uri.
+	BackChannelAttempts int `json:"backchannel_attempts" yaml:"backchannel_attempts"`
+	// BackChannelTimeout is the maximum duration of each attempt to deliver a logout token.
+	BackChannelTimeout time.Duration `json:"backchannel_timeout" yaml:"backchannel_timeout"`
+}
+
+// Validate performs validation to this Properties.
+func (p *Properties) Validate() error {
+	return v.Errors{
+		"backchannel_attempts": v.Validate(p.BackChannelAttempts, v.Required, v.Min(1)),
+		"backchannel_timeout":  v.Validate(p.BackChannelTimeout, v.Required),
+	}.Filter()
+}
+
+// Request is the RP-Initiated Logout request defined in OpenID Connect RP-Initiated Logout 1.0 Section 2.
+type Request struct {
+	IDTokenHint           string `json:"id_token_hint,omitempty"`
+	ClientID              string `json:"client_id,omitempty"`
+	PostLogoutRedirectURI string `json:"post_logout_redirect_uri,omitempty"`
+	State                 string `json:"state,omitempty"`
+	// Confirmed is true when the End-User confirmed the logout, which is required unless the id_token_hint was issued
+	// within the LoginSession bound to the user agent. It is never parsed from the parameters, but set by the endpoint
+	// once the confirmation is verified.
+	Confirmed bool `json:"-"`
+}
+
+// ParseRequest parses the logout request from query or form parameters. All parameters are optional, the request is
+// checked as a whole by Service.Logout.
+func ParseRequest(values url.Values) *Request {
+	return &Request{
+		IDTokenHint:           values.Get("id_token_hint"),
+		ClientID:              values.Get("client_id"),
+		PostLogoutRedirectURI: values.Get("post_logout_redirect_uri"),
+		State:                 values.Get("state"),
+	}
+}
+
+// Response is the outcome of a logout request.
+type Response struct {
+	// RedirectURI is the post logout redirection url, including the state, to send the user agent back to the client.
+	// It is empty when the client did not request to be redirected to.
+	RedirectURI string
+	// FrontChannelLogoutURIs are the front-channel logout uris of the clients participated in the terminated
+	// LoginSession, to be rendered in the user agent before it is redirected to RedirectURI.
+	FrontChannelLogoutURIs []string
+	// ConfirmationRequired is true when nothing was terminated, as the End-User must confirm the request first.
+	ConfirmationRequired bool
+}
+
+// hint are the claims of the id_token_hint relevant to logout.
+type hint struct {
+	jwt.Claims
+	Sid string `json:"sid,omitempty"`
+}
+
+// issuedIn returns true if the hint was issued within the LoginSession, to one of its participants.
+func (h *hint) issuedIn(loginSession *authorize.LoginSession) bool {
+	return len(h.Sid) > 0 && h.Sid == loginSession.Sid && lo.ContainsBy(loginSession.Participants, func(p *authorize.Participant) bool {
+		return p.Subject == h.Subject && h.Audience.Contains(p.ClientID)
+	})
+}
+
+// NewService creates a Service which terminates the LoginSession bound to the user agent, and notifies the clients
+// participated in it.
+func NewService(
+	props *Properties,
+	discovery *wellknown.Discovery,
+	jwks *jose.JSONWebKeySet,
+	clients client.Registry,
+	loginSessions authorize.LoginSessionStore,
+	logger *zerolog.Logger,
+) *Service {
+	alg, ok := lo.Find(discovery.IdTokenSigningAlgValuesSupported, func(alg spec.SignatureAlgorithm) bool {
+		return !alg.IsNoneOrEmpty() && jwks.FindForSigning(alg) != nil
+	})
+	if !ok {
+		alg = spec.RS256
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Service{
+		ctx:           ctx,
+		cancel:        cancel,
+		static:        client.NewHTTPClient(props.BackChannelTimeout, false),
+		dynamic:       client.NewHTTPClient(props.BackChannelTimeout, true),
+		props:         props,
+		issuer:        discovery.Issuer,
+		jwks:          jwks,
+		idTokenAlg:    alg,
+		clients:       clients,
+		loginSessions: loginSessions,
+		logger:        logger,
+	}
+}
+
+// Service implements the end session endpoint defined in OpenID Connect RP-Initiated Logout 1.0.
+type Service struct {
+	// ctx is cancelled by Close to abandon the retries of back-channel deliveries, which are tracked by deliveries.
+	ctx           context.Context
+	cancel        context.CancelFunc
+	deliveries    sync.WaitGroup
+	static        *http.Client
+	dynamic       *http.Client
+	props         *Properties
+	issuer        string
+	jwks          *jose.JSONWebKeySet
+	idTokenAlg    spec.SignatureAlgorithm
+	clients       client.Registry
+	loginSessions authorize.LoginSessionStore
+	logger        *zerolog.Logger
+}
+
+// Logout terminates the End-User authentications of the LoginSession bound to the user agent by sid. The
+// id_token_hint, when present, must be issued by this server, but is accepted even if it has expired. The
+// post_logout_redirect_uri must be registered by the client identified by client_id or the audience of the
+// id_token_hint. Unless the id_token_hint was issued within the LoginSession bound to the user agent, to the same
+// subject, anyone may have sent the user agent to log out, hence the End-User must have confirmed the request, as
+// recommended by OpenID Connect RP-Initiated Logout 1.0 Section 2. Clients participated in the terminated LoginSession
+// are notified through their back-channel logout uri, and the front-channel logout uris to be rendered are returned.
+func (s *Service) Logout(ctx context.Context, req *Request, sid string) (*Response, error) {
+	var (
+		claims *hint
+		err    error
+	)
+
+	if len(req.IDTokenHint) > 0 {
+		if claims, err = s.verifyHint(ctx, req.IDTokenHint); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case len(req.ClientID) == 0:
+			req.ClientID = claims.Audience[0]
+		case !claims.Audience.Contains(req.ClientID):
+			return nil, requestError("client_id mismatch", "The client_id does not match the id_token_hint.")
+		}
+	}
+
+	resp := new(Response)
+
+	if len(req.PostLogoutRedirectURI) > 0 {
+		if len(req.ClientID) == 0 {
+			return nil, requestError(
+				"post_logout_redirect_uri without client",
+				"The post_logout_redirect_uri requires client_id or id_token_hint.",
+			)
+		}
+
+		c, err := s.client(ctx, req.ClientID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !c.AllowsPostLogoutRedirectURI(req.PostLogoutRedirectURI) {
+			return nil, requestError(
+				"post_logout_redirect_uri not registered",
+				"The post_logout_redirect_uri is not registered by the client.",
+			)
+		}
+
+		if resp.RedirectURI, err = redirectURI(req.PostLogoutRedirectURI, req.State); err != nil {
+			return nil, err
+		}
+	}
+
+	loginSession, err := s.loginSession(ctx, sid)
+	if err != nil {
+		return nil, err
+	}
+	if loginSession == nil {
+		return resp, nil
+	}
+
+	if !req.Confirmed && (claims == nil || !claims.issuedIn(loginSession)) {
+		resp.ConfirmationRequired = true
+		return resp, nil
+	}
+
+	if err = s.loginSessions.DeleteLoginSession(ctx, loginSession.ID); err != nil {
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	s.backChannelLogout(loginSession.Sid, loginSession.Participants)
+
+	if resp.FrontChannelLogoutURIs, err = s.frontChannelLogoutURIs(ctx, loginSession.Sid, loginSession.Participants); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// loginSession returns the LoginSession bound to the user agent by sid, or nil if it does not exist or has expired.
+func (s *Service) loginSession(ctx context.Context, sid string) (*authorize.LoginSession, error) {
+	if len(sid) == 0 {
+		return nil, nil
+	}
+
+	loginSession, err := s.loginSessions.GetLoginSession(ctx, sid)
+	switch {
+	case errors.Is(err, authorize.ErrLoginSessionNotFound):
+		return nil, nil
+	case err != nil:
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	return loginSession, nil
+}
+
+// verifyHint verifies the signature and the issuer of the id_token_hint. The expiry is not checked, as the hint is
+// commonly presented after the id_token expires.
+func (s *Service) verifyHint(ctx context.Context, idTokenHint string) (*hint, error) {
+	peeked := new(hint)
+	if err := jose.Decode(idTokenHint, jose.PeekOnly()).Into(peeked); err != nil || len(peeked.Audience) == 0 {
+		return nil, hintError("id_token_hint malformed")
+	}
+
+	c, err := s.client(ctx, peeked.Audience[0])
+	if err != nil {
+		return nil, err
+	}
+
+	alg := c.IDTokenSignedResponseAlg
+	if alg.IsNoneOrEmpty() {
+		alg = s.idTokenAlg
+	}
+
+	claims := new(hint)
+	if err = jose.Decode(idTokenHint, jose.ExpectSignature(alg, s.jwks)).Into(claims); err != nil {
+		return nil, hintError("id_token_hint signature invalid")
+	}
+
+	if claims.Issuer != s.issuer {
+		return nil, hintError("id_token_hint issuer mismatch")
+	}
+
+	return claims, nil
+}
+
+func (s *Service) client(ctx context.Context, id string) (*client.Client, error) {
+	c, err := s.clients.Find(ctx, id)
+	switch {
+	case err == nil:
+		return c, nil
+	case errors.Is(err, client.ErrNotFound):
+		return nil, requestError("client not found", "The client_id is not registered.")
+	default:
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+}
+
+func redirectURI(postLogoutRedirectURI string, state string) (string, error) {
+	u, err := url.Parse(postLogoutRedirectURI)
+	if err != nil {
+		return "", fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	if len(state) > 0 {
+		query := u.Query()
+		query.Set("state", state)
+		u.RawQuery = query.Encode()
+	}
+
+	return u.String(), nil
+}
+
+func requestError(message string, description string) error {
+	return fault.Wrap(ErrRequest,
+		ftag.With(spec.ErrKindInvalidRequest),
+		fmsg.WithDesc(message, description),
+	)
+}
+
+func hintError(message string) error {
+	return requestError(message, "The id_token_hint is invalid.")
+}
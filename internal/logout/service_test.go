@@ -0,0 +1,201 @@
+//go:build unit
+
+package logout_test
+
+import (
+	"context"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/logout"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/storage/memory"
+	"github.com/absurdlab/tigerd/internal/wellknown"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestService_Logout(t *testing.T) {
+	var (
+		serverKeys = jose.NewJSONWebKeySet(jose.GenerateSignatureKey("server", spec.RS256, 2048))
+		otherKeys  = jose.NewJSONWebKeySet(jose.GenerateSignatureKey("server", spec.RS256, 2048))
+	)
+
+	registry, err := client.NewStaticRegistry([]*client.Client{
+		{
+			ID:                     "foo",
+			RedirectURIs:           []string{"https://foo.com/callback"},
+			PostLogoutRedirectURIs: []string{"https://foo.com/logged-out"},
+		},
+		{
+			ID:           "bar",
+			RedirectURIs: []string{"https://bar.com/callback"},
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	idToken := func(keys *jose.JSONWebKeySet, hook func(claims map[string]any)) string {
+		claims := map[string]any{
+			"iss": "https://tigerd.test",
+			"sub": "alice",
+			"aud": "foo",
+			"sid": "public-current",
+			"iat": time.Now().Add(-2 * time.Hour).Unix(),
+			"exp": time.Now().Add(-time.Hour).Unix(),
+		}
+		if hook != nil {
+			hook(claims)
+		}
+		token, err := jose.Encode(claims, jose.WithSignature(spec.RS256, keys))
+		require.NoError(t, err)
+		return token
+	}
+
+	cases := []struct {
+		name       string
+		req        *logout.Request
+		expect     ftag.Kind
+		redirectTo string
+		confirm    bool
+		remaining  []string
+	}{
+		{
+			name:      "without parameters",
+			req:       &logout.Request{},
+			confirm:   true,
+			remaining: []string{"current", "other"},
+		},
+		{
+			name:      "confirmed without parameters",
+			req:       &logout.Request{Confirmed: true},
+			remaining: []string{"other"},
+		},
+		{
+			name:       "expired id_token_hint with redirect",
+			req:        &logout.Request{IDTokenHint: idToken(serverKeys, nil), PostLogoutRedirectURI: "https://foo.com/logged-out", State: "xyz"},
+			redirectTo: "https://foo.com/logged-out?state=xyz",
+			remaining:  []string{"other"},
+		},
+		{
+			name: "id_token_hint of another login session",
+			req: &logout.Request{IDTokenHint: idToken(serverKeys, func(claims map[string]any) {
+				claims["sid"] = "public-other"
+			})},
+			confirm:   true,
+			remaining: []string{"current", "other"},
+		},
+		{
+			name: "id_token_hint of another subject",
+			req: &logout.Request{IDTokenHint: idToken(serverKeys, func(claims map[string]any) {
+				claims["sub"] = "mallory"
+			})},
+			confirm:   true,
+			remaining: []string{"current", "other"},
+		},
+		{
+			name: "id_token_hint without sid",
+			req: &logout.Request{IDTokenHint: idToken(serverKeys, func(claims map[string]any) {
+				delete(claims, "sid")
+			})},
+			confirm:   true,
+			remaining: []string{"current", "other"},
+		},
+		{
+			name: "confirmed id_token_hint of another login session",
+			req: &logout.Request{IDTokenHint: idToken(serverKeys, func(claims map[string]any) {
+				claims["sid"] = "public-other"
+			}), Confirmed: true},
+			remaining: []string{"other"},
+		},
+		{
+			name:       "client_id with redirect",
+			req:        &logout.Request{ClientID: "foo", PostLogoutRedirectURI: "https://foo.com/logged-out", Confirmed: true},
+			redirectTo: "https://foo.com/logged-out",
+			remaining:  []string{"other"},
+		},
+		{
+			name:      "redirect without client",
+			req:       &logout.Request{PostLogoutRedirectURI: "https://foo.com/logged-out"},
+			expect:    spec.ErrKindInvalidRequest,
+			remaining: []string{"current", "other"},
+		},
+		{
+			name:      "unregistered redirect",
+			req:       &logout.Request{ClientID: "bar", PostLogoutRedirectURI: "https://foo.com/logged-out"},
+			expect:    spec.ErrKindInvalidRequest,
+			remaining: []string{"current", "other"},
+		},
+		{
+			name:      "client_id mismatch",
+			req:       &logout.Request{IDTokenHint: idToken(serverKeys, nil), ClientID: "bar"},
+			expect:    spec.ErrKindInvalidRequest,
+			remaining: []string{"current", "other"},
+		},
+		{
+			name:      "id_token_hint signed by unknown key",
+			req:       &logout.Request{IDTokenHint: idToken(otherKeys, nil)},
+			expect:    spec.ErrKindInvalidRequest,
+			remaining: []string{"current", "other"},
+		},
+		{
+			name: "id_token_hint from another issuer",
+			req: &logout.Request{IDTokenHint: idToken(serverKeys, func(claims map[string]any) {
+				claims["iss"] = "https://elsewhere.test"
+			})},
+			expect:    spec.ErrKindInvalidRequest,
+			remaining: []string{"current", "other"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			loginSessions := memory.New(time.Minute)
+			for _, id := range []string{"current", "other"} {
+				loginSession := &authorize.LoginSession{
+					ID:        id,
+					Sid:       "public-" + id,
+					CreatedAt: time.Now(),
+					ExpiresAt: time.Now().Add(time.Hour),
+				}
+				loginSession.Participate("foo", "alice")
+				require.NoError(t, loginSessions.SaveLoginSession(ctx, loginSession))
+			}
+
+			service := logout.NewService(
+				&logout.Properties{BackChannelAttempts: 1, BackChannelTimeout: time.Second},
+				&wellknown.Discovery{
+					Issuer:                           "https://tigerd.test",
+					IdTokenSigningAlgValuesSupported: []spec.SignatureAlgorithm{spec.RS256},
+				},
+				serverKeys,
+				registry,
+				loginSessions,
+				lo.ToPtr(zerolog.Nop()),
+			)
+
+			resp, err := service.Logout(ctx, c.req, "current")
+			if len(c.expect) > 0 {
+				assert.Equal(t, c.expect, ftag.Get(err))
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, c.redirectTo, resp.RedirectURI)
+				assert.Equal(t, c.confirm, resp.ConfirmationRequired)
+			}
+
+			for _, id := range []string{"current", "other"} {
+				_, err := loginSessions.GetLoginSession(ctx, id)
+				if lo.Contains(c.remaining, id) {
+					assert.NoError(t, err, id)
+				} else {
+					assert.ErrorIs(t, err, authorize.ErrLoginSessionNotFound, id)
+				}
+			}
+		})
+	}
+}
@@ -138,3 +138,19 @@ func (r *UrlRule) error(message string) error {
 	}
 	return errors.New(message)
 }
+
+// AbsoluteURL is a validation rule function, to be used with validation.By, to check if the string value is an
+// absolute url. It ignores any empty or non-string value.
+func AbsoluteURL(value any) error {
+	raw, _ := value.(string)
+	if len(raw) == 0 {
+		return nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() {
+		return errors.New("must be an absolute url")
+	}
+
+	return nil
+}
@@ -26,16 +26,21 @@ const (
 	ErrKindSelectAccountRequired    ftag.Kind = "account_selection_required"
 	ErrKindConsentRequired          ftag.Kind = "consent_required"
 	ErrKindInteractionRequired      ftag.Kind = "interaction_required"
+	ErrKindInvalidRedirectURI       ftag.Kind = "invalid_redirect_uri"
+	ErrKindInvalidClientMetadata    ftag.Kind = "invalid_client_metadata"
+	ErrKindInvalidToken             ftag.Kind = "invalid_token"
+	ErrKindUnsupportedTokenType     ftag.Kind = "unsupported_token_type"
 	ErrKindServerError              ftag.Kind = "server_error"
 )
 
 // GetErrorKind extracts the closest ftag.Kind tagged on the error. If not tagged, defaults to ErrKindServerError.
 func GetErrorKind(err error) ftag.Kind {
-	kind := ftag.Get(err)
-	if len(kind) == 0 {
+	switch kind := ftag.Get(err); kind {
+	case ftag.None, ftag.Internal:
 		return ErrKindServerError
+	default:
+		return kind
 	}
-	return kind
 }
 
 // GetErrorStatus returns the corresponding HTTP status code to the tagged ftag.Kind.
@@ -55,9 +60,12 @@ func GetErrorStatus(kind ftag.Kind) int {
 		ErrKindLoginRequired,
 		ErrKindSelectAccountRequired,
 		ErrKindConsentRequired,
-		ErrKindInteractionRequired:
+		ErrKindInteractionRequired,
+		ErrKindInvalidRedirectURI,
+		ErrKindInvalidClientMetadata,
+		ErrKindUnsupportedTokenType:
 		return 400
-	case ErrKindInvalidClient:
+	case ErrKindInvalidClient, ErrKindInvalidToken:
 		return 401
 	case ErrKindAccessDenied, ErrKindInsufficientScope:
 		return 403
@@ -97,7 +105,7 @@ func GetErrorMessage(err error) string {
 	case ErrKindInsufficientScope:
 		return "The protected resource requires one or more scopes that exceeds the extent of grant."
 	case ErrKindAccessDenied:
-		return "he resource owner or authorization server denied the request."
+		return "The resource owner or authorization server denied the request."
 	case ErrKindInvalidRequestURI:
 		return "The request_uri in the Authorization Request returns an error or contains invalid data."
 	case ErrKindInvalidRequestObject:
@@ -118,6 +126,14 @@ func GetErrorMessage(err error) string {
 		return "The Authorization Server requires End-User consent."
 	case ErrKindInteractionRequired:
 		return "The Authorization Server requires End-User interaction of some form to proceed."
+	case ErrKindInvalidRedirectURI:
+		return "The value of one or more redirection URIs is invalid."
+	case ErrKindInvalidClientMetadata:
+		return "The value of one of the client metadata fields is invalid."
+	case ErrKindInvalidToken:
+		return "The access token provided is expired, revoked, malformed, or invalid for other reasons."
+	case ErrKindUnsupportedTokenType:
+		return "The authorization server does not support the revocation of the presented token type."
 	case ErrKindServerError:
 		return "The authorization server encountered an unexpected condition that prevented it from fulfilling the request."
 	default:
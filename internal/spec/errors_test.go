@@ -0,0 +1,43 @@
+package spec_test
+
+import (
+	"errors"
+	"github.com/Southclaws/fault"
+	"github.com/Southclaws/fault/fmsg"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGetErrorKind(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    error
+		expect ftag.Kind
+	}{
+		{
+			name:   "tagged",
+			err:    fault.Wrap(errors.New("test"), ftag.With(spec.ErrKindInvalidGrant)),
+			expect: spec.ErrKindInvalidGrant,
+		},
+		{
+			name:   "tagged deep in chain",
+			err:    fault.Wrap(fault.Wrap(errors.New("test"), ftag.With(spec.ErrKindInvalidGrant)), fmsg.With("wrapped")),
+			expect: spec.ErrKindInvalidGrant,
+		},
+		{
+			name:   "not tagged",
+			err:    errors.New("test"),
+			expect: spec.ErrKindServerError,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			kind := spec.GetErrorKind(c.err)
+			assert.Equal(t, c.expect, kind)
+			assert.NotPanics(t, func() { spec.GetErrorStatus(kind) })
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package spec
+
+import (
+	"encoding/json"
+)
+
+// Parse parses a plain parameter value, as it appears in query or form parameters, into the destination type whose
+// JSON representation is a string. This allows the types in this package to share the same parsing logic for both
+// JSON and form encoded requests.
+func Parse(value string, dest json.Unmarshaler) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return dest.UnmarshalJSON(raw)
+}
@@ -8,20 +8,81 @@ import (
 const (
 	ResponseModeQuery ResponseMode = 1 << iota
 	ResponseModeFragment
+	ResponseModeFormPost
+	ResponseModeQueryJWT
+	ResponseModeFragmentJWT
+	ResponseModeFormPostJWT
+	ResponseModeJWT
 
-	responseModeQuery    = "query"
-	responseModeFragment = "fragment"
+	responseModeQuery       = "query"
+	responseModeFragment    = "fragment"
+	responseModeFormPost    = "form_post"
+	responseModeQueryJWT    = "query.jwt"
+	responseModeFragmentJWT = "fragment.jwt"
+	responseModeFormPostJWT = "form_post.jwt"
+	responseModeJWT         = "jwt"
 )
 
-// ResponseMode represents response_mode parameter in OpenID Connect 1.0.
+// ResponseMode represents response_mode parameter in OpenID Connect 1.0, including form_post defined in OAuth 2.0 Form
+// Post Response Mode, and the JWT response modes defined in JWT Secured Authorization Response Mode for OAuth 2.0.
 type ResponseMode uint8
 
+// IsJWT returns true if the ResponseMode delivers the authorization response as a JWT.
+func (m ResponseMode) IsJWT() bool {
+	switch m {
+	case ResponseModeQueryJWT, ResponseModeFragmentJWT, ResponseModeFormPostJWT, ResponseModeJWT:
+		return true
+	default:
+		return false
+	}
+}
+
+// ToJWT returns the JWT variant of the ResponseMode, which delivers the authorization response as a JWT in the same
+// way. The generic jwt mode, and modes which are JWT variants already, are returned as is.
+func (m ResponseMode) ToJWT() ResponseMode {
+	switch m {
+	case ResponseModeQuery:
+		return ResponseModeQueryJWT
+	case ResponseModeFragment:
+		return ResponseModeFragmentJWT
+	case ResponseModeFormPost:
+		return ResponseModeFormPostJWT
+	default:
+		return m
+	}
+}
+
+// Plain returns the ResponseMode which delivers the parameters in the same way as the ResponseMode, without the JWT
+// wrapping. The generic jwt mode has no plain variant, and is returned as is.
+func (m ResponseMode) Plain() ResponseMode {
+	switch m {
+	case ResponseModeQueryJWT:
+		return ResponseModeQuery
+	case ResponseModeFragmentJWT:
+		return ResponseModeFragment
+	case ResponseModeFormPostJWT:
+		return ResponseModeFormPost
+	default:
+		return m
+	}
+}
+
 func (m ResponseMode) String() string {
 	switch m {
 	case ResponseModeQuery:
 		return responseModeQuery
 	case ResponseModeFragment:
 		return responseModeFragment
+	case ResponseModeFormPost:
+		return responseModeFormPost
+	case ResponseModeQueryJWT:
+		return responseModeQueryJWT
+	case ResponseModeFragmentJWT:
+		return responseModeFragmentJWT
+	case ResponseModeFormPostJWT:
+		return responseModeFormPostJWT
+	case ResponseModeJWT:
+		return responseModeJWT
 	default:
 		return ""
 	}
@@ -42,6 +103,16 @@ func (m *ResponseMode) UnmarshalJSON(bytes []byte) error {
 		*m = ResponseModeQuery
 	case responseModeFragment:
 		*m = ResponseModeFragment
+	case responseModeFormPost:
+		*m = ResponseModeFormPost
+	case responseModeQueryJWT:
+		*m = ResponseModeQueryJWT
+	case responseModeFragmentJWT:
+		*m = ResponseModeFragmentJWT
+	case responseModeFormPostJWT:
+		*m = ResponseModeFormPostJWT
+	case responseModeJWT:
+		*m = ResponseModeJWT
 	default:
 		return fmt.Errorf("invalid value for spec.ResponseMode [%s]", value)
 	}
@@ -0,0 +1,77 @@
+package spec_test
+
+import (
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestResponseMode_JWT(t *testing.T) {
+	cases := []struct {
+		value string
+		mode  spec.ResponseMode
+		isJWT bool
+		toJWT spec.ResponseMode
+		plain spec.ResponseMode
+	}{
+		{
+			value: "query",
+			mode:  spec.ResponseModeQuery,
+			toJWT: spec.ResponseModeQueryJWT,
+			plain: spec.ResponseModeQuery,
+		},
+		{
+			value: "fragment",
+			mode:  spec.ResponseModeFragment,
+			toJWT: spec.ResponseModeFragmentJWT,
+			plain: spec.ResponseModeFragment,
+		},
+		{
+			value: "form_post",
+			mode:  spec.ResponseModeFormPost,
+			toJWT: spec.ResponseModeFormPostJWT,
+			plain: spec.ResponseModeFormPost,
+		},
+		{
+			value: "query.jwt",
+			mode:  spec.ResponseModeQueryJWT,
+			isJWT: true,
+			toJWT: spec.ResponseModeQueryJWT,
+			plain: spec.ResponseModeQuery,
+		},
+		{
+			value: "fragment.jwt",
+			mode:  spec.ResponseModeFragmentJWT,
+			isJWT: true,
+			toJWT: spec.ResponseModeFragmentJWT,
+			plain: spec.ResponseModeFragment,
+		},
+		{
+			value: "form_post.jwt",
+			mode:  spec.ResponseModeFormPostJWT,
+			isJWT: true,
+			toJWT: spec.ResponseModeFormPostJWT,
+			plain: spec.ResponseModeFormPost,
+		},
+		{
+			value: "jwt",
+			mode:  spec.ResponseModeJWT,
+			isJWT: true,
+			toJWT: spec.ResponseModeJWT,
+			plain: spec.ResponseModeJWT,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.value, func(t *testing.T) {
+			var mode spec.ResponseMode
+			if assert.NoError(t, spec.Parse(c.value, &mode)) {
+				assert.Equal(t, c.mode, mode)
+				assert.Equal(t, c.value, mode.String())
+			}
+			assert.Equal(t, c.isJWT, c.mode.IsJWT())
+			assert.Equal(t, c.toJWT, c.mode.ToJWT())
+			assert.Equal(t, c.plain, c.mode.Plain())
+		})
+	}
+}
@@ -83,6 +83,16 @@ func (s ResponseTypeSet) AddValues(value ...string) (ResponseTypeSet, error) {
 	return v, nil
 }
 
+// DefaultResponseMode returns the response mode used when no response_mode is requested, as defined in OAuth 2.0
+// Multiple Response Type Encoding Practices: query for the code response type, and fragment for response types that
+// issue tokens from the authorization endpoint.
+func (s ResponseTypeSet) DefaultResponseMode() ResponseMode {
+	if s.Contains(ResponseTypeToken) || s.Contains(ResponseTypeIDToken) {
+		return ResponseModeFragment
+	}
+	return ResponseModeQuery
+}
+
 func (s ResponseTypeSet) MarshalJSON() ([]byte, error) {
 	if s == 0 {
 		return nil, nil
@@ -66,3 +66,38 @@ func TestResponseTypeSet_MarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestResponseTypeSet_DefaultResponseMode(t *testing.T) {
+	cases := []struct {
+		name   string
+		set    spec.ResponseTypeSet
+		expect spec.ResponseMode
+	}{
+		{
+			name:   "code",
+			set:    spec.ResponseTypeCode.ToSet(),
+			expect: spec.ResponseModeQuery,
+		},
+		{
+			name:   "implicit",
+			set:    spec.ResponseTypeSet(0).Add(spec.ResponseTypeIDToken, spec.ResponseTypeToken),
+			expect: spec.ResponseModeFragment,
+		},
+		{
+			name:   "hybrid",
+			set:    spec.ResponseTypeSet(0).Add(spec.ResponseTypeCode, spec.ResponseTypeIDToken),
+			expect: spec.ResponseModeFragment,
+		},
+		{
+			name:   "none",
+			set:    0,
+			expect: spec.ResponseModeQuery,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expect, c.set.DefaultResponseMode())
+		})
+	}
+}
@@ -6,4 +6,16 @@ const (
 	ScopeProfile       = "profile"
 	ScopeEmail         = "email"
 	ScopeAddress       = "address"
+	ScopePhone         = "phone"
 )
+
+// ScopeClaims maps the scopes defined in OpenID Connect Core 1.0 Section 5.4 to the standard claims they request.
+var ScopeClaims = map[string][]string{
+	ScopeProfile: {
+		"name", "family_name", "given_name", "middle_name", "nickname", "preferred_username", "profile", "picture",
+		"website", "gender", "birthdate", "zoneinfo", "locale", "updated_at",
+	},
+	ScopeEmail:   {"email", "email_verified"},
+	ScopeAddress: {"address"},
+	ScopePhone:   {"phone_number", "phone_number_verified"},
+}
@@ -0,0 +1,450 @@
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/storage"
+	"github.com/absurdlab/tigerd/internal/token"
+	"go.etcd.io/bbolt"
+	"sync"
+	"time"
+)
+
+var _ storage.Interface = (*Storage)(nil)
+
+// Open opens, or creates, the database file at path, migrates its schema, and evicts expired records every
+// sweepInterval. Expired records are never returned, even before they are evicted.
+func Open(path string, sweepInterval time.Duration) (*Storage, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	s := &Storage{
+		db:   db,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	go s.sweepEvery(sweepInterval)
+
+	return s, nil
+}
+
+// Storage is the storage backend that keeps all records in a bbolt database file. It survives restarts, but the file
+// can only be opened by a single process at a time.
+type Storage struct {
+	db       *bbolt.DB
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// record is the stored form of every value.
+type record struct {
+	Value json.RawMessage `json:"value,omitempty"`
+	// Family groups the tokens which are deleted together.
+	Family string `json:"family,omitempty"`
+	// ExpiresAt is the moment the record expires. A zero value means the record never expires.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (r *record) isExpired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && now.After(r.ExpiresAt)
+}
+
+func (s *Storage) SaveSession(_ context.Context, session *authorize.Session) error {
+	return s.put(bucketSessions, session.ID, session, "", session.ExpiresAt)
+}
+
+func (s *Storage) GetSession(_ context.Context, id string) (*authorize.Session, error) {
+	session := new(authorize.Session)
+	if err := s.get(bucketSessions, id, session, authorize.ErrSessionNotFound); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *Storage) ClaimSession(_ context.Context, id string) (*authorize.Session, error) {
+	session := new(authorize.Session)
+
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketSessions)
+
+		r, err := readRecord(b, id)
+		if err != nil {
+			return err
+		}
+		if r == nil || r.isExpired(time.Now()) {
+			return authorize.ErrSessionNotFound
+		}
+
+		if err := json.Unmarshal(r.Value, session); err != nil {
+			return err
+		}
+		if err := session.Claim(); err != nil {
+			return err
+		}
+
+		if r.Value, err = json.Marshal(session); err != nil {
+			return err
+		}
+
+		return writeRecord(b, id, r)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (s *Storage) DeleteSession(_ context.Context, id string) error {
+	return s.delete(bucketSessions, id)
+}
+
+func (s *Storage) SaveLoginSession(_ context.Context, session *authorize.LoginSession) error {
+	if len(session.Sid) > 0 {
+		if err := s.put(bucketLoginSids, session.Sid, session.ID, "", session.ExpiresAt); err != nil {
+			return err
+		}
+	}
+	return s.put(bucketLoginSessions, session.ID, session, "", session.ExpiresAt)
+}
+
+func (s *Storage) GetLoginSession(_ context.Context, id string) (*authorize.LoginSession, error) {
+	session := new(authorize.LoginSession)
+	if err := s.get(bucketLoginSessions, id, session, authorize.ErrLoginSessionNotFound); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *Storage) GetLoginSessionBySid(ctx context.Context, sid string) (*authorize.LoginSession, error) {
+	var id string
+	if err := s.get(bucketLoginSids, sid, &id, authorize.ErrLoginSessionNotFound); err != nil {
+		return nil, err
+	}
+	return s.GetLoginSession(ctx, id)
+}
+
+// DeleteLoginSession removes the login session. Its sid index expires along with it, and resolves to nothing meanwhile.
+func (s *Storage) DeleteLoginSession(_ context.Context, id string) error {
+	return s.delete(bucketLoginSessions, id)
+}
+
+func (s *Storage) SaveGrant(_ context.Context, grant *authorize.Grant) error {
+	return s.put(bucketGrants, grantKey(grant.ClientID, grant.Subject), grant, "", grant.ExpiresAt)
+}
+
+func (s *Storage) GetGrant(_ context.Context, clientID string, subject string) (*authorize.Grant, error) {
+	grant := new(authorize.Grant)
+	if err := s.get(bucketGrants, grantKey(clientID, subject), grant, authorize.ErrGrantNotFound); err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
+
+func (s *Storage) DeleteGrant(_ context.Context, clientID string, subject string) error {
+	return s.delete(bucketGrants, grantKey(clientID, subject))
+}
+
+func (s *Storage) SaveCode(_ context.Context, code *token.Code) error {
+	return s.put(bucketCodes, code.Value, code, "", code.ExpiresAt)
+}
+
+func (s *Storage) RedeemCode(_ context.Context, value string) (*token.Code, error) {
+	var (
+		code     = new(token.Code)
+		redeemed bool
+	)
+
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketCodes)
+
+		r, err := readRecord(b, value)
+		if err != nil {
+			return err
+		}
+		if r == nil || r.isExpired(time.Now()) {
+			return token.ErrCodeNotFound
+		}
+
+		if err := json.Unmarshal(r.Value, code); err != nil {
+			return err
+		}
+
+		// Replays are reported after the transaction, which must not fail as nothing needs to be rolled back.
+		if code.Redeemed {
+			redeemed = true
+			return nil
+		}
+
+		code.Redeemed = true
+
+		if r.Value, err = json.Marshal(code); err != nil {
+			return err
+		}
+
+		return writeRecord(b, value, r)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if redeemed {
+		return code, token.ErrCodeRedeemed
+	}
+
+	return code, nil
+}
+
+func (s *Storage) SaveAccessToken(_ context.Context, accessToken *token.AccessToken) error {
+	return s.put(bucketAccessTokens, accessToken.Value, accessToken, accessToken.Family, accessToken.ExpiresAt)
+}
+
+func (s *Storage) GetAccessToken(_ context.Context, value string) (*token.AccessToken, error) {
+	accessToken := new(token.AccessToken)
+	if err := s.get(bucketAccessTokens, value, accessToken, token.ErrAccessTokenNotFound); err != nil {
+		return nil, err
+	}
+	return accessToken, nil
+}
+
+func (s *Storage) DeleteAccessToken(_ context.Context, value string) error {
+	return s.delete(bucketAccessTokens, value)
+}
+
+func (s *Storage) DeleteAccessTokenFamily(_ context.Context, family string) error {
+	return s.deleteFamily(bucketAccessTokens, family)
+}
+
+func (s *Storage) SaveRefreshToken(_ context.Context, refreshToken *token.RefreshToken) error {
+	return s.put(bucketRefreshTokens, refreshToken.Value, refreshToken, refreshToken.Family, refreshToken.ExpiresAt)
+}
+
+func (s *Storage) GetRefreshToken(_ context.Context, value string) (*token.RefreshToken, error) {
+	refreshToken := new(token.RefreshToken)
+	if err := s.get(bucketRefreshTokens, value, refreshToken, token.ErrRefreshTokenNotFound); err != nil {
+		return nil, err
+	}
+	return refreshToken, nil
+}
+
+func (s *Storage) UseRefreshToken(_ context.Context, value string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketRefreshTokens)
+
+		r, err := readRecord(b, value)
+		if err != nil {
+			return err
+		}
+		if r == nil || r.isExpired(time.Now()) {
+			return token.ErrRefreshTokenNotFound
+		}
+
+		refreshToken := new(token.RefreshToken)
+		if err := json.Unmarshal(r.Value, refreshToken); err != nil {
+			return err
+		}
+		if refreshToken.Used {
+			return token.ErrRefreshTokenReused
+		}
+
+		refreshToken.Used = true
+
+		if r.Value, err = json.Marshal(refreshToken); err != nil {
+			return err
+		}
+
+		return writeRecord(b, value, r)
+	})
+}
+
+func (s *Storage) DeleteRefreshTokenFamily(_ context.Context, family string) error {
+	return s.deleteFamily(bucketRefreshTokens, family)
+}
+
+func (s *Storage) SaveRegistration(_ context.Context, registration *client.Registration) error {
+	return s.put(bucketRegistrations, registration.Client.ID, registration, "", time.Time{})
+}
+
+func (s *Storage) GetRegistration(_ context.Context, clientID string) (*client.Registration, error) {
+	registration := new(client.Registration)
+	if err := s.get(bucketRegistrations, clientID, registration, client.ErrNotFound); err != nil {
+		return nil, err
+	}
+	return registration, nil
+}
+
+func (s *Storage) DeleteRegistration(_ context.Context, clientID string) error {
+	return s.delete(bucketRegistrations, clientID)
+}
+
+func (s *Storage) SaveAssertionID(_ context.Context, id string, expiresAt time.Time) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketAssertions)
+
+		r, err := readRecord(b, id)
+		if err != nil {
+			return err
+		}
+		if r != nil && !r.isExpired(time.Now()) {
+			return client.ErrAssertionReplayed
+		}
+
+		return writeRecord(b, id, &record{ExpiresAt: expiresAt})
+	})
+}
+
+// Close stops evicting expired records and closes the database file.
+func (s *Storage) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
+	return s.db.Close()
+}
+
+func (s *Storage) put(bucket []byte, key string, value any, family string, expiresAt time.Time) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return writeRecord(tx.Bucket(bucket), key, &record{Value: raw, Family: family, ExpiresAt: expiresAt})
+	})
+}
+
+// get decodes the unexpired record by its key into dest, or returns notFound.
+func (s *Storage) get(bucket []byte, key string, dest any, notFound error) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		r, err := readRecord(tx.Bucket(bucket), key)
+		if err != nil {
+			return err
+		}
+		if r == nil || r.isExpired(time.Now()) {
+			return notFound
+		}
+
+		return json.Unmarshal(r.Value, dest)
+	})
+}
+
+func (s *Storage) delete(bucket []byte, key string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucket).Delete([]byte(key))
+	})
+}
+
+func (s *Storage) deleteFamily(bucket []byte, family string) error {
+	return s.deleteWhere(bucket, func(r *record) bool {
+		return r.Family == family
+	})
+}
+
+// deleteWhere deletes all records in the bucket that match the predicate.
+func (s *Storage) deleteWhere(bucket []byte, predicate func(r *record) bool) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucket)
+
+		var keys [][]byte
+		if err := b.ForEach(func(k, raw []byte) error {
+			r := new(record)
+			if err := json.Unmarshal(raw, r); err != nil {
+				return err
+			}
+			if predicate(r) {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *Storage) sweepEvery(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_ = s.sweep()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// sweep evicts all expired records.
+func (s *Storage) sweep() error {
+	now := time.Now()
+
+	for _, bucket := range [][]byte{
+		bucketSessions,
+		bucketLoginSessions,
+		bucketLoginSids,
+		bucketGrants,
+		bucketCodes,
+		bucketAccessTokens,
+		bucketRefreshTokens,
+		bucketRegistrations,
+		bucketAssertions,
+	} {
+		if err := s.deleteWhere(bucket, func(r *record) bool {
+			return r.isExpired(now)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readRecord returns the record by its key, or nil if it does not exist.
+func readRecord(b *bbolt.Bucket, key string) (*record, error) {
+	raw := b.Get([]byte(key))
+	if raw == nil {
+		return nil, nil
+	}
+
+	r := new(record)
+	if err := json.Unmarshal(raw, r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func writeRecord(b *bbolt.Bucket, key string, r *record) error {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), raw)
+}
+
+// grantKey returns the key of the grant of the subject to the client. The NUL separator never appears in either part.
+func grantKey(clientID string, subject string) string {
+	return clientID + "\x00" + subject
+}
@@ -0,0 +1,88 @@
+//go:build unit
+
+package bolt
+
+import (
+	"context"
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/storage"
+	"github.com/absurdlab/tigerd/internal/storage/storagetest"
+	"github.com/absurdlab/tigerd/internal/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Interface {
+		s, err := Open(filepath.Join(t.TempDir(), "tigerd.db"), time.Minute)
+		require.NoError(t, err)
+		return s
+	})
+}
+
+func TestStorage_reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tigerd.db")
+	ctx := context.Background()
+
+	s, err := Open(path, time.Minute)
+	require.NoError(t, err)
+
+	code := token.NewCode(token.Authorization{ClientID: "foo", Subject: "alice"}, "https://foo.com/callback", time.Minute)
+	require.NoError(t, s.SaveCode(ctx, code))
+	require.NoError(t, s.Close())
+
+	s, err = Open(path, time.Minute)
+	require.NoError(t, err)
+	defer s.Close()
+
+	redeemed, err := s.RedeemCode(ctx, code.Value)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alice", redeemed.Subject)
+	}
+
+	version, err := schemaVersion(s.db)
+	if assert.NoError(t, err) {
+		assert.Equal(t, len(migrations), version)
+	}
+}
+
+func TestStorage_newerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tigerd.db")
+
+	s, err := Open(path, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketMeta).Put(keySchemaVersion, []byte{0, 0, 0, 0, 0, 0, 0, 99})
+	}))
+	require.NoError(t, s.Close())
+
+	_, err = Open(path, time.Minute)
+	assert.Error(t, err)
+}
+
+func TestStorage_sweep(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "tigerd.db"), time.Hour)
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := context.Background()
+	require.NoError(t, s.SaveLoginSession(ctx, &authorize.LoginSession{ID: "expired", ExpiresAt: time.Now().Add(-time.Second)}))
+	require.NoError(t, s.SaveLoginSession(ctx, &authorize.LoginSession{ID: "valid", ExpiresAt: time.Now().Add(time.Hour)}))
+	require.NoError(t, s.SaveGrant(ctx, &authorize.Grant{ClientID: "foo", Subject: "alice"}))
+
+	require.NoError(t, s.sweep())
+
+	var count int
+	require.NoError(t, s.db.View(func(tx *bbolt.Tx) error {
+		count = tx.Bucket(bucketLoginSessions).Stats().KeyN
+		return nil
+	}))
+	assert.Equal(t, 1, count)
+
+	_, err = s.GetGrant(ctx, "foo", "alice")
+	assert.NoError(t, err, "grants without expiry are kept")
+}
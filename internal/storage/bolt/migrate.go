@@ -0,0 +1,94 @@
+package bolt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	bucketMeta          = []byte("meta")
+	bucketSessions      = []byte("sessions")
+	bucketLoginSessions = []byte("login_sessions")
+	bucketLoginSids     = []byte("login_sids")
+	bucketGrants        = []byte("grants")
+	bucketCodes         = []byte("codes")
+	bucketAccessTokens  = []byte("access_tokens")
+	bucketRefreshTokens = []byte("refresh_tokens")
+	bucketRegistrations = []byte("registrations")
+	bucketAssertions    = []byte("assertions")
+
+	keySchemaVersion = []byte("schema_version")
+)
+
+// migrations are applied in order, each in its own transaction. The schema version is the number of migrations
+// applied. Migrations must never be changed or removed once released; add a new one instead.
+var migrations = []func(tx *bbolt.Tx) error{
+	// 1: create buckets for all records.
+	func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{
+			bucketSessions,
+			bucketLoginSessions,
+			bucketLoginSids,
+			bucketGrants,
+			bucketCodes,
+			bucketAccessTokens,
+			bucketRefreshTokens,
+			bucketRegistrations,
+			bucketAssertions,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// migrate brings the database schema up to date.
+func migrate(db *bbolt.DB) error {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if err := db.Update(func(tx *bbolt.Tx) error {
+			if err := migrations[i](tx); err != nil {
+				return err
+			}
+
+			raw := make([]byte, 8)
+			binary.BigEndian.PutUint64(raw, uint64(i+1))
+
+			return tx.Bucket(bucketMeta).Put(keySchemaVersion, raw)
+		}); err != nil {
+			return fmt.Errorf("failed to migrate database schema to version %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func schemaVersion(db *bbolt.DB) (int, error) {
+	var version int
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+		if err != nil {
+			return err
+		}
+
+		if raw := meta.Get(keySchemaVersion); len(raw) == 8 {
+			version = int(binary.BigEndian.Uint64(raw))
+		}
+
+		return nil
+	})
+
+	return version, err
+}
@@ -0,0 +1,383 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/storage"
+	"github.com/absurdlab/tigerd/internal/token"
+	"sync"
+	"time"
+)
+
+var _ storage.Interface = (*Storage)(nil)
+
+// New creates a Storage which evicts expired records every sweepInterval. Expired records are never returned, even
+// before they are evicted.
+func New(sweepInterval time.Duration) *Storage {
+	s := &Storage{
+		sessions:      map[string]*record{},
+		loginSessions: map[string]*record{},
+		loginSids:     map[string]*record{},
+		grants:        map[string]*record{},
+		codes:         map[string]*record{},
+		accessTokens:  map[string]*record{},
+		refreshTokens: map[string]*record{},
+		registrations: map[string]*record{},
+		assertions:    map[string]*record{},
+		stop:          make(chan struct{}),
+	}
+
+	go s.sweepEvery(sweepInterval)
+
+	return s
+}
+
+// Storage is the storage backend that keeps all records in process memory. Records are stored in their encoded form,
+// so that callers never share state through the backend.
+type Storage struct {
+	mu            sync.Mutex
+	sessions      map[string]*record
+	loginSessions map[string]*record
+	// loginSids indexes the ids of login sessions by their public sid.
+	loginSids     map[string]*record
+	grants        map[string]*record
+	codes         map[string]*record
+	accessTokens  map[string]*record
+	refreshTokens map[string]*record
+	registrations map[string]*record
+	assertions    map[string]*record
+	stop          chan struct{}
+	stopOnce      sync.Once
+}
+
+// record is immutable once stored, so that it can be read outside the lock. Updates replace the record instead.
+type record struct {
+	value []byte
+	// family groups the tokens which are deleted together.
+	family string
+	// expiresAt is the moment the record expires. A zero value means the record never expires.
+	expiresAt time.Time
+}
+
+func (r *record) isExpired(now time.Time) bool {
+	return !r.expiresAt.IsZero() && now.After(r.expiresAt)
+}
+
+func (s *Storage) SaveSession(_ context.Context, session *authorize.Session) error {
+	return s.put(s.sessions, session.ID, session, "", session.ExpiresAt)
+}
+
+func (s *Storage) GetSession(_ context.Context, id string) (*authorize.Session, error) {
+	session := new(authorize.Session)
+	if err := s.get(s.sessions, id, session, authorize.ErrSessionNotFound); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *Storage) ClaimSession(_ context.Context, id string) (*authorize.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.sessions[id]
+	if !ok || r.isExpired(time.Now()) {
+		return nil, authorize.ErrSessionNotFound
+	}
+
+	session := new(authorize.Session)
+	if err := json.Unmarshal(r.value, session); err != nil {
+		return nil, err
+	}
+	if err := session.Claim(); err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	s.sessions[id] = &record{value: raw, family: r.family, expiresAt: r.expiresAt}
+
+	return session, nil
+}
+
+func (s *Storage) DeleteSession(_ context.Context, id string) error {
+	s.delete(s.sessions, id)
+	return nil
+}
+
+func (s *Storage) SaveLoginSession(_ context.Context, session *authorize.LoginSession) error {
+	if len(session.Sid) > 0 {
+		if err := s.put(s.loginSids, session.Sid, session.ID, "", session.ExpiresAt); err != nil {
+			return err
+		}
+	}
+	return s.put(s.loginSessions, session.ID, session, "", session.ExpiresAt)
+}
+
+func (s *Storage) GetLoginSession(_ context.Context, id string) (*authorize.LoginSession, error) {
+	session := new(authorize.LoginSession)
+	if err := s.get(s.loginSessions, id, session, authorize.ErrLoginSessionNotFound); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *Storage) GetLoginSessionBySid(ctx context.Context, sid string) (*authorize.LoginSession, error) {
+	var id string
+	if err := s.get(s.loginSids, sid, &id, authorize.ErrLoginSessionNotFound); err != nil {
+		return nil, err
+	}
+	return s.GetLoginSession(ctx, id)
+}
+
+// DeleteLoginSession removes the login session. Its sid index expires along with it, and resolves to nothing meanwhile.
+func (s *Storage) DeleteLoginSession(_ context.Context, id string) error {
+	s.delete(s.loginSessions, id)
+	return nil
+}
+
+func (s *Storage) SaveGrant(_ context.Context, grant *authorize.Grant) error {
+	return s.put(s.grants, grantKey(grant.ClientID, grant.Subject), grant, "", grant.ExpiresAt)
+}
+
+func (s *Storage) GetGrant(_ context.Context, clientID string, subject string) (*authorize.Grant, error) {
+	grant := new(authorize.Grant)
+	if err := s.get(s.grants, grantKey(clientID, subject), grant, authorize.ErrGrantNotFound); err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
+
+func (s *Storage) DeleteGrant(_ context.Context, clientID string, subject string) error {
+	s.delete(s.grants, grantKey(clientID, subject))
+	return nil
+}
+
+func (s *Storage) SaveCode(_ context.Context, code *token.Code) error {
+	return s.put(s.codes, code.Value, code, "", code.ExpiresAt)
+}
+
+func (s *Storage) RedeemCode(_ context.Context, value string) (*token.Code, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.codes[value]
+	if !ok || r.isExpired(time.Now()) {
+		return nil, token.ErrCodeNotFound
+	}
+
+	code := new(token.Code)
+	if err := json.Unmarshal(r.value, code); err != nil {
+		return nil, err
+	}
+	if code.Redeemed {
+		return code, token.ErrCodeRedeemed
+	}
+
+	code.Redeemed = true
+
+	raw, err := json.Marshal(code)
+	if err != nil {
+		return nil, err
+	}
+	s.codes[value] = &record{value: raw, expiresAt: r.expiresAt}
+
+	return code, nil
+}
+
+func (s *Storage) SaveAccessToken(_ context.Context, accessToken *token.AccessToken) error {
+	return s.put(s.accessTokens, accessToken.Value, accessToken, accessToken.Family, accessToken.ExpiresAt)
+}
+
+func (s *Storage) GetAccessToken(_ context.Context, value string) (*token.AccessToken, error) {
+	accessToken := new(token.AccessToken)
+	if err := s.get(s.accessTokens, value, accessToken, token.ErrAccessTokenNotFound); err != nil {
+		return nil, err
+	}
+	return accessToken, nil
+}
+
+func (s *Storage) DeleteAccessToken(_ context.Context, value string) error {
+	s.delete(s.accessTokens, value)
+	return nil
+}
+
+func (s *Storage) DeleteAccessTokenFamily(_ context.Context, family string) error {
+	s.deleteFamily(s.accessTokens, family)
+	return nil
+}
+
+func (s *Storage) SaveRefreshToken(_ context.Context, refreshToken *token.RefreshToken) error {
+	return s.put(s.refreshTokens, refreshToken.Value, refreshToken, refreshToken.Family, refreshToken.ExpiresAt)
+}
+
+func (s *Storage) GetRefreshToken(_ context.Context, value string) (*token.RefreshToken, error) {
+	refreshToken := new(token.RefreshToken)
+	if err := s.get(s.refreshTokens, value, refreshToken, token.ErrRefreshTokenNotFound); err != nil {
+		return nil, err
+	}
+	return refreshToken, nil
+}
+
+func (s *Storage) UseRefreshToken(_ context.Context, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.refreshTokens[value]
+	if !ok || r.isExpired(time.Now()) {
+		return token.ErrRefreshTokenNotFound
+	}
+
+	refreshToken := new(token.RefreshToken)
+	if err := json.Unmarshal(r.value, refreshToken); err != nil {
+		return err
+	}
+	if refreshToken.Used {
+		return token.ErrRefreshTokenReused
+	}
+
+	refreshToken.Used = true
+
+	raw, err := json.Marshal(refreshToken)
+	if err != nil {
+		return err
+	}
+	s.refreshTokens[value] = &record{value: raw, family: r.family, expiresAt: r.expiresAt}
+
+	return nil
+}
+
+func (s *Storage) DeleteRefreshTokenFamily(_ context.Context, family string) error {
+	s.deleteFamily(s.refreshTokens, family)
+	return nil
+}
+
+func (s *Storage) SaveRegistration(_ context.Context, registration *client.Registration) error {
+	return s.put(s.registrations, registration.Client.ID, registration, "", time.Time{})
+}
+
+func (s *Storage) GetRegistration(_ context.Context, clientID string) (*client.Registration, error) {
+	registration := new(client.Registration)
+	if err := s.get(s.registrations, clientID, registration, client.ErrNotFound); err != nil {
+		return nil, err
+	}
+	return registration, nil
+}
+
+func (s *Storage) DeleteRegistration(_ context.Context, clientID string) error {
+	s.delete(s.registrations, clientID)
+	return nil
+}
+
+func (s *Storage) SaveAssertionID(_ context.Context, id string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r, ok := s.assertions[id]; ok && !r.isExpired(time.Now()) {
+		return client.ErrAssertionReplayed
+	}
+	s.assertions[id] = &record{expiresAt: expiresAt}
+
+	return nil
+}
+
+// Close stops evicting expired records.
+func (s *Storage) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	return nil
+}
+
+func (s *Storage) put(table map[string]*record, key string, value any, family string, expiresAt time.Time) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	table[key] = &record{value: raw, family: family, expiresAt: expiresAt}
+
+	return nil
+}
+
+// get decodes the unexpired record by its key into dest, or returns notFound.
+func (s *Storage) get(table map[string]*record, key string, dest any, notFound error) error {
+	s.mu.Lock()
+	r, ok := table[key]
+	s.mu.Unlock()
+
+	// r is immutable, hence safe to read without the lock.
+	if !ok || r.isExpired(time.Now()) {
+		return notFound
+	}
+
+	return json.Unmarshal(r.value, dest)
+}
+
+func (s *Storage) delete(table map[string]*record, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(table, key)
+}
+
+func (s *Storage) deleteFamily(table map[string]*record, family string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, r := range table {
+		if r.family == family {
+			delete(table, key)
+		}
+	}
+}
+
+func (s *Storage) sweepEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.sweep()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// sweep evicts all expired records.
+func (s *Storage) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, table := range []map[string]*record{
+		s.sessions,
+		s.loginSessions,
+		s.loginSids,
+		s.grants,
+		s.codes,
+		s.accessTokens,
+		s.refreshTokens,
+		s.registrations,
+		s.assertions,
+	} {
+		for key, r := range table {
+			if r.isExpired(now) {
+				delete(table, key)
+			}
+		}
+	}
+}
+
+// grantKey returns the key of the grant of the subject to the client. The NUL separator never appears in either part.
+func grantKey(clientID string, subject string) string {
+	return clientID + "\x00" + subject
+}
@@ -0,0 +1,41 @@
+//go:build unit
+
+package memory
+
+import (
+	"context"
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/storage"
+	"github.com/absurdlab/tigerd/internal/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Interface {
+		return New(time.Minute)
+	})
+}
+
+func TestStorage_sweep(t *testing.T) {
+	s := New(time.Millisecond)
+	defer s.Close()
+
+	ctx := context.Background()
+	require.NoError(t, s.SaveLoginSession(ctx, &authorize.LoginSession{ID: "expired", ExpiresAt: time.Now().Add(-time.Second)}))
+	require.NoError(t, s.SaveLoginSession(ctx, &authorize.LoginSession{ID: "valid", ExpiresAt: time.Now().Add(time.Hour)}))
+	require.NoError(t, s.SaveGrant(ctx, &authorize.Grant{ClientID: "foo", Subject: "alice"}))
+
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.loginSessions) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	_, err := s.GetLoginSession(ctx, "valid")
+	assert.NoError(t, err)
+	_, err = s.GetGrant(ctx, "foo", "alice")
+	assert.NoError(t, err, "grants without expiry are kept")
+}
@@ -0,0 +1,413 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/storage"
+	"github.com/absurdlab/tigerd/internal/token"
+	goredis "github.com/redis/go-redis/v9"
+	"strings"
+	"time"
+)
+
+var (
+	_ storage.Interface = (*Storage)(nil)
+
+	// keyEscaper escapes the separator in key parts, along with the escape character itself.
+	keyEscaper = strings.NewReplacer("%", "%25", ":", "%3A")
+)
+
+const (
+	kindSession          = "session"
+	kindLoginSession     = "login_session"
+	kindLoginSid         = "login_sid"
+	kindGrant            = "grant"
+	kindCode             = "code"
+	kindCodeRedeemed     = "code_redeemed"
+	kindAccessToken      = "access_token"
+	kindRefreshToken     = "refresh_token"
+	kindRefreshTokenUsed = "refresh_token_used"
+	kindRegistration     = "registration"
+	kindAssertion        = "assertion"
+	kindFamily           = "family"
+)
+
+// Open creates a Storage connected to the Redis server at the url, in the form of
+// redis://<user>:<password>@<host>:<port>/<db>, whose keys are all prefixed with keyPrefix.
+func Open(url string, keyPrefix string) (*Storage, error) {
+	opts, err := goredis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(goredis.NewClient(opts), keyPrefix), nil
+}
+
+// New creates a Storage on the Redis client, whose keys are all prefixed with keyPrefix. The client may also be a
+// cluster client, as no command spans multiple keys. The Storage takes ownership of the client, which is closed along
+// with the Storage.
+func New(rdb goredis.UniversalClient, keyPrefix string) *Storage {
+	return &Storage{rdb: rdb, prefix: keyPrefix}
+}
+
+// Storage is the storage backend that keeps all records in Redis, so that all replicas of tigerd share the same
+// state. Records expire natively in Redis.
+type Storage struct {
+	rdb    goredis.UniversalClient
+	prefix string
+}
+
+func (s *Storage) SaveSession(ctx context.Context, session *authorize.Session) error {
+	return s.put(ctx, s.key(kindSession, session.ID), session, session.ExpiresAt)
+}
+
+func (s *Storage) GetSession(ctx context.Context, id string) (*authorize.Session, error) {
+	session := new(authorize.Session)
+	if err := s.get(ctx, s.key(kindSession, id), session, authorize.ErrSessionNotFound); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ClaimSession claims the session in an optimistic transaction, which fails with authorize.ErrSessionState if the
+// session is changed concurrently.
+func (s *Storage) ClaimSession(ctx context.Context, id string) (*authorize.Session, error) {
+	var (
+		key     = s.key(kindSession, id)
+		session = new(authorize.Session)
+	)
+
+	err := s.rdb.Watch(ctx, func(tx *goredis.Tx) error {
+		raw, err := tx.Get(ctx, key).Bytes()
+		if err != nil {
+			if errors.Is(err, goredis.Nil) {
+				return authorize.ErrSessionNotFound
+			}
+			return err
+		}
+
+		if err = json.Unmarshal(raw, session); err != nil {
+			return err
+		}
+		if err = session.Claim(); err != nil {
+			return err
+		}
+
+		if raw, err = json.Marshal(session); err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			pipe.SetArgs(ctx, key, raw, goredis.SetArgs{KeepTTL: true})
+			return nil
+		})
+
+		return err
+	}, key)
+	switch {
+	case errors.Is(err, goredis.TxFailedErr):
+		return nil, authorize.ErrSessionState
+	case err != nil:
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (s *Storage) DeleteSession(ctx context.Context, id string) error {
+	return s.rdb.Del(ctx, s.key(kindSession, id)).Err()
+}
+
+func (s *Storage) SaveLoginSession(ctx context.Context, session *authorize.LoginSession) error {
+	if len(session.Sid) > 0 {
+		if err := s.put(ctx, s.key(kindLoginSid, session.Sid), session.ID, session.ExpiresAt); err != nil {
+			return err
+		}
+	}
+	return s.put(ctx, s.key(kindLoginSession, session.ID), session, session.ExpiresAt)
+}
+
+func (s *Storage) GetLoginSession(ctx context.Context, id string) (*authorize.LoginSession, error) {
+	session := new(authorize.LoginSession)
+	if err := s.get(ctx, s.key(kindLoginSession, id), session, authorize.ErrLoginSessionNotFound); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *Storage) GetLoginSessionBySid(ctx context.Context, sid string) (*authorize.LoginSession, error) {
+	var id string
+	if err := s.get(ctx, s.key(kindLoginSid, sid), &id, authorize.ErrLoginSessionNotFound); err != nil {
+		return nil, err
+	}
+	return s.GetLoginSession(ctx, id)
+}
+
+// DeleteLoginSession removes the login session. Its sid index expires along with it, and resolves to nothing meanwhile.
+func (s *Storage) DeleteLoginSession(ctx context.Context, id string) error {
+	return s.rdb.Del(ctx, s.key(kindLoginSession, id)).Err()
+}
+
+func (s *Storage) SaveGrant(ctx context.Context, grant *authorize.Grant) error {
+	return s.put(ctx, s.key(kindGrant, grant.ClientID, grant.Subject), grant, grant.ExpiresAt)
+}
+
+func (s *Storage) GetGrant(ctx context.Context, clientID string, subject string) (*authorize.Grant, error) {
+	grant := new(authorize.Grant)
+	if err := s.get(ctx, s.key(kindGrant, clientID, subject), grant, authorize.ErrGrantNotFound); err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
+
+func (s *Storage) DeleteGrant(ctx context.Context, clientID string, subject string) error {
+	return s.rdb.Del(ctx, s.key(kindGrant, clientID, subject)).Err()
+}
+
+func (s *Storage) SaveCode(ctx context.Context, code *token.Code) error {
+	return s.put(ctx, s.key(kindCode, code.Value), code, code.ExpiresAt)
+}
+
+// RedeemCode sets a redeemed marker next to the code, rather than rewriting it, so that only one of the concurrent
+// callers succeeds.
+func (s *Storage) RedeemCode(ctx context.Context, value string) (*token.Code, error) {
+	code := new(token.Code)
+	if err := s.get(ctx, s.key(kindCode, value), code, token.ErrCodeNotFound); err != nil {
+		return nil, err
+	}
+	if code.IsExpired() {
+		return nil, token.ErrCodeNotFound
+	}
+
+	ok, err := s.rdb.SetNX(ctx, s.key(kindCodeRedeemed, value), 1, time.Until(code.ExpiresAt)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		code.Redeemed = true
+		return code, token.ErrCodeRedeemed
+	}
+
+	return code, nil
+}
+
+func (s *Storage) SaveAccessToken(ctx context.Context, accessToken *token.AccessToken) error {
+	key := s.key(kindAccessToken, accessToken.Value)
+
+	if err := s.put(ctx, key, accessToken, accessToken.ExpiresAt); err != nil {
+		return err
+	}
+
+	return s.joinFamily(ctx, kindAccessToken, accessToken.Family, key, accessToken.ExpiresAt)
+}
+
+func (s *Storage) GetAccessToken(ctx context.Context, value string) (*token.AccessToken, error) {
+	accessToken := new(token.AccessToken)
+	if err := s.get(ctx, s.key(kindAccessToken, value), accessToken, token.ErrAccessTokenNotFound); err != nil {
+		return nil, err
+	}
+	return accessToken, nil
+}
+
+func (s *Storage) DeleteAccessToken(ctx context.Context, value string) error {
+	return s.rdb.Del(ctx, s.key(kindAccessToken, value)).Err()
+}
+
+func (s *Storage) DeleteAccessTokenFamily(ctx context.Context, family string) error {
+	return s.deleteFamily(ctx, kindAccessToken, family)
+}
+
+func (s *Storage) SaveRefreshToken(ctx context.Context, refreshToken *token.RefreshToken) error {
+	key := s.key(kindRefreshToken, refreshToken.Value)
+
+	if err := s.put(ctx, key, refreshToken, refreshToken.ExpiresAt); err != nil {
+		return err
+	}
+
+	return s.joinFamily(ctx, kindRefreshToken, refreshToken.Family, key, refreshToken.ExpiresAt)
+}
+
+// GetRefreshToken returns the refresh token, which is marked used if the used marker set by UseRefreshToken exists.
+// Both keys are read in a pipeline rather than by MGET, as they may live in different slots of a cluster.
+func (s *Storage) GetRefreshToken(ctx context.Context, value string) (*token.RefreshToken, error) {
+	var raw, used *goredis.StringCmd
+	_, err := s.rdb.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		raw = pipe.Get(ctx, s.key(kindRefreshToken, value))
+		used = pipe.Get(ctx, s.key(kindRefreshTokenUsed, value))
+		return nil
+	})
+	if err != nil && !errors.Is(err, goredis.Nil) {
+		return nil, err
+	}
+
+	if errors.Is(raw.Err(), goredis.Nil) {
+		return nil, token.ErrRefreshTokenNotFound
+	}
+
+	refreshToken := new(token.RefreshToken)
+	if err := json.Unmarshal([]byte(raw.Val()), refreshToken); err != nil {
+		return nil, err
+	}
+
+	if used.Err() == nil {
+		refreshToken.Used = true
+	}
+
+	return refreshToken, nil
+}
+
+// UseRefreshToken sets a used marker next to the refresh token, rather than rewriting it, so that only one of the
+// concurrent callers succeeds.
+func (s *Storage) UseRefreshToken(ctx context.Context, value string) error {
+	refreshToken, err := s.GetRefreshToken(ctx, value)
+	if err != nil {
+		return err
+	}
+
+	key := s.key(kindRefreshTokenUsed, value)
+
+	ok, err := s.rdb.SetNX(ctx, key, 1, time.Until(refreshToken.ExpiresAt)).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return token.ErrRefreshTokenReused
+	}
+
+	return s.joinFamily(ctx, kindRefreshToken, refreshToken.Family, key, refreshToken.ExpiresAt)
+}
+
+func (s *Storage) DeleteRefreshTokenFamily(ctx context.Context, family string) error {
+	return s.deleteFamily(ctx, kindRefreshToken, family)
+}
+
+func (s *Storage) SaveRegistration(ctx context.Context, registration *client.Registration) error {
+	return s.put(ctx, s.key(kindRegistration, registration.Client.ID), registration, time.Time{})
+}
+
+func (s *Storage) GetRegistration(ctx context.Context, clientID string) (*client.Registration, error) {
+	registration := new(client.Registration)
+	if err := s.get(ctx, s.key(kindRegistration, clientID), registration, client.ErrNotFound); err != nil {
+		return nil, err
+	}
+	return registration, nil
+}
+
+func (s *Storage) DeleteRegistration(ctx context.Context, clientID string) error {
+	return s.rdb.Del(ctx, s.key(kindRegistration, clientID)).Err()
+}
+
+func (s *Storage) SaveAssertionID(ctx context.Context, id string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	ok, err := s.rdb.SetNX(ctx, s.key(kindAssertion, id), 1, ttl).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return client.ErrAssertionReplayed
+	}
+
+	return nil
+}
+
+// Close closes the Redis client.
+func (s *Storage) Close() error {
+	return s.rdb.Close()
+}
+
+// put saves the value under the key until expiresAt. A zero expiresAt means the value never expires, and a past
+// expiresAt removes any existing value.
+func (s *Storage) put(ctx context.Context, key string, value any, expiresAt time.Time) error {
+	var ttl time.Duration
+	if !expiresAt.IsZero() {
+		if ttl = time.Until(expiresAt); ttl <= 0 {
+			return s.rdb.Del(ctx, key).Err()
+		}
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.Set(ctx, key, raw, ttl).Err()
+}
+
+// get decodes the value under the key into dest, or returns notFound.
+func (s *Storage) get(ctx context.Context, key string, dest any, notFound error) error {
+	raw, err := s.rdb.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, goredis.Nil) {
+			return notFound
+		}
+		return err
+	}
+
+	return json.Unmarshal(raw, dest)
+}
+
+// joinFamily adds the key to the index of the family, which lives as long as its last member.
+func (s *Storage) joinFamily(ctx context.Context, kind string, family string, key string, expiresAt time.Time) error {
+	if len(family) == 0 {
+		return nil
+	}
+
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	familyKey := s.key(kindFamily, kind, family)
+
+	current, err := s.rdb.PTTL(ctx, familyKey).Result()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.rdb.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.SAdd(ctx, familyKey, key)
+		if ttl > current {
+			pipe.PExpire(ctx, familyKey, ttl)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// deleteFamily deletes the members of the family and its index. The keys are deleted one by one in a pipeline rather
+// than by a single DEL, as they may live in different slots of a cluster.
+func (s *Storage) deleteFamily(ctx context.Context, kind string, family string) error {
+	familyKey := s.key(kindFamily, kind, family)
+
+	keys, err := s.rdb.SMembers(ctx, familyKey).Result()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.rdb.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, key := range append(keys, familyKey) {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// key returns the key of the record of the kind, identified by the parts, all separated by colons. Colons within the
+// parts are escaped, so that keys with different parts never collide.
+func (s *Storage) key(kind string, parts ...string) string {
+	key := s.prefix + kind
+	for _, each := range parts {
+		key += ":" + keyEscaper.Replace(each)
+	}
+	return key
+}
@@ -0,0 +1,73 @@
+//go:build unit
+
+package redis
+
+import (
+	"context"
+	"github.com/absurdlab/tigerd/internal/storage"
+	"github.com/absurdlab/tigerd/internal/storage/storagetest"
+	"github.com/absurdlab/tigerd/internal/token"
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Interface {
+		return New(goredis.NewClient(&goredis.Options{Addr: miniredis.RunT(t).Addr()}), "tigerd:")
+	})
+}
+
+func TestStorage_expiry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := New(goredis.NewClient(&goredis.Options{Addr: mr.Addr()}), "tigerd:")
+	defer s.Close()
+
+	ctx := context.Background()
+	authorization := token.Authorization{ClientID: "foo", Subject: "alice"}
+
+	code := token.NewCode(authorization, "https://foo.com/callback", time.Minute)
+	require.NoError(t, s.SaveCode(ctx, code))
+
+	refreshToken := token.NewRefreshToken(authorization, time.Hour)
+	require.NoError(t, s.SaveRefreshToken(ctx, refreshToken))
+	require.NoError(t, s.UseRefreshToken(ctx, refreshToken.Value))
+
+	mr.FastForward(2 * time.Minute)
+
+	_, err := s.RedeemCode(ctx, code.Value)
+	assert.ErrorIs(t, err, token.ErrCodeNotFound)
+
+	_, err = s.GetRefreshToken(ctx, refreshToken.Value)
+	assert.NoError(t, err)
+
+	mr.FastForward(time.Hour)
+
+	assert.Empty(t, mr.Keys(), "all keys expire with their records")
+}
+
+func TestStorage_key(t *testing.T) {
+	s := New(goredis.NewClient(&goredis.Options{Addr: miniredis.RunT(t).Addr()}), "tigerd:")
+	defer s.Close()
+
+	assert.Equal(t, "tigerd:grant:foo:alice", s.key(kindGrant, "foo", "alice"))
+	assert.NotEqual(t, s.key(kindGrant, "foo:bar", "alice"), s.key(kindGrant, "foo", "bar:alice"))
+	assert.NotEqual(t, s.key(kindGrant, "foo%3Abar", "alice"), s.key(kindGrant, "foo:bar", "alice"))
+}
+
+func TestOpen(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	s, err := Open("redis://"+mr.Addr()+"/0", "tigerd:")
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.NoError(t, s.SaveAssertionID(context.Background(), "foo:1", time.Now().Add(time.Minute)))
+	assert.True(t, mr.Exists("tigerd:assertion:foo%3A1"))
+
+	_, err = Open("http://"+mr.Addr(), "tigerd:")
+	assert.Error(t, err)
+}
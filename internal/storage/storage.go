@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/token"
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"go.uber.org/fx"
+	"time"
+)
+
+const (
+	// BackendMemory keeps all state in process memory. State is lost on restart, and is not shared among replicas.
+	BackendMemory = "memory"
+	// BackendBolt keeps all state in an embedded database file. State survives restarts, but is not shared among
+	// replicas.
+	BackendBolt = "bolt"
+	// BackendRedis keeps all state in Redis. State is shared among replicas.
+	BackendRedis = "redis"
+)
+
+// Properties is the configuration properties for the storage backend.
+type Properties struct {
+	// Backend selects the storage backend.
+	Backend string `json:"backend" yaml:"backend"`
+	// Path is the path to the database file of the bolt backend.
+	Path string `json:"path" yaml:"path"`
+	// RedisURL is the url of the Redis server of the redis backend.
+	RedisURL string `json:"redis_url" yaml:"redis_url"`
+	// RedisKeyPrefix is prepended to all keys of the redis backend, so that the Redis server can be shared.
+	RedisKeyPrefix string `json:"redis_key_prefix" yaml:"redis_key_prefix"`
+	// SweepInterval is the interval expired records are evicted at, for backends without native expiry.
+	SweepInterval time.Duration `json:"sweep_interval" yaml:"sweep_interval"`
+}
+
+// Validate performs validation to this Properties.
+func (p *Properties) Validate() error {
+	return v.Errors{
+		"backend":        v.Validate(p.Backend, v.Required, v.In(BackendMemory, BackendBolt, BackendRedis)),
+		"path":           v.Validate(p.Path, v.When(p.Backend == BackendBolt, v.Required)),
+		"redis_url":      v.Validate(p.RedisURL, v.When(p.Backend == BackendRedis, v.Required)),
+		"sweep_interval": v.Validate(p.SweepInterval, v.Required),
+	}.Filter()
+}
+
+// Interface is implemented by storage backends, which persist all the state of tigerd: authorization and login
+// sessions, grants, authorization codes, access and refresh tokens, client registrations and client assertion ids.
+// Each store is consumed through its own interface, so services never depend on the backend as a whole.
+type Interface interface {
+	authorize.SessionStore
+	authorize.LoginSessionStore
+	authorize.GrantStore
+	token.CodeStore
+	token.AccessTokenStore
+	token.RefreshTokenStore
+	client.Store
+	client.AssertionStore
+	// Close releases the resources held by the backend.
+	Close() error
+}
+
+// Provide returns an fx.Option which provides the storage backend returned by the constructor, as well as each of the
+// store interfaces it implements.
+func Provide(constructor any) fx.Option {
+	return fx.Options(
+		fx.Provide(constructor),
+		fx.Provide(
+			func(s Interface) authorize.SessionStore { return s },
+			func(s Interface) authorize.LoginSessionStore { return s },
+			func(s Interface) authorize.GrantStore { return s },
+			func(s Interface) token.CodeStore { return s },
+			func(s Interface) token.AccessTokenStore { return s },
+			func(s Interface) token.RefreshTokenStore { return s },
+			func(s Interface) client.Store { return s },
+			func(s Interface) client.AssertionStore { return s },
+		),
+	)
+}
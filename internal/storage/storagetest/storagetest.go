@@ -0,0 +1,425 @@
+//go:build unit
+
+// Package storagetest is the conformance test suite that every storage backend must pass.
+package storagetest
+
+import (
+	"context"
+	"github.com/absurdlab/tigerd/internal/authorize"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/storage"
+	"github.com/absurdlab/tigerd/internal/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Run runs the conformance test suite against the backend created by newStorage for each test.
+func Run(t *testing.T, newStorage func(t *testing.T) storage.Interface) {
+	cases := []struct {
+		name string
+		test func(t *testing.T, s storage.Interface)
+	}{
+		{name: "session", test: testSession},
+		{name: "session claimed concurrently", test: testSessionConcurrency},
+		{name: "login session", test: testLoginSession},
+		{name: "grant", test: testGrant},
+		{name: "code", test: testCode},
+		{name: "code redeemed concurrently", test: testCodeConcurrency},
+		{name: "access token", test: testAccessToken},
+		{name: "refresh token", test: testRefreshToken},
+		{name: "refresh token used and read concurrently", test: testRefreshTokenConcurrency},
+		{name: "registration", test: testRegistration},
+		{name: "assertion id", test: testAssertionID},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newStorage(t)
+			t.Cleanup(func() { _ = s.Close() })
+			c.test(t, s)
+		})
+	}
+}
+
+var authorization = token.Authorization{
+	ClientID: "foo",
+	Subject:  "alice",
+	Scopes:   []string{"openid", "offline_access"},
+	Sid:      "sid",
+	AuthTime: time.Now().Truncate(time.Second),
+	Claims:   token.Claims{IDToken: map[string]any{"email": "alice@example.com"}},
+}
+
+func testSession(t *testing.T, s storage.Interface) {
+	ctx := context.Background()
+
+	session := &authorize.Session{
+		ID:          "session",
+		Sid:         "sid",
+		ProviderKey: "default",
+		Request: &authorize.Request{
+			ResponseType: spec.ResponseTypeCode.ToSet(),
+			ClientID:     "foo",
+			RedirectURI:  "https://foo.com/callback",
+			Scopes:       []string{"openid"},
+		},
+		Step:      authorize.StepLogin,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+	require.NoError(t, s.SaveSession(ctx, session))
+
+	found, err := s.GetSession(ctx, session.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, session.Request, found.Request)
+		assert.Equal(t, authorize.StepLogin, found.Step)
+	}
+
+	found.Reported = true
+	require.NoError(t, s.SaveSession(ctx, found))
+	found, err = s.GetSession(ctx, session.ID)
+	if assert.NoError(t, err) {
+		assert.True(t, found.Reported)
+	}
+
+	require.NoError(t, s.DeleteSession(ctx, session.ID))
+	_, err = s.GetSession(ctx, session.ID)
+	assert.ErrorIs(t, err, authorize.ErrSessionNotFound)
+	assert.NoError(t, s.DeleteSession(ctx, session.ID), "delete twice")
+
+	expired := &authorize.Session{ID: "expired", Request: session.Request, ExpiresAt: time.Now().Add(-time.Second)}
+	require.NoError(t, s.SaveSession(ctx, expired))
+	_, err = s.GetSession(ctx, expired.ID)
+	assert.ErrorIs(t, err, authorize.ErrSessionNotFound)
+}
+
+func testSessionConcurrency(t *testing.T, s storage.Interface) {
+	ctx := context.Background()
+
+	session := &authorize.Session{
+		ID:        "session",
+		Request:   &authorize.Request{ClientID: "foo"},
+		Step:      authorize.StepLogin,
+		Reported:  true,
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+	require.NoError(t, s.SaveSession(ctx, session))
+
+	var (
+		wg      sync.WaitGroup
+		claimed int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.ClaimSession(ctx, session.ID); err == nil {
+				atomic.AddInt32(&claimed, 1)
+			} else {
+				assert.ErrorIs(t, err, authorize.ErrSessionState)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), claimed)
+
+	found, err := s.GetSession(ctx, session.ID)
+	if assert.NoError(t, err) {
+		assert.Zero(t, found.Step)
+		assert.False(t, found.Reported)
+	}
+
+	_, err = s.ClaimSession(ctx, "unknown")
+	assert.ErrorIs(t, err, authorize.ErrSessionNotFound)
+}
+
+func testLoginSession(t *testing.T, s storage.Interface) {
+	ctx := context.Background()
+
+	loginSession := &authorize.LoginSession{
+		ID:        "id",
+		Sid:       "sid",
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	loginSession.Remember(&authorize.Authentication{
+		ID:       "authn",
+		Subject:  "alice",
+		AuthTime: time.Now().Truncate(time.Second),
+		Expiry:   time.Now().Add(time.Hour).Truncate(time.Second),
+	})
+	loginSession.Participate("foo", "alice")
+	require.NoError(t, s.SaveLoginSession(ctx, loginSession))
+
+	found, err := s.GetLoginSession(ctx, loginSession.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alice", found.Find("authn").Subject)
+		assert.Equal(t, loginSession.Participants, found.Participants)
+	}
+
+	found, err = s.GetLoginSessionBySid(ctx, loginSession.Sid)
+	if assert.NoError(t, err) {
+		assert.Equal(t, loginSession.ID, found.ID)
+	}
+	_, err = s.GetLoginSessionBySid(ctx, loginSession.ID)
+	assert.ErrorIs(t, err, authorize.ErrLoginSessionNotFound, "id is not a sid")
+
+	require.NoError(t, s.DeleteLoginSession(ctx, loginSession.ID))
+	_, err = s.GetLoginSession(ctx, loginSession.ID)
+	assert.ErrorIs(t, err, authorize.ErrLoginSessionNotFound)
+	_, err = s.GetLoginSessionBySid(ctx, loginSession.Sid)
+	assert.ErrorIs(t, err, authorize.ErrLoginSessionNotFound)
+
+	expired := &authorize.LoginSession{ID: "expired", ExpiresAt: time.Now().Add(-time.Second)}
+	require.NoError(t, s.SaveLoginSession(ctx, expired))
+	_, err = s.GetLoginSession(ctx, expired.ID)
+	assert.ErrorIs(t, err, authorize.ErrLoginSessionNotFound)
+}
+
+func testGrant(t *testing.T, s storage.Interface) {
+	ctx := context.Background()
+
+	grant := &authorize.Grant{
+		ClientID:  "foo",
+		Subject:   "alice",
+		Scopes:    []string{"openid", "email"},
+		CreatedAt: time.Now().Truncate(time.Second),
+		UpdatedAt: time.Now().Truncate(time.Second),
+	}
+	require.NoError(t, s.SaveGrant(ctx, grant))
+	require.NoError(t, s.SaveGrant(ctx, &authorize.Grant{ClientID: "bar", Subject: "alice", Scopes: []string{"openid"}}))
+
+	found, err := s.GetGrant(ctx, "foo", "alice")
+	if assert.NoError(t, err) {
+		assert.Equal(t, grant.Scopes, found.Scopes)
+		assert.True(t, grant.CreatedAt.Equal(found.CreatedAt))
+	}
+
+	_, err = s.GetGrant(ctx, "foo", "bob")
+	assert.ErrorIs(t, err, authorize.ErrGrantNotFound)
+
+	grant.Scopes = append(grant.Scopes, "profile")
+	require.NoError(t, s.SaveGrant(ctx, grant))
+	found, err = s.GetGrant(ctx, "foo", "alice")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"openid", "email", "profile"}, found.Scopes)
+	}
+
+	require.NoError(t, s.DeleteGrant(ctx, "foo", "alice"))
+	_, err = s.GetGrant(ctx, "foo", "alice")
+	assert.ErrorIs(t, err, authorize.ErrGrantNotFound)
+
+	_, err = s.GetGrant(ctx, "bar", "alice")
+	assert.NoError(t, err, "other grants untouched")
+
+	expired := &authorize.Grant{ClientID: "baz", Subject: "alice", ExpiresAt: time.Now().Add(-time.Second)}
+	require.NoError(t, s.SaveGrant(ctx, expired))
+	_, err = s.GetGrant(ctx, "baz", "alice")
+	assert.ErrorIs(t, err, authorize.ErrGrantNotFound)
+}
+
+func testCode(t *testing.T, s storage.Interface) {
+	ctx := context.Background()
+
+	code := token.NewCode(authorization, "https://foo.com/callback", time.Minute).
+		WithChallenge("challenge", spec.CodeChallengeMethodS256)
+	require.NoError(t, s.SaveCode(ctx, code))
+
+	redeemed, err := s.RedeemCode(ctx, code.Value)
+	if assert.NoError(t, err) {
+		assert.Equal(t, code.RedirectURI, redeemed.RedirectURI)
+		assert.Equal(t, code.CodeChallenge, redeemed.CodeChallenge)
+		assert.Equal(t, code.CodeChallengeMethod, redeemed.CodeChallengeMethod)
+		assert.Equal(t, authorization.Claims, redeemed.Claims)
+	}
+
+	replayed, err := s.RedeemCode(ctx, code.Value)
+	if assert.ErrorIs(t, err, token.ErrCodeRedeemed, "redeemed twice") {
+		assert.Equal(t, code.Family, replayed.Family)
+		assert.True(t, replayed.Redeemed)
+	}
+
+	_, err = s.RedeemCode(ctx, "unknown")
+	assert.ErrorIs(t, err, token.ErrCodeNotFound)
+
+	expired := token.NewCode(authorization, "https://foo.com/callback", -time.Second)
+	require.NoError(t, s.SaveCode(ctx, expired))
+	_, err = s.RedeemCode(ctx, expired.Value)
+	assert.ErrorIs(t, err, token.ErrCodeNotFound)
+}
+
+func testCodeConcurrency(t *testing.T, s storage.Interface) {
+	ctx := context.Background()
+
+	code := token.NewCode(authorization, "https://foo.com/callback", time.Minute)
+	require.NoError(t, s.SaveCode(ctx, code))
+
+	var (
+		wg       sync.WaitGroup
+		redeemed int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.RedeemCode(ctx, code.Value); err == nil {
+				atomic.AddInt32(&redeemed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), redeemed)
+}
+
+func testAccessToken(t *testing.T, s storage.Interface) {
+	ctx := context.Background()
+
+	first := token.NewAccessToken(authorization, time.Hour)
+	first.Family = "family"
+	second := token.NewAccessToken(authorization, time.Hour)
+	second.Family = "family"
+	other := token.NewAccessToken(authorization, time.Hour)
+
+	for _, each := range []*token.AccessToken{first, second, other} {
+		require.NoError(t, s.SaveAccessToken(ctx, each))
+	}
+
+	found, err := s.GetAccessToken(ctx, first.Value)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "family", found.Family)
+		assert.Equal(t, authorization.Scopes, found.Scopes)
+		assert.True(t, first.ExpiresAt.Equal(found.ExpiresAt))
+	}
+
+	require.NoError(t, s.DeleteAccessToken(ctx, other.Value))
+	_, err = s.GetAccessToken(ctx, other.Value)
+	assert.ErrorIs(t, err, token.ErrAccessTokenNotFound)
+
+	require.NoError(t, s.DeleteAccessTokenFamily(ctx, "family"))
+	for _, each := range []*token.AccessToken{first, second} {
+		_, err = s.GetAccessToken(ctx, each.Value)
+		assert.ErrorIs(t, err, token.ErrAccessTokenNotFound)
+	}
+
+	expired := token.NewAccessToken(authorization, -time.Second)
+	require.NoError(t, s.SaveAccessToken(ctx, expired))
+	_, err = s.GetAccessToken(ctx, expired.Value)
+	assert.ErrorIs(t, err, token.ErrAccessTokenNotFound)
+}
+
+func testRefreshToken(t *testing.T, s storage.Interface) {
+	ctx := context.Background()
+
+	first := token.NewRefreshToken(authorization, time.Hour)
+	second := token.NewRefreshToken(authorization, time.Hour)
+	second.Family = first.Family
+	other := token.NewRefreshToken(authorization, time.Hour)
+
+	for _, each := range []*token.RefreshToken{first, second, other} {
+		require.NoError(t, s.SaveRefreshToken(ctx, each))
+	}
+
+	require.NoError(t, s.UseRefreshToken(ctx, first.Value))
+	assert.ErrorIs(t, s.UseRefreshToken(ctx, first.Value), token.ErrRefreshTokenReused)
+	assert.ErrorIs(t, s.UseRefreshToken(ctx, "unknown"), token.ErrRefreshTokenNotFound)
+
+	found, err := s.GetRefreshToken(ctx, first.Value)
+	if assert.NoError(t, err, "used tokens are kept") {
+		assert.True(t, found.Used)
+		assert.Equal(t, first.Family, found.Family)
+	}
+
+	require.NoError(t, s.DeleteRefreshTokenFamily(ctx, first.Family))
+	for _, each := range []*token.RefreshToken{first, second} {
+		_, err = s.GetRefreshToken(ctx, each.Value)
+		assert.ErrorIs(t, err, token.ErrRefreshTokenNotFound)
+	}
+
+	_, err = s.GetRefreshToken(ctx, other.Value)
+	assert.NoError(t, err, "other families untouched")
+
+	expired := token.NewRefreshToken(authorization, -time.Second)
+	require.NoError(t, s.SaveRefreshToken(ctx, expired))
+	_, err = s.GetRefreshToken(ctx, expired.Value)
+	assert.ErrorIs(t, err, token.ErrRefreshTokenNotFound)
+	assert.ErrorIs(t, s.UseRefreshToken(ctx, expired.Value), token.ErrRefreshTokenNotFound)
+}
+
+func testRefreshTokenConcurrency(t *testing.T, s storage.Interface) {
+	ctx := context.Background()
+
+	refreshToken := token.NewRefreshToken(authorization, time.Hour)
+	require.NoError(t, s.SaveRefreshToken(ctx, refreshToken))
+
+	var (
+		wg   sync.WaitGroup
+		used int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.UseRefreshToken(ctx, refreshToken.Value); err == nil {
+				atomic.AddInt32(&used, 1)
+			}
+		}()
+
+		// reads race with the use, and must see the refresh token either used or not, never torn.
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				found, err := s.GetRefreshToken(ctx, refreshToken.Value)
+				if assert.NoError(t, err) {
+					assert.Equal(t, refreshToken.Family, found.Family)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), used)
+}
+
+func testRegistration(t *testing.T, s storage.Interface) {
+	ctx := context.Background()
+
+	registration := &client.Registration{
+		Client: &client.Client{
+			ID:           "dynamic",
+			Secret:       "s3cret",
+			RedirectURIs: []string{"https://dynamic.com/callback"},
+		},
+		AccessTokenHash: "hash",
+		IssuedAt:        time.Now().Truncate(time.Second),
+	}
+	require.NoError(t, s.SaveRegistration(ctx, registration))
+
+	found, err := s.GetRegistration(ctx, "dynamic")
+	if assert.NoError(t, err) {
+		assert.Equal(t, registration.Client, found.Client)
+		assert.Equal(t, "hash", found.AccessTokenHash)
+	}
+
+	require.NoError(t, s.DeleteRegistration(ctx, "dynamic"))
+	_, err = s.GetRegistration(ctx, "dynamic")
+	assert.ErrorIs(t, err, client.ErrNotFound)
+}
+
+func testAssertionID(t *testing.T, s storage.Interface) {
+	ctx := context.Background()
+
+	require.NoError(t, s.SaveAssertionID(ctx, "foo:1", time.Now().Add(time.Minute)))
+	assert.ErrorIs(t, s.SaveAssertionID(ctx, "foo:1", time.Now().Add(time.Minute)), client.ErrAssertionReplayed)
+	assert.NoError(t, s.SaveAssertionID(ctx, "foo:2", time.Now().Add(time.Minute)))
+
+	require.NoError(t, s.SaveAssertionID(ctx, "foo:3", time.Now().Add(-time.Second)))
+	assert.NoError(t, s.SaveAssertionID(ctx, "foo:3", time.Now().Add(time.Minute)), "expired ids can be reused")
+}
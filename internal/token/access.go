@@ -0,0 +1,58 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrAccessTokenNotFound is returned by AccessTokenStore when the access token does not exist or has expired.
+	ErrAccessTokenNotFound = errors.New("access token not found")
+)
+
+// AccessToken is the opaque bearer token issued to the client to access protected resources on behalf of the
+// Authorization.
+type AccessToken struct {
+	Authorization
+	Value string `json:"value"`
+	// Family is the family of the refresh token issued along with this AccessToken, if any. Revoking the refresh token
+	// family revokes the access tokens of the same family.
+	Family    string    `json:"family,omitempty"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewAccessToken creates a new AccessToken for the Authorization which expires after the given lifespan.
+func NewAccessToken(authorization Authorization, lifespan time.Duration) *AccessToken {
+	now := time.Now()
+	return &AccessToken{
+		Authorization: authorization,
+		Value:         randomValue(32),
+		IssuedAt:      now,
+		ExpiresAt:     now.Add(lifespan),
+	}
+}
+
+// IsExpired returns true if the AccessToken is no longer valid at the moment.
+func (t *AccessToken) IsExpired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
+
+// ExpiresIn returns the remaining lifetime of the AccessToken in seconds.
+func (t *AccessToken) ExpiresIn() int64 {
+	return int64(time.Until(t.ExpiresAt).Round(time.Second).Seconds())
+}
+
+// AccessTokenStore persists access tokens.
+type AccessTokenStore interface {
+	// SaveAccessToken saves the access token.
+	SaveAccessToken(ctx context.Context, token *AccessToken) error
+	// GetAccessToken returns the access token by its value, or ErrAccessTokenNotFound if the token does not exist or
+	// has expired.
+	GetAccessToken(ctx context.Context, value string) (*AccessToken, error)
+	// DeleteAccessToken removes the access token. Deleting a non-existing token is not an error.
+	DeleteAccessToken(ctx context.Context, value string) error
+	// DeleteAccessTokenFamily removes all access tokens issued along with the refresh token family.
+	DeleteAccessTokenFamily(ctx context.Context, family string) error
+}
@@ -0,0 +1,55 @@
+package token
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+)
+
+// Authorization is the outcome of an authorization session: the End-User authentication, and the scopes and claims
+// authorized to the client. Codes and tokens are issued upon an Authorization.
+type Authorization struct {
+	ClientID string    `json:"client_id"`
+	Subject  string    `json:"sub"`
+	Scopes   []string  `json:"scopes,omitempty"`
+	Sid      string    `json:"sid,omitempty"`
+	Nonce    string    `json:"nonce,omitempty"`
+	AuthTime time.Time `json:"auth_time"`
+	ACR      string    `json:"acr,omitempty"`
+	AMR      []string  `json:"amr,omitempty"`
+	Claims   Claims    `json:"claims"`
+	// ClaimsRequest is the claims parameter of the authorization request, if any.
+	ClaimsRequest *ClaimsRequest `json:"claims_request,omitempty"`
+}
+
+// Claims are the End-User claims supplied by the provider, to be released in the id_token and userinfo response.
+type Claims struct {
+	IDToken  map[string]any `json:"id_token,omitempty"`
+	UserInfo map[string]any `json:"userinfo,omitempty"`
+}
+
+// Merge copies the claims from the other Claims into this Claims, overwriting values with the same name.
+func (c *Claims) Merge(other Claims) {
+	if len(other.IDToken) > 0 && c.IDToken == nil {
+		c.IDToken = map[string]any{}
+	}
+	for k, v := range other.IDToken {
+		c.IDToken[k] = v
+	}
+
+	if len(other.UserInfo) > 0 && c.UserInfo == nil {
+		c.UserInfo = map[string]any{}
+	}
+	for k, v := range other.UserInfo {
+		c.UserInfo[k] = v
+	}
+}
+
+// randomValue returns a url safe string encoded from n bytes of cryptographic random data.
+func randomValue(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
@@ -0,0 +1,77 @@
+package token
+
+import (
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/samber/lo"
+)
+
+// ClaimsRequest is the claims authorization request parameter defined in OpenID Connect Core 1.0 Section 5.5. Each
+// member maps the requested claim names to their options, which are nil when the claim is requested in default
+// manner.
+type ClaimsRequest struct {
+	IDToken  map[string]*ClaimOption `json:"id_token,omitempty"`
+	UserInfo map[string]*ClaimOption `json:"userinfo,omitempty"`
+}
+
+// ClaimOption is the options of an individually requested claim.
+type ClaimOption struct {
+	Essential bool  `json:"essential,omitempty"`
+	Value     any   `json:"value,omitempty"`
+	Values    []any `json:"values,omitempty"`
+}
+
+// Expand returns a new ClaimsRequest which, in addition to this request, requests the standard claims of the scopes
+// to be returned from the UserInfo endpoint, as defined in OpenID Connect Core 1.0 Section 5.4. A nil ClaimsRequest
+// expands to the scope claims only.
+func (r *ClaimsRequest) Expand(scopes []string) *ClaimsRequest {
+	expanded := &ClaimsRequest{
+		IDToken:  map[string]*ClaimOption{},
+		UserInfo: map[string]*ClaimOption{},
+	}
+
+	for _, scope := range scopes {
+		for _, name := range spec.ScopeClaims[scope] {
+			expanded.UserInfo[name] = nil
+		}
+	}
+
+	if r != nil {
+		for name, option := range r.IDToken {
+			expanded.IDToken[name] = option
+		}
+		for name, option := range r.UserInfo {
+			expanded.UserInfo[name] = option
+		}
+	}
+
+	return expanded
+}
+
+// UserInfoClaims returns the userinfo claims releasable under the scopes and the claims request: standard claims are
+// released when requested by a granted scope or by the claims request, while other claims supplied by the provider
+// are released as is. The sub claim is always set to the subject.
+func (a Authorization) UserInfoClaims() map[string]any {
+	var (
+		requested = a.ClaimsRequest.Expand(a.Scopes).UserInfo
+		claims    = map[string]any{}
+	)
+
+	for name, value := range a.Claims.UserInfo {
+		_, ok := requested[name]
+		if ok || !isStandardClaim(name) {
+			claims[name] = value
+		}
+	}
+	claims["sub"] = a.Subject
+
+	return claims
+}
+
+func isStandardClaim(name string) bool {
+	for _, names := range spec.ScopeClaims {
+		if lo.Contains(names, name) {
+			return true
+		}
+	}
+	return false
+}
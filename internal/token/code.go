@@ -0,0 +1,64 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/oklog/ulid/v2"
+	"time"
+)
+
+var (
+	// ErrCodeNotFound is returned by CodeStore when the authorization code does not exist or has expired.
+	ErrCodeNotFound = errors.New("authorization code not found")
+	// ErrCodeRedeemed is returned by CodeStore when the authorization code has already been redeemed.
+	ErrCodeRedeemed = errors.New("authorization code redeemed")
+)
+
+// Code is the authorization code issued at the end of an authorization session, to be redeemed at the token endpoint.
+// The tokens issued on redemption join the Family of the Code, so they can be revoked when the code is replayed. A
+// redeemed Code is kept until expiry to detect replays.
+type Code struct {
+	Authorization
+	Value       string    `json:"value"`
+	Family      string    `json:"family"`
+	RedirectURI string    `json:"redirect_uri"`
+	Redeemed    bool      `json:"redeemed,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+
+	CodeChallenge       string                   `json:"code_challenge,omitempty"`
+	CodeChallengeMethod spec.CodeChallengeMethod `json:"code_challenge_method,omitempty"`
+}
+
+// NewCode creates a new Code for the Authorization which expires after the given lifespan.
+func NewCode(authorization Authorization, redirectURI string, lifespan time.Duration) *Code {
+	return &Code{
+		Authorization: authorization,
+		Value:         randomValue(32),
+		Family:        ulid.Make().String(),
+		RedirectURI:   redirectURI,
+		ExpiresAt:     time.Now().Add(lifespan),
+	}
+}
+
+// WithChallenge binds the PKCE code challenge from the authorization request to the Code.
+func (c *Code) WithChallenge(challenge string, method spec.CodeChallengeMethod) *Code {
+	c.CodeChallenge = challenge
+	c.CodeChallengeMethod = method
+	return c
+}
+
+// IsExpired returns true if the Code is no longer redeemable at the moment.
+func (c *Code) IsExpired() bool {
+	return time.Now().After(c.ExpiresAt)
+}
+
+// CodeStore persists authorization codes.
+type CodeStore interface {
+	// SaveCode saves the authorization code.
+	SaveCode(ctx context.Context, code *Code) error
+	// RedeemCode returns the authorization code by its value and atomically marks it as redeemed, so it can never be
+	// redeemed again. If the code has already been redeemed, it is returned along with ErrCodeRedeemed. If the code
+	// does not exist or has expired, ErrCodeNotFound is returned.
+	RedeemCode(ctx context.Context, value string) (*Code, error)
+}
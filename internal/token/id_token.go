@@ -0,0 +1,59 @@
+package token
+
+import (
+	"crypto"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/spec"
+)
+
+// idTokenClaims are the claims of an id_token. The End-User claims supplied by the provider are encoded first, so
+// they can never overwrite the claims asserted by the server.
+type idTokenClaims struct {
+	std      *jose.StdClaims
+	extra    *idTokenExtraClaims
+	provider map[string]any
+}
+
+type idTokenExtraClaims struct {
+	AuthTime int64    `json:"auth_time,omitempty"`
+	Nonce    string   `json:"nonce,omitempty"`
+	ACR      string   `json:"acr,omitempty"`
+	AMR      []string `json:"amr,omitempty"`
+	AZP      string   `json:"azp,omitempty"`
+	Sid      string   `json:"sid,omitempty"`
+	AtHash   string   `json:"at_hash,omitempty"`
+}
+
+func (c *idTokenClaims) MultipleClaims() []any {
+	claims := make([]any, 0, 3)
+	if len(c.provider) > 0 {
+		claims = append(claims, c.provider)
+	}
+	return append(claims, c.std, c.extra)
+}
+
+// halfHash computes the at_hash value of the token: the base64url encoded left-most half of the hash of the
+// token, using the hash algorithm of the id_token signature algorithm.
+func halfHash(value string, alg spec.SignatureAlgorithm) string {
+	var h crypto.Hash
+
+	switch alg {
+	case spec.HS256, spec.RS256, spec.ES256, spec.PS256:
+		h = crypto.SHA256
+	case spec.HS384, spec.RS384, spec.ES384, spec.PS384:
+		h = crypto.SHA384
+	case spec.HS512, spec.RS512, spec.ES512, spec.PS512:
+		h = crypto.SHA512
+	default:
+		return ""
+	}
+
+	hasher := h.New()
+	hasher.Write([]byte(value))
+	sum := hasher.Sum(nil)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
@@ -0,0 +1,153 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"github.com/Southclaws/fault"
+	"github.com/Southclaws/fault/fmsg"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/spec"
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"net/url"
+)
+
+// IntrospectionRequest is the token introspection request defined in RFC 7662 Section 2.1.
+type IntrospectionRequest struct {
+	Token         string         `json:"token"`
+	TokenTypeHint spec.TokenType `json:"token_type_hint,omitempty"`
+	// Credentials are the client authentication parameters of the protected resource.
+	Credentials *client.Credentials `json:"-"`
+}
+
+// ParseIntrospectionRequest parses the introspection request from form parameters, along with the client credentials
+// parsed by client.ParseCredentials. Unknown token_type_hint values are ignored, as the hint is only an optimization.
+func ParseIntrospectionRequest(values url.Values, credentials *client.Credentials) (*IntrospectionRequest, error) {
+	req := &IntrospectionRequest{
+		Token:       values.Get("token"),
+		Credentials: credentials,
+	}
+
+	if hint := values.Get("token_type_hint"); len(hint) > 0 {
+		_ = spec.Parse(hint, &req.TokenTypeHint)
+	}
+
+	if err := v.Validate(req.Token, v.Required); err != nil {
+		return nil, fault.Wrap(ErrRequest,
+			ftag.With(spec.ErrKindInvalidRequest),
+			fmsg.WithDesc("token: "+err.Error(), "The token parameter is required."),
+		)
+	}
+
+	return req, nil
+}
+
+// Introspection is the introspection response defined in RFC 7662 Section 2.2. Inactive tokens report nothing but
+// Active.
+type Introspection struct {
+	Active    bool           `json:"active"`
+	Scope     string         `json:"scope,omitempty"`
+	ClientID  string         `json:"client_id,omitempty"`
+	Subject   string         `json:"sub,omitempty"`
+	Audience  []string       `json:"aud,omitempty"`
+	Issuer    string         `json:"iss,omitempty"`
+	ExpiresAt int64          `json:"exp,omitempty"`
+	IssuedAt  int64          `json:"iat,omitempty"`
+	TokenType spec.TokenType `json:"token_type,omitempty"`
+}
+
+// Introspect authenticates the protected resource, and reports the state of the access or refresh token in the
+// request. Only confidential clients may introspect tokens, and only those issued to themselves unless they are
+// allowed to introspect tokens of any client. Expired, rotated or unknown tokens, tokens the caller may not
+// introspect, and tokens of clients no longer registered, are reported as inactive.
+func (s *Service) Introspect(ctx context.Context, req *IntrospectionRequest) (*Introspection, error) {
+	c, err := s.authenticator.Authenticate(ctx, req.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	if !c.IsConfidential() {
+		return nil, fault.Wrap(client.ErrAuthentication,
+			ftag.With(spec.ErrKindInvalidClient),
+			fmsg.WithDesc("public client introspection", "Only confidential clients may introspect tokens."),
+		)
+	}
+
+	lookups := []func(ctx context.Context, value string) (*Introspection, error){
+		s.introspectAccessToken,
+		s.introspectRefreshToken,
+	}
+	if req.TokenTypeHint == spec.TokenTypeRefresh {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	for _, lookup := range lookups {
+		introspection, err := lookup(ctx, req.Token)
+		if err != nil {
+			return nil, err
+		}
+		if introspection.Active {
+			if introspection.ClientID != c.ID && !c.Introspection {
+				return &Introspection{Active: false}, nil
+			}
+			return s.unlessDeregistered(ctx, introspection)
+		}
+	}
+
+	return &Introspection{Active: false}, nil
+}
+
+// unlessDeregistered returns the active introspection, or an inactive one if the client the token was issued to is no
+// longer registered.
+func (s *Service) unlessDeregistered(ctx context.Context, introspection *Introspection) (*Introspection, error) {
+	_, err := s.clients.Find(ctx, introspection.ClientID)
+	switch {
+	case errors.Is(err, client.ErrNotFound):
+		return &Introspection{Active: false}, nil
+	case err != nil:
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	return introspection, nil
+}
+
+func (s *Service) introspectAccessToken(ctx context.Context, value string) (*Introspection, error) {
+	at, err := s.accessTokens.GetAccessToken(ctx, value)
+	switch {
+	case errors.Is(err, ErrAccessTokenNotFound):
+		return &Introspection{Active: false}, nil
+	case err != nil:
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	case at.IsExpired():
+		return &Introspection{Active: false}, nil
+	}
+
+	return s.introspection(at.Authorization, at.IssuedAt.Unix(), at.ExpiresAt.Unix(), spec.TokenTypeAccess), nil
+}
+
+func (s *Service) introspectRefreshToken(ctx context.Context, value string) (*Introspection, error) {
+	rt, err := s.refreshTokens.GetRefreshToken(ctx, value)
+	switch {
+	case errors.Is(err, ErrRefreshTokenNotFound):
+		return &Introspection{Active: false}, nil
+	case err != nil:
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	case rt.Used || rt.IsExpired():
+		return &Introspection{Active: false}, nil
+	}
+
+	return s.introspection(rt.Authorization, rt.IssuedAt.Unix(), rt.ExpiresAt.Unix(), spec.TokenTypeRefresh), nil
+}
+
+func (s *Service) introspection(authorization Authorization, iat int64, exp int64, tokenType spec.TokenType) *Introspection {
+	return &Introspection{
+		Active:    true,
+		Scope:     spaceDelimited(authorization.Scopes),
+		ClientID:  authorization.ClientID,
+		Subject:   authorization.Subject,
+		Audience:  []string{authorization.ClientID},
+		Issuer:    s.issuer,
+		ExpiresAt: exp,
+		IssuedAt:  iat,
+		TokenType: tokenType,
+	}
+}
@@ -0,0 +1,175 @@
+//go:build unit
+
+package token_test
+
+import (
+	"context"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestService_Introspect(t *testing.T) {
+	service, codes, _ := newTestService(t)
+	ctx := context.Background()
+
+	code := token.NewCode(token.Authorization{
+		ClientID: "foo",
+		Subject:  "alice",
+		Scopes:   []string{"openid", "offline_access"},
+	}, "https://foo.com/callback", time.Minute)
+	require.NoError(t, codes.SaveCode(ctx, code))
+
+	issued, err := service.Exchange(ctx, &token.Request{
+		GrantType:   spec.GrantTypeAuthorizationCode,
+		ClientID:    "foo",
+		Credentials: &client.Credentials{ClientID: "foo"},
+		Code:        code.Value,
+		RedirectURI: "https://foo.com/callback",
+	})
+	require.NoError(t, err)
+
+	rotated, err := service.Exchange(ctx, &token.Request{
+		GrantType:    spec.GrantTypeRefreshToken,
+		ClientID:     "foo",
+		Credentials:  &client.Credentials{ClientID: "foo"},
+		RefreshToken: issued.RefreshToken,
+	})
+	require.NoError(t, err)
+
+	machine := &client.Credentials{ClientID: "machine", ClientSecret: "s3cret", Basic: true}
+	worker := &client.Credentials{ClientID: "worker", ClientSecret: "s3cret", Basic: true}
+
+	own, err := service.Exchange(ctx, &token.Request{
+		GrantType:   spec.GrantTypeClientCredentials,
+		ClientID:    "worker",
+		Credentials: worker,
+	})
+	require.NoError(t, err)
+
+	deregistered := token.NewAccessToken(token.Authorization{ClientID: "gone", Subject: "alice"}, time.Hour)
+	require.NoError(t, codes.SaveAccessToken(ctx, deregistered))
+
+	cases := []struct {
+		name   string
+		req    *token.IntrospectionRequest
+		expect ftag.Kind
+		assert func(t *testing.T, resp *token.Introspection)
+	}{
+		{
+			name: "access token",
+			req:  &token.IntrospectionRequest{Token: issued.AccessToken, Credentials: machine},
+			assert: func(t *testing.T, resp *token.Introspection) {
+				assert.True(t, resp.Active)
+				assert.Equal(t, "openid offline_access", resp.Scope)
+				assert.Equal(t, "foo", resp.ClientID)
+				assert.Equal(t, "alice", resp.Subject)
+				assert.Equal(t, []string{"foo"}, resp.Audience)
+				assert.Equal(t, spec.TokenTypeAccess, resp.TokenType)
+				assert.Greater(t, resp.ExpiresAt, resp.IssuedAt)
+			},
+		},
+		{
+			name: "refresh token with hint",
+			req: &token.IntrospectionRequest{
+				Token:         rotated.RefreshToken,
+				TokenTypeHint: spec.TokenTypeRefresh,
+				Credentials:   machine,
+			},
+			assert: func(t *testing.T, resp *token.Introspection) {
+				assert.True(t, resp.Active)
+				assert.Equal(t, spec.TokenTypeRefresh, resp.TokenType)
+			},
+		},
+		{
+			name: "rotated refresh token",
+			req:  &token.IntrospectionRequest{Token: issued.RefreshToken, Credentials: machine},
+			assert: func(t *testing.T, resp *token.Introspection) {
+				assert.Equal(t, &token.Introspection{Active: false}, resp)
+			},
+		},
+		{
+			name: "unknown token",
+			req:  &token.IntrospectionRequest{Token: "unknown", Credentials: machine},
+			assert: func(t *testing.T, resp *token.Introspection) {
+				assert.False(t, resp.Active)
+			},
+		},
+		{
+			name: "token of deregistered client",
+			req:  &token.IntrospectionRequest{Token: deregistered.Value, Credentials: machine},
+			assert: func(t *testing.T, resp *token.Introspection) {
+				assert.Equal(t, &token.Introspection{Active: false}, resp)
+			},
+		},
+		{
+			name: "own token",
+			req:  &token.IntrospectionRequest{Token: own.AccessToken, Credentials: worker},
+			assert: func(t *testing.T, resp *token.Introspection) {
+				assert.True(t, resp.Active)
+				assert.Equal(t, "worker", resp.ClientID)
+			},
+		},
+		{
+			name: "token of another client",
+			req:  &token.IntrospectionRequest{Token: issued.AccessToken, Credentials: worker},
+			assert: func(t *testing.T, resp *token.Introspection) {
+				assert.Equal(t, &token.Introspection{Active: false}, resp)
+			},
+		},
+		{
+			name: "wrong credentials",
+			req: &token.IntrospectionRequest{
+				Token:       issued.AccessToken,
+				Credentials: &client.Credentials{ClientID: "machine", ClientSecret: "wrong", Basic: true},
+			},
+			expect: spec.ErrKindInvalidClient,
+		},
+		{
+			name: "public client",
+			req: &token.IntrospectionRequest{
+				Token:       issued.AccessToken,
+				Credentials: &client.Credentials{ClientID: "foo"},
+			},
+			expect: spec.ErrKindInvalidClient,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp, err := service.Introspect(ctx, c.req)
+			if len(c.expect) > 0 {
+				assert.Equal(t, c.expect, ftag.Get(err))
+			} else if assert.NoError(t, err) {
+				c.assert(t, resp)
+			}
+		})
+	}
+}
+
+func TestParseIntrospectionRequest(t *testing.T) {
+	req, err := token.ParseIntrospectionRequest(map[string][]string{
+		"token":           {"xyz"},
+		"token_type_hint": {"refresh_token"},
+	}, new(client.Credentials))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "xyz", req.Token)
+		assert.Equal(t, spec.TokenTypeRefresh, req.TokenTypeHint)
+	}
+
+	req, err = token.ParseIntrospectionRequest(map[string][]string{
+		"token":           {"xyz"},
+		"token_type_hint": {"unknown"},
+	}, new(client.Credentials))
+	if assert.NoError(t, err) {
+		assert.Zero(t, req.TokenTypeHint)
+	}
+
+	_, err = token.ParseIntrospectionRequest(map[string][]string{}, new(client.Credentials))
+	assert.Equal(t, spec.ErrKindInvalidRequest, ftag.Get(err))
+}
@@ -0,0 +1,49 @@
+package token
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"github.com/absurdlab/tigerd/internal/spec"
+)
+
+// codeVerifier is the validation rule for the format of the PKCE code_verifier parameter, as defined in RFC 7636
+// Section 4.1. Empty values are ignored.
+func codeVerifier(value any) error {
+	verifier, _ := value.(string)
+	if len(verifier) == 0 {
+		return nil
+	}
+
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return errors.New("must be between 43 and 128 characters")
+	}
+
+	for _, r := range verifier {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.', r == '_', r == '~':
+		default:
+			return errors.New("must only contain unreserved characters")
+		}
+	}
+
+	return nil
+}
+
+// verifyCodeChallenge returns true if the verifier transforms to the challenge with the method.
+func verifyCodeChallenge(challenge string, method spec.CodeChallengeMethod, verifier string) bool {
+	var computed string
+
+	switch method {
+	case spec.CodeChallengeMethodPlain:
+		computed = verifier
+	case spec.CodeChallengeMethodS256:
+		sum := sha256.Sum256([]byte(verifier))
+		computed = base64.RawURLEncoding.EncodeToString(sum[:])
+	default:
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
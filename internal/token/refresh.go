@@ -0,0 +1,67 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"github.com/oklog/ulid/v2"
+	"time"
+)
+
+var (
+	// ErrRefreshTokenNotFound is returned by RefreshTokenStore when the refresh token does not exist or has expired.
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	// ErrRefreshTokenReused is returned by RefreshTokenStore when a refresh token which has already been rotated is
+	// used again.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// RefreshToken is the token issued to the client to obtain new access tokens on the Authorization. Refresh tokens are
+// rotated on every use: the used token is kept until expiry to detect replays, and its successor inherits the Family.
+type RefreshToken struct {
+	Authorization
+	Value     string    `json:"value"`
+	Family    string    `json:"family"`
+	Used      bool      `json:"used,omitempty"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewRefreshToken creates a new RefreshToken for the Authorization in a new family, which expires after the given
+// lifespan.
+func NewRefreshToken(authorization Authorization, lifespan time.Duration) *RefreshToken {
+	now := time.Now()
+	return &RefreshToken{
+		Authorization: authorization,
+		Value:         randomValue(32),
+		Family:        ulid.Make().String(),
+		IssuedAt:      now,
+		ExpiresAt:     now.Add(lifespan),
+	}
+}
+
+// rotate returns the successor of this RefreshToken in the same family, on the same Authorization.
+func (t *RefreshToken) rotate(lifespan time.Duration) *RefreshToken {
+	next := NewRefreshToken(t.Authorization, lifespan)
+	next.Family = t.Family
+	return next
+}
+
+// IsExpired returns true if the RefreshToken is no longer valid at the moment.
+func (t *RefreshToken) IsExpired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
+
+// RefreshTokenStore persists refresh tokens.
+type RefreshTokenStore interface {
+	// SaveRefreshToken saves the refresh token.
+	SaveRefreshToken(ctx context.Context, token *RefreshToken) error
+	// GetRefreshToken returns the refresh token by its value regardless of whether it has been used, or
+	// ErrRefreshTokenNotFound if the token does not exist or has expired.
+	GetRefreshToken(ctx context.Context, value string) (*RefreshToken, error)
+	// UseRefreshToken atomically marks the refresh token as used. If the token has already been used,
+	// ErrRefreshTokenReused is returned. If the token does not exist or has expired, ErrRefreshTokenNotFound is
+	// returned.
+	UseRefreshToken(ctx context.Context, value string) error
+	// DeleteRefreshTokenFamily removes all refresh tokens in the family.
+	DeleteRefreshTokenFamily(ctx context.Context, family string) error
+}
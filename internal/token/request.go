@@ -0,0 +1,94 @@
+package token
+
+import (
+	"errors"
+	"github.com/Southclaws/fault"
+	"github.com/Southclaws/fault/fmsg"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/spec"
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrRequest is the root error returned when the token request is malformed or contains invalid values.
+	ErrRequest = errors.New("token request is invalid")
+)
+
+// Request is the access token request defined in OAuth 2.0.
+type Request struct {
+	GrantType spec.GrantType `json:"grant_type"`
+	ClientID  string         `json:"client_id"`
+	// Credentials are the client authentication parameters of the request.
+	Credentials  *client.Credentials `json:"-"`
+	Code         string              `json:"code,omitempty"`
+	RedirectURI  string              `json:"redirect_uri,omitempty"`
+	CodeVerifier string              `json:"code_verifier,omitempty"`
+	RefreshToken string              `json:"refresh_token,omitempty"`
+	Scopes       []string            `json:"scopes,omitempty"`
+}
+
+// ParseRequest parses the token request from form parameters, along with the client credentials parsed by
+// client.ParseCredentials. Only the format of each parameter is checked, call Request.Validate to check the request
+// as a whole.
+func ParseRequest(values url.Values, credentials *client.Credentials) (*Request, error) {
+	req := &Request{
+		ClientID:     credentials.ClientID,
+		Credentials:  credentials,
+		Code:         values.Get("code"),
+		RedirectURI:  values.Get("redirect_uri"),
+		CodeVerifier: values.Get("code_verifier"),
+		RefreshToken: values.Get("refresh_token"),
+		Scopes:       strings.Fields(values.Get("scope")),
+	}
+
+	if grantType := values.Get("grant_type"); len(grantType) > 0 {
+		if err := spec.Parse(grantType, &req.GrantType); err != nil {
+			return nil, fault.Wrap(ErrRequest,
+				ftag.With(spec.ErrKindUnsupportedGrantType),
+				fmsg.WithDesc(err.Error(), "Unsupported grant_type."),
+			)
+		}
+	}
+
+	return req, nil
+}
+
+// Validate performs validation on the Request and returns an error if exists violation. The returned error will be
+// a ErrRequest.
+func (r *Request) Validate() error {
+	switch r.GrantType {
+	case 0, spec.GrantTypeAuthorizationCode, spec.GrantTypeRefreshToken, spec.GrantTypeClientCredentials:
+	default:
+		return fault.Wrap(ErrRequest,
+			ftag.With(spec.ErrKindUnsupportedGrantType),
+			fmsg.WithDesc("unsupported grant_type", "The grant_type is not supported by the token endpoint."),
+		)
+	}
+
+	var (
+		authorizationCode = r.GrantType == spec.GrantTypeAuthorizationCode
+		refreshToken      = r.GrantType == spec.GrantTypeRefreshToken
+	)
+
+	err := v.Errors{
+		"grant_type": v.Validate(r.GrantType, v.Required),
+		"client_id": v.Validate(r.ClientID, v.When(r.Credentials == nil || len(r.Credentials.Assertion) == 0,
+			v.Required,
+		)),
+		"code":          v.Validate(r.Code, v.When(authorizationCode, v.Required)),
+		"code_verifier": v.Validate(r.CodeVerifier, v.By(codeVerifier)),
+		"refresh_token": v.Validate(r.RefreshToken, v.When(refreshToken, v.Required)),
+	}.Filter()
+
+	if err != nil {
+		return fault.Wrap(ErrRequest,
+			ftag.With(spec.ErrKindInvalidRequest),
+			fmsg.WithDesc(err.Error(), err.Error()),
+		)
+	}
+
+	return nil
+}
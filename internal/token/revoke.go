@@ -0,0 +1,124 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"github.com/Southclaws/fault"
+	"github.com/Southclaws/fault/fmsg"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/spec"
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"net/url"
+)
+
+// RevocationRequest is the token revocation request defined in RFC 7009 Section 2.1.
+type RevocationRequest struct {
+	Token         string         `json:"token"`
+	TokenTypeHint spec.TokenType `json:"token_type_hint,omitempty"`
+	// Credentials are the client authentication parameters of the request.
+	Credentials *client.Credentials `json:"-"`
+}
+
+// ParseRevocationRequest parses the revocation request from form parameters, along with the client credentials parsed
+// by client.ParseCredentials. Unknown token_type_hint values are ignored, and all token types are searched, as RFC 7009
+// Section 2.1 allows. The server revokes every token type it stores, so unsupported_token_type never applies.
+func ParseRevocationRequest(values url.Values, credentials *client.Credentials) (*RevocationRequest, error) {
+	req := &RevocationRequest{
+		Token:       values.Get("token"),
+		Credentials: credentials,
+	}
+
+	if hint := values.Get("token_type_hint"); len(hint) > 0 {
+		_ = spec.Parse(hint, &req.TokenTypeHint)
+	}
+
+	if err := v.Validate(req.Token, v.Required); err != nil {
+		return nil, fault.Wrap(ErrRequest,
+			ftag.With(spec.ErrKindInvalidRequest),
+			fmsg.WithDesc("token: "+err.Error(), "The token parameter is required."),
+		)
+	}
+
+	return req, nil
+}
+
+// Revoke authenticates the client, and revokes the access or refresh token in the request. Revoking a refresh token
+// revokes the whole grant: every refresh token in its family, and the access tokens issued along with them. Unknown,
+// expired or already revoked tokens are not an error. Tokens issued to another client are rejected.
+func (s *Service) Revoke(ctx context.Context, req *RevocationRequest) error {
+	c, err := s.authenticator.Authenticate(ctx, req.Credentials)
+	if err != nil {
+		return err
+	}
+
+	lookups := []func(ctx context.Context, c *client.Client, value string) (bool, error){
+		s.revokeAccessToken,
+		s.revokeRefreshToken,
+	}
+	if req.TokenTypeHint == spec.TokenTypeRefresh {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	for _, lookup := range lookups {
+		if found, err := lookup(ctx, c, req.Token); err != nil || found {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) revokeAccessToken(ctx context.Context, c *client.Client, value string) (bool, error) {
+	at, err := s.accessTokens.GetAccessToken(ctx, value)
+	switch {
+	case errors.Is(err, ErrAccessTokenNotFound):
+		return false, nil
+	case err != nil:
+		return false, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	case at.ClientID != c.ID:
+		return true, revocationError()
+	}
+
+	if err = s.accessTokens.DeleteAccessToken(ctx, value); err != nil {
+		return true, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	return true, nil
+}
+
+func (s *Service) revokeRefreshToken(ctx context.Context, c *client.Client, value string) (bool, error) {
+	rt, err := s.refreshTokens.GetRefreshToken(ctx, value)
+	switch {
+	case errors.Is(err, ErrRefreshTokenNotFound):
+		return false, nil
+	case err != nil:
+		return false, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	case rt.ClientID != c.ID:
+		return true, revocationError()
+	}
+
+	return true, s.revokeFamily(ctx, rt.Family)
+}
+
+// revokeFamily deletes the refresh token family, and the access tokens issued along with it. Tokens issued outside any
+// family, such as by the client_credentials grant, are never revoked this way.
+func (s *Service) revokeFamily(ctx context.Context, family string) error {
+	if len(family) == 0 {
+		return nil
+	}
+	if err := s.refreshTokens.DeleteRefreshTokenFamily(ctx, family); err != nil {
+		return fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+	if err := s.accessTokens.DeleteAccessTokenFamily(ctx, family); err != nil {
+		return fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+	return nil
+}
+
+func revocationError() error {
+	return fault.Wrap(ErrGrant,
+		ftag.With(spec.ErrKindUnauthorizedClient),
+		fmsg.WithDesc("token issued to another client", "The token was not issued to the client."),
+	)
+}
@@ -0,0 +1,138 @@
+//go:build unit
+
+package token_test
+
+import (
+	"context"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestService_Revoke(t *testing.T) {
+	var (
+		foo     = &client.Credentials{ClientID: "foo"}
+		machine = &client.Credentials{ClientID: "machine", ClientSecret: "s3cret", Basic: true}
+	)
+
+	cases := []struct {
+		name   string
+		req    func(issued, rotated *token.Response) *token.RevocationRequest
+		expect ftag.Kind
+		active [4]bool
+	}{
+		{
+			name: "access token",
+			req: func(issued, rotated *token.Response) *token.RevocationRequest {
+				return &token.RevocationRequest{Token: rotated.AccessToken, Credentials: foo}
+			},
+			active: [4]bool{true, false, false, true},
+		},
+		{
+			name: "refresh token",
+			req: func(issued, rotated *token.Response) *token.RevocationRequest {
+				return &token.RevocationRequest{
+					Token:         rotated.RefreshToken,
+					TokenTypeHint: spec.TokenTypeRefresh,
+					Credentials:   foo,
+				}
+			},
+			active: [4]bool{false, false, false, false},
+		},
+		{
+			name: "unknown token",
+			req: func(issued, rotated *token.Response) *token.RevocationRequest {
+				return &token.RevocationRequest{Token: "unknown", Credentials: foo}
+			},
+			active: [4]bool{true, false, true, true},
+		},
+		{
+			name: "token of another client",
+			req: func(issued, rotated *token.Response) *token.RevocationRequest {
+				return &token.RevocationRequest{Token: rotated.RefreshToken, Credentials: machine}
+			},
+			expect: spec.ErrKindUnauthorizedClient,
+			active: [4]bool{true, false, true, true},
+		},
+		{
+			name: "unknown client",
+			req: func(issued, rotated *token.Response) *token.RevocationRequest {
+				return &token.RevocationRequest{Token: rotated.AccessToken, Credentials: &client.Credentials{ClientID: "unknown"}}
+			},
+			expect: spec.ErrKindInvalidClient,
+			active: [4]bool{true, false, true, true},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			service, codes, _ := newTestService(t)
+			ctx := context.Background()
+
+			code := token.NewCode(token.Authorization{
+				ClientID: "foo",
+				Subject:  "alice",
+				Scopes:   []string{"openid", "offline_access"},
+			}, "https://foo.com/callback", time.Minute)
+			require.NoError(t, codes.SaveCode(ctx, code))
+
+			issued, err := service.Exchange(ctx, &token.Request{
+				GrantType:   spec.GrantTypeAuthorizationCode,
+				ClientID:    "foo",
+				Credentials: foo,
+				Code:        code.Value,
+				RedirectURI: "https://foo.com/callback",
+			})
+			require.NoError(t, err)
+
+			rotated, err := service.Exchange(ctx, &token.Request{
+				GrantType:    spec.GrantTypeRefreshToken,
+				ClientID:     "foo",
+				Credentials:  foo,
+				RefreshToken: issued.RefreshToken,
+			})
+			require.NoError(t, err)
+
+			err = service.Revoke(ctx, c.req(issued, rotated))
+			if len(c.expect) > 0 {
+				assert.Equal(t, c.expect, ftag.Get(err))
+			} else {
+				assert.NoError(t, err)
+			}
+
+			for i, value := range []string{issued.AccessToken, issued.RefreshToken, rotated.AccessToken, rotated.RefreshToken} {
+				resp, err := service.Introspect(ctx, &token.IntrospectionRequest{Token: value, Credentials: machine})
+				if assert.NoError(t, err) {
+					assert.Equal(t, c.active[i], resp.Active, "token #%d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRevocationRequest(t *testing.T) {
+	req, err := token.ParseRevocationRequest(map[string][]string{
+		"token":           {"xyz"},
+		"token_type_hint": {"access_token"},
+	}, new(client.Credentials))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "xyz", req.Token)
+		assert.Equal(t, spec.TokenTypeAccess, req.TokenTypeHint)
+	}
+
+	req, err = token.ParseRevocationRequest(map[string][]string{
+		"token":           {"xyz"},
+		"token_type_hint": {"unknown"},
+	}, new(client.Credentials))
+	if assert.NoError(t, err) {
+		assert.Zero(t, req.TokenTypeHint)
+	}
+
+	_, err = token.ParseRevocationRequest(map[string][]string{}, new(client.Credentials))
+	assert.Equal(t, spec.ErrKindInvalidRequest, ftag.Get(err))
+}
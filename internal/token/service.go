@@ -0,0 +1,343 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Southclaws/fault"
+	"github.com/Southclaws/fault/fmsg"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/wellknown"
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/samber/lo"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrGrant is the root error returned when the authorization grant presented in the token request is invalid.
+	ErrGrant = errors.New("authorization grant is invalid")
+)
+
+const (
+	tokenTypeBearer = "Bearer"
+)
+
+// Properties is the configuration properties for the token service.
+type Properties struct {
+	// AccessTokenLifespan is the duration an access token remains valid.
+	AccessTokenLifespan time.Duration `json:"access_token_lifespan" yaml:"access_token_lifespan"`
+	// IDTokenLifespan is the duration an id_token remains valid.
+	IDTokenLifespan time.Duration `json:"id_token_lifespan" yaml:"id_token_lifespan"`
+	// RefreshTokenLifespan is the duration a refresh token remains valid. Each rotation starts a new lifespan.
+	RefreshTokenLifespan time.Duration `json:"refresh_token_lifespan" yaml:"refresh_token_lifespan"`
+}
+
+// Validate performs validation to this Properties.
+func (p *Properties) Validate() error {
+	return v.Errors{
+		"access_token_lifespan":  v.Validate(p.AccessTokenLifespan, v.Required),
+		"id_token_lifespan":      v.Validate(p.IDTokenLifespan, v.Required),
+		"refresh_token_lifespan": v.Validate(p.RefreshTokenLifespan, v.Required),
+	}.Filter()
+}
+
+// Response is the successful access token response.
+type Response struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// NewService creates a Service which signs id_tokens with the first algorithm from the id_token signing algorithms
+// advertised in Discovery that has a key in the JSONWebKeySet, or RS256 when none is advertised.
+func NewService(
+	props *Properties,
+	discovery *wellknown.Discovery,
+	jwks *jose.JSONWebKeySet,
+	codes CodeStore,
+	accessTokens AccessTokenStore,
+	refreshTokens RefreshTokenStore,
+	authenticator *client.Authenticator,
+	clients client.Registry,
+) *Service {
+	alg, ok := lo.Find(discovery.IdTokenSigningAlgValuesSupported, func(alg spec.SignatureAlgorithm) bool {
+		return !alg.IsNoneOrEmpty() && jwks.FindForSigning(alg) != nil
+	})
+	if !ok {
+		alg = spec.RS256
+	}
+
+	return &Service{
+		props:         props,
+		issuer:        discovery.Issuer,
+		jwks:          jwks,
+		idTokenAlg:    alg,
+		codes:         codes,
+		accessTokens:  accessTokens,
+		refreshTokens: refreshTokens,
+		authenticator: authenticator,
+		clients:       clients,
+	}
+}
+
+// Service issues tokens in exchange for authorization grants.
+type Service struct {
+	props         *Properties
+	issuer        string
+	jwks          *jose.JSONWebKeySet
+	idTokenAlg    spec.SignatureAlgorithm
+	codes         CodeStore
+	accessTokens  AccessTokenStore
+	refreshTokens RefreshTokenStore
+	authenticator *client.Authenticator
+	clients       client.Registry
+}
+
+// Exchange validates the token request, authenticates the client, and issues tokens for the authorization grant in
+// the request.
+func (s *Service) Exchange(ctx context.Context, req *Request) (*Response, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	c, err := s.authenticator.Authenticate(ctx, req.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	req.ClientID = c.ID
+
+	if !c.AllowsGrantType(req.GrantType) {
+		return nil, fault.Wrap(ErrGrant,
+			ftag.With(spec.ErrKindUnauthorizedClient),
+			fmsg.WithDesc("grant type not registered", fmt.Sprintf("The client is not registered for the %s grant_type.", req.GrantType)),
+		)
+	}
+
+	switch req.GrantType {
+	case spec.GrantTypeAuthorizationCode:
+		return s.authorizationCode(ctx, c, req)
+	case spec.GrantTypeRefreshToken:
+		return s.refreshToken(ctx, c, req)
+	case spec.GrantTypeClientCredentials:
+		return s.clientCredentials(ctx, c, req)
+	default:
+		return nil, fault.Wrap(ErrRequest, ftag.With(spec.ErrKindUnsupportedGrantType))
+	}
+}
+
+func (s *Service) authorizationCode(ctx context.Context, c *client.Client, req *Request) (*Response, error) {
+	code, err := s.codes.RedeemCode(ctx, req.Code)
+	switch {
+	case errors.Is(err, ErrCodeRedeemed):
+		if err = s.revokeFamily(ctx, code.Family); err != nil {
+			return nil, err
+		}
+		return nil, grantError("code replayed", "The authorization code is invalid, expired or already redeemed.")
+	case errors.Is(err, ErrCodeNotFound):
+		return nil, grantError("code not found", "The authorization code is invalid, expired or already redeemed.")
+	case err != nil:
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	switch {
+	case code.ClientID != req.ClientID:
+		return nil, grantError("client mismatch", "The authorization code was issued to another client.")
+	case code.RedirectURI != req.RedirectURI:
+		return nil, grantError("redirect_uri mismatch", "The redirect_uri does not match the authorization request.")
+	case len(code.CodeChallenge) == 0 && len(req.CodeVerifier) > 0:
+		return nil, grantError("unexpected code_verifier", "The authorization request did not include a code_challenge.")
+	case len(code.CodeChallenge) > 0 && len(req.CodeVerifier) == 0:
+		return nil, grantError("missing code_verifier", "The code_verifier is required.")
+	case len(code.CodeChallenge) > 0 && !verifyCodeChallenge(code.CodeChallenge, code.CodeChallengeMethod, req.CodeVerifier):
+		return nil, grantError("code_verifier mismatch", "The code_verifier does not match the code_challenge.")
+	}
+
+	var refreshToken *RefreshToken
+	if lo.Contains(code.Scopes, spec.ScopeOfflineAccess) && c.AllowsGrantType(spec.GrantTypeRefreshToken) {
+		refreshToken = NewRefreshToken(code.Authorization, s.props.RefreshTokenLifespan)
+		refreshToken.Family = code.Family
+	}
+
+	return s.issue(ctx, c, code.Authorization, code.Family, refreshToken)
+}
+
+// refreshToken rotates the presented refresh token and issues an access token on the original Authorization,
+// optionally down-scoped by the request. Replaying a rotated refresh token revokes its whole family, as the token
+// has likely been leaked, along with the access tokens issued in the family.
+func (s *Service) refreshToken(ctx context.Context, c *client.Client, req *Request) (*Response, error) {
+	refreshToken, err := s.refreshTokens.GetRefreshToken(ctx, req.RefreshToken)
+	switch {
+	case errors.Is(err, ErrRefreshTokenNotFound):
+		return nil, grantError("refresh token not found", "The refresh token is invalid, expired or revoked.")
+	case err != nil:
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	if refreshToken.ClientID != req.ClientID {
+		return nil, grantError("client mismatch", "The refresh token was issued to another client.")
+	}
+
+	if len(req.Scopes) > 0 && !lo.Every(refreshToken.Scopes, req.Scopes) {
+		return nil, fault.Wrap(ErrGrant,
+			ftag.With(spec.ErrKindInvalidScope),
+			fmsg.WithDesc("scope exceeds grant", "The requested scope exceeds the scope originally granted."),
+		)
+	}
+
+	err = s.refreshTokens.UseRefreshToken(ctx, refreshToken.Value)
+	switch {
+	case errors.Is(err, ErrRefreshTokenReused):
+		if err = s.revokeFamily(ctx, refreshToken.Family); err != nil {
+			return nil, err
+		}
+		return nil, grantError("refresh token reused", "The refresh token has already been used.")
+	case errors.Is(err, ErrRefreshTokenNotFound):
+		return nil, grantError("refresh token not found", "The refresh token is invalid, expired or revoked.")
+	case err != nil:
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	authorization := refreshToken.Authorization
+	authorization.Nonce = ""
+	if len(req.Scopes) > 0 {
+		authorization.Scopes = lo.Intersect(refreshToken.Scopes, req.Scopes)
+	}
+
+	return s.issue(ctx, c, authorization, refreshToken.Family, refreshToken.rotate(s.props.RefreshTokenLifespan))
+}
+
+// clientCredentials issues an access token to a confidential client on its own behalf. The client can only request
+// the scopes it is registered for, and gets all of them when none is requested. Scopes concerning End-Users are
+// never granted, hence no id_token or refresh token is issued.
+func (s *Service) clientCredentials(ctx context.Context, c *client.Client, req *Request) (*Response, error) {
+	if !c.IsConfidential() {
+		return nil, fault.Wrap(ErrGrant,
+			ftag.With(spec.ErrKindUnauthorizedClient),
+			fmsg.WithDesc("public client", "Public clients cannot use the client_credentials grant_type."),
+		)
+	}
+
+	registered := lo.Without(c.Scopes(), spec.ScopeOpenID, spec.ScopeOfflineAccess)
+
+	scopes := registered
+	if len(req.Scopes) > 0 {
+		if !lo.Every(registered, req.Scopes) {
+			return nil, fault.Wrap(ErrGrant,
+				ftag.With(spec.ErrKindInvalidScope),
+				fmsg.WithDesc("scope not registered", "The requested scope exceeds the scope registered for the client."),
+			)
+		}
+		scopes = lo.Uniq(req.Scopes)
+	}
+
+	return s.issue(ctx, c, Authorization{
+		ClientID: c.ID,
+		Subject:  c.ID,
+		Scopes:   scopes,
+	}, "", nil)
+}
+
+// issue issues an access token for the Authorization in the token family, and an id_token if the openid scope is
+// authorized. The refreshToken, if any, is saved and included in the response.
+func (s *Service) issue(ctx context.Context, c *client.Client, authorization Authorization, family string, refreshToken *RefreshToken) (*Response, error) {
+	accessToken := NewAccessToken(authorization, c.AccessTokenLifespan(s.props.AccessTokenLifespan))
+	accessToken.Family = family
+	if err := s.accessTokens.SaveAccessToken(ctx, accessToken); err != nil {
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	resp := &Response{
+		AccessToken: accessToken.Value,
+		TokenType:   tokenTypeBearer,
+		ExpiresIn:   accessToken.ExpiresIn(),
+		Scope:       spaceDelimited(authorization.Scopes),
+	}
+
+	if refreshToken != nil {
+		if err := s.refreshTokens.SaveRefreshToken(ctx, refreshToken); err != nil {
+			return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+		}
+		resp.RefreshToken = refreshToken.Value
+	}
+
+	if lo.Contains(authorization.Scopes, spec.ScopeOpenID) {
+		idToken, err := s.idToken(ctx, c, authorization, accessToken.Value)
+		if err != nil {
+			return nil, err
+		}
+		resp.IDToken = idToken
+	}
+
+	return resp, nil
+}
+
+// idToken encodes the id_token with the signing and encryption preferences of the client, falling back to the server
+// signing algorithm.
+func (s *Service) idToken(ctx context.Context, c *client.Client, authorization Authorization, accessToken string) (string, error) {
+	alg := c.IDTokenSignedResponseAlg
+	if alg == 0 {
+		alg = s.idTokenAlg
+	}
+
+	claims := &idTokenClaims{
+		std: new(jose.StdClaims).
+			WithIssuer(s.issuer).
+			WithSubject(authorization.Subject).
+			WithAudience(authorization.ClientID).
+			WithIssuedAtNow().
+			WithExpiryIn(s.props.IDTokenLifespan),
+		extra: &idTokenExtraClaims{
+			Nonce:  authorization.Nonce,
+			ACR:    authorization.ACR,
+			AMR:    authorization.AMR,
+			AZP:    authorization.ClientID,
+			Sid:    authorization.Sid,
+			AtHash: halfHash(accessToken, alg),
+		},
+		provider: authorization.Claims.IDToken,
+	}
+	if !authorization.AuthTime.IsZero() {
+		claims.extra.AuthTime = authorization.AuthTime.Unix()
+	}
+
+	opts := []jose.EncoderOpt{jose.WithSignature(alg, s.jwks)}
+
+	if !c.IDTokenEncryptedResponseAlg.IsNoneOrEmpty() {
+		keys, err := c.JSONWebKeys(ctx)
+		if err != nil {
+			return "", fault.Wrap(err, ftag.With(spec.ErrKindServerError), fmsg.With("failed to obtain client keys"))
+		}
+
+		enc := c.IDTokenEncryptedResponseEnc
+		if enc == 0 {
+			enc = spec.A128CBC_HS256
+		}
+
+		opts = append(opts, jose.WithEncryption(c.IDTokenEncryptedResponseAlg, enc, keys))
+	}
+
+	idToken, err := jose.Encode(claims, opts...)
+	if err != nil {
+		return "", fault.Wrap(err, ftag.With(spec.ErrKindServerError), fmsg.With("failed to encode id_token"))
+	}
+
+	return idToken, nil
+}
+
+func grantError(message string, description string) error {
+	return fault.Wrap(ErrGrant,
+		ftag.With(spec.ErrKindInvalidGrant),
+		fmsg.WithDesc(message, description),
+	)
+}
+
+func spaceDelimited(values []string) string {
+	return strings.Join(values, " ")
+}
@@ -0,0 +1,439 @@
+//go:build unit
+
+package token_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/storage/memory"
+	"github.com/absurdlab/tigerd/internal/token"
+	"github.com/absurdlab/tigerd/internal/wellknown"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+const (
+	testVerifier = "dBjftJeZ4CVP-mJ92K9D8kRNp3UyHd0I3lFhOfEaIqM-foo"
+)
+
+var (
+	sealedKeys = jose.NewJSONWebKeySet(jose.GenerateEncryptionKey("sealed", spec.RSA_OAEP_256, 2048))
+)
+
+func TestService_Exchange_AuthorizationCode(t *testing.T) {
+	s256 := sha256.Sum256([]byte(testVerifier))
+
+	cases := []struct {
+		name   string
+		code   func(c *token.Code)
+		req    func(r *token.Request)
+		expect ftag.Kind
+	}{
+		{name: "without pkce"},
+		{
+			name: "plain code challenge",
+			code: func(c *token.Code) { c.WithChallenge(testVerifier, spec.CodeChallengeMethodPlain) },
+			req:  func(r *token.Request) { r.CodeVerifier = testVerifier },
+		},
+		{
+			name: "S256 code challenge",
+			code: func(c *token.Code) {
+				c.WithChallenge(base64.RawURLEncoding.EncodeToString(s256[:]), spec.CodeChallengeMethodS256)
+			},
+			req: func(r *token.Request) { r.CodeVerifier = testVerifier },
+		},
+		{
+			name:   "wrong code verifier",
+			code:   func(c *token.Code) { c.WithChallenge(testVerifier, spec.CodeChallengeMethodS256) },
+			req:    func(r *token.Request) { r.CodeVerifier = testVerifier },
+			expect: spec.ErrKindInvalidGrant,
+		},
+		{
+			name:   "missing code verifier",
+			code:   func(c *token.Code) { c.WithChallenge(testVerifier, spec.CodeChallengeMethodPlain) },
+			expect: spec.ErrKindInvalidGrant,
+		},
+		{
+			name:   "malformed code verifier",
+			code:   func(c *token.Code) { c.WithChallenge("short", spec.CodeChallengeMethodPlain) },
+			req:    func(r *token.Request) { r.CodeVerifier = "short" },
+			expect: spec.ErrKindInvalidRequest,
+		},
+		{
+			name:   "redirect uri mismatch",
+			req:    func(r *token.Request) { r.RedirectURI = "https://bar.com/callback" },
+			expect: spec.ErrKindInvalidGrant,
+		},
+		{
+			name:   "client mismatch",
+			req:    func(r *token.Request) { r.ClientID, r.Credentials.ClientID = "bar", "bar" },
+			expect: spec.ErrKindInvalidGrant,
+		},
+		{
+			name:   "unknown code",
+			req:    func(r *token.Request) { r.Code = "unknown" },
+			expect: spec.ErrKindInvalidGrant,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			service, codes, jwks := newTestService(t)
+
+			code := token.NewCode(token.Authorization{
+				ClientID: "foo",
+				Subject:  "alice",
+				Scopes:   []string{"openid", "profile"},
+				Nonce:    "n-0S6_WzA2Mj",
+				AuthTime: time.Now(),
+				Claims:   token.Claims{IDToken: map[string]any{"name": "Alice"}},
+			}, "https://foo.com/callback", time.Minute)
+			if c.code != nil {
+				c.code(code)
+			}
+			require.NoError(t, codes.SaveCode(context.Background(), code))
+
+			req := &token.Request{
+				GrantType:   spec.GrantTypeAuthorizationCode,
+				ClientID:    "foo",
+				Credentials: &client.Credentials{ClientID: "foo"},
+				Code:        code.Value,
+				RedirectURI: "https://foo.com/callback",
+			}
+			if c.req != nil {
+				c.req(req)
+			}
+
+			resp, err := service.Exchange(context.Background(), req)
+			if len(c.expect) > 0 {
+				assert.Equal(t, c.expect, ftag.Get(err))
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NotEmpty(t, resp.AccessToken)
+			assert.Equal(t, "Bearer", resp.TokenType)
+			assert.Equal(t, "openid profile", resp.Scope)
+
+			var claims map[string]any
+			err = jose.Decode(resp.IDToken, jose.ExpectSignature(spec.RS256, jwks)).Into(&claims)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "https://tigerd.test", claims["iss"])
+				assert.Equal(t, "alice", claims["sub"])
+				assert.Equal(t, "n-0S6_WzA2Mj", claims["nonce"])
+				assert.Equal(t, "Alice", claims["name"])
+				assert.NotEmpty(t, claims["at_hash"])
+			}
+
+			_, err = service.Exchange(context.Background(), req)
+			assert.Equal(t, spec.ErrKindInvalidGrant, ftag.Get(err), "code is single use")
+		})
+	}
+}
+
+func TestService_Exchange_EncryptedIDToken(t *testing.T) {
+	service, codes, jwks := newTestService(t)
+	ctx := context.Background()
+
+	code := token.NewCode(token.Authorization{
+		ClientID: "sealed",
+		Subject:  "alice",
+		Scopes:   []string{"openid"},
+	}, "https://sealed.com/callback", time.Minute)
+	require.NoError(t, codes.SaveCode(ctx, code))
+
+	resp, err := service.Exchange(ctx, &token.Request{
+		GrantType:   spec.GrantTypeAuthorizationCode,
+		ClientID:    "sealed",
+		Credentials: &client.Credentials{ClientID: "sealed"},
+		Code:        code.Value,
+		RedirectURI: "https://sealed.com/callback",
+	})
+	require.NoError(t, err)
+
+	var claims map[string]any
+	err = jose.Decode(resp.IDToken,
+		jose.ExpectSignature(spec.RS256, jwks),
+		jose.ExpectEncryption(spec.RSA_OAEP_256, sealedKeys),
+	).Into(&claims)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alice", claims["sub"])
+	}
+}
+
+func TestService_Exchange_RefreshToken(t *testing.T) {
+	service, codes, _ := newTestService(t)
+	ctx := context.Background()
+
+	code := token.NewCode(token.Authorization{
+		ClientID: "foo",
+		Subject:  "alice",
+		Scopes:   []string{"openid", "profile", "offline_access"},
+	}, "https://foo.com/callback", time.Minute)
+	require.NoError(t, codes.SaveCode(ctx, code))
+
+	first, err := service.Exchange(ctx, &token.Request{
+		GrantType:   spec.GrantTypeAuthorizationCode,
+		ClientID:    "foo",
+		Credentials: &client.Credentials{ClientID: "foo"},
+		Code:        code.Value,
+		RedirectURI: "https://foo.com/callback",
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, first.RefreshToken)
+
+	refresh := func(refreshToken string, clientID string, scopes ...string) (*token.Response, error) {
+		return service.Exchange(ctx, &token.Request{
+			GrantType:    spec.GrantTypeRefreshToken,
+			ClientID:     clientID,
+			Credentials:  &client.Credentials{ClientID: clientID},
+			RefreshToken: refreshToken,
+			Scopes:       scopes,
+		})
+	}
+
+	_, err = refresh(first.RefreshToken, "bar")
+	assert.Equal(t, spec.ErrKindInvalidGrant, ftag.Get(err), "issued to another client")
+
+	_, err = refresh(first.RefreshToken, "foo", "openid", "email")
+	assert.Equal(t, spec.ErrKindInvalidScope, ftag.Get(err), "scope exceeds grant")
+
+	second, err := refresh(first.RefreshToken, "foo", "openid")
+	require.NoError(t, err)
+	assert.Equal(t, "openid", second.Scope)
+	assert.NotEmpty(t, second.IDToken)
+	assert.NotEmpty(t, second.RefreshToken)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	third, err := refresh(second.RefreshToken, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "openid profile offline_access", third.Scope, "rotated token retains original scope")
+
+	_, err = refresh(first.RefreshToken, "foo")
+	assert.Equal(t, spec.ErrKindInvalidGrant, ftag.Get(err), "replay of rotated token")
+
+	_, err = refresh(third.RefreshToken, "foo")
+	assert.Equal(t, spec.ErrKindInvalidGrant, ftag.Get(err), "family revoked after replay")
+
+	deregistered := token.NewRefreshToken(token.Authorization{ClientID: "gone", Subject: "alice"}, time.Hour)
+	require.NoError(t, codes.SaveRefreshToken(ctx, deregistered))
+	_, err = refresh(deregistered.Value, "gone")
+	assert.Equal(t, spec.ErrKindInvalidClient, ftag.Get(err), "issued to deregistered client")
+}
+
+func TestService_Exchange_CodeReplay(t *testing.T) {
+	service, codes, _ := newTestService(t)
+	ctx := context.Background()
+
+	code := token.NewCode(token.Authorization{
+		ClientID: "foo",
+		Subject:  "alice",
+		Scopes:   []string{"openid", "offline_access"},
+	}, "https://foo.com/callback", time.Minute)
+	require.NoError(t, codes.SaveCode(ctx, code))
+
+	req := &token.Request{
+		GrantType:   spec.GrantTypeAuthorizationCode,
+		ClientID:    "foo",
+		Credentials: &client.Credentials{ClientID: "foo"},
+		Code:        code.Value,
+		RedirectURI: "https://foo.com/callback",
+	}
+
+	resp, err := service.Exchange(ctx, req)
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.RefreshToken)
+
+	_, err = service.Exchange(ctx, req)
+	assert.Equal(t, spec.ErrKindInvalidGrant, ftag.Get(err), "code replayed")
+
+	_, err = codes.GetAccessToken(ctx, resp.AccessToken)
+	assert.ErrorIs(t, err, token.ErrAccessTokenNotFound, "access token revoked after replay")
+
+	_, err = codes.GetRefreshToken(ctx, resp.RefreshToken)
+	assert.ErrorIs(t, err, token.ErrRefreshTokenNotFound, "refresh token revoked after replay")
+}
+
+func TestService_Exchange_RefreshTokenGrantNotRegistered(t *testing.T) {
+	service, codes, _ := newTestService(t)
+	ctx := context.Background()
+
+	code := token.NewCode(token.Authorization{
+		ClientID: "sealed",
+		Subject:  "alice",
+		Scopes:   []string{"openid", "offline_access"},
+	}, "https://sealed.com/callback", time.Minute)
+	require.NoError(t, codes.SaveCode(ctx, code))
+
+	resp, err := service.Exchange(ctx, &token.Request{
+		GrantType:   spec.GrantTypeAuthorizationCode,
+		ClientID:    "sealed",
+		Credentials: &client.Credentials{ClientID: "sealed"},
+		Code:        code.Value,
+		RedirectURI: "https://sealed.com/callback",
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.AccessToken)
+	assert.Empty(t, resp.RefreshToken)
+}
+
+func TestService_Exchange_ClientCredentials(t *testing.T) {
+	cases := []struct {
+		name   string
+		req    func(r *token.Request)
+		expect ftag.Kind
+		assert func(t *testing.T, resp *token.Response)
+	}{
+		{
+			name: "all registered scopes",
+			assert: func(t *testing.T, resp *token.Response) {
+				assert.Equal(t, "read write", resp.Scope)
+				assert.Empty(t, resp.IDToken)
+				assert.Empty(t, resp.RefreshToken)
+				assert.LessOrEqual(t, resp.ExpiresIn, int64(60))
+			},
+		},
+		{
+			name: "requested scopes",
+			req:  func(r *token.Request) { r.Scopes = []string{"read"} },
+			assert: func(t *testing.T, resp *token.Response) {
+				assert.Equal(t, "read", resp.Scope)
+			},
+		},
+		{
+			name:   "unregistered scope",
+			req:    func(r *token.Request) { r.Scopes = []string{"read", "delete"} },
+			expect: spec.ErrKindInvalidScope,
+		},
+		{
+			name:   "openid scope",
+			req:    func(r *token.Request) { r.Scopes = []string{"openid"} },
+			expect: spec.ErrKindInvalidScope,
+		},
+		{
+			name:   "wrong secret",
+			req:    func(r *token.Request) { r.Credentials.ClientSecret = "wrong" },
+			expect: spec.ErrKindInvalidClient,
+		},
+		{
+			name:   "unknown client",
+			req:    func(r *token.Request) { r.ClientID, r.Credentials.ClientID = "unknown", "unknown" },
+			expect: spec.ErrKindInvalidClient,
+		},
+		{
+			name: "grant type not registered",
+			req: func(r *token.Request) {
+				r.ClientID, r.Credentials = "foo", &client.Credentials{ClientID: "foo"}
+			},
+			expect: spec.ErrKindUnauthorizedClient,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			service, _, _ := newTestService(t)
+
+			req := &token.Request{
+				GrantType:   spec.GrantTypeClientCredentials,
+				ClientID:    "machine",
+				Credentials: &client.Credentials{ClientID: "machine", ClientSecret: "s3cret", Basic: true},
+			}
+			if c.req != nil {
+				c.req(req)
+			}
+
+			resp, err := service.Exchange(context.Background(), req)
+			if len(c.expect) > 0 {
+				assert.Equal(t, c.expect, ftag.Get(err))
+			} else if assert.NoError(t, err) {
+				c.assert(t, resp)
+			}
+		})
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	_, err := token.ParseRequest(map[string][]string{"grant_type": {"foo"}}, new(client.Credentials))
+	assert.Equal(t, spec.ErrKindUnsupportedGrantType, ftag.Get(err))
+
+	credentials := &client.Credentials{ClientID: "foo", ClientSecret: "s3cret", Basic: true}
+	req, err := token.ParseRequest(map[string][]string{
+		"grant_type": {"authorization_code"},
+		"code":       {"xyz"},
+	}, credentials)
+	if assert.NoError(t, err) {
+		assert.Equal(t, spec.GrantTypeAuthorizationCode, req.GrantType)
+		assert.Equal(t, "foo", req.ClientID)
+		assert.Equal(t, credentials, req.Credentials)
+	}
+}
+
+func newTestService(t *testing.T) (*token.Service, *memory.Storage, *jose.JSONWebKeySet) {
+	jwks := jose.NewJSONWebKeySet(jose.GenerateSignatureKey("test", spec.RS256, 2048))
+	codes := memory.New(time.Minute)
+
+	registry, err := client.NewStaticRegistry([]*client.Client{
+		{
+			ID:           "foo",
+			RedirectURIs: []string{"https://foo.com/callback"},
+			GrantTypes:   []spec.GrantType{spec.GrantTypeAuthorizationCode, spec.GrantTypeRefreshToken},
+		},
+		{
+			ID:           "bar",
+			RedirectURIs: []string{"https://bar.com/callback"},
+			GrantTypes:   []spec.GrantType{spec.GrantTypeAuthorizationCode, spec.GrantTypeRefreshToken},
+		},
+		{
+			ID:                          "sealed",
+			RedirectURIs:                []string{"https://sealed.com/callback"},
+			JSONWebKeySet:               sealedKeys,
+			IDTokenEncryptedResponseAlg: spec.RSA_OAEP_256,
+		},
+		{
+			ID:                  "machine",
+			Secret:              "s3cret",
+			ApplicationType:     spec.AppTypeMachine,
+			GrantTypes:          []spec.GrantType{spec.GrantTypeClientCredentials},
+			Scope:               "openid read write",
+			AccessTokenLifetime: 60,
+			Introspection:       true,
+		},
+		{
+			ID:              "worker",
+			Secret:          "s3cret",
+			ApplicationType: spec.AppTypeMachine,
+			GrantTypes:      []spec.GrantType{spec.GrantTypeClientCredentials},
+			Scope:           "read",
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	discovery := &wellknown.Discovery{
+		Issuer:                           "https://tigerd.test",
+		IdTokenSigningAlgValuesSupported: []spec.SignatureAlgorithm{spec.ES256, spec.RS256},
+	}
+
+	service := token.NewService(
+		&token.Properties{
+			AccessTokenLifespan:  time.Hour,
+			IDTokenLifespan:      time.Hour,
+			RefreshTokenLifespan: time.Hour,
+		},
+		discovery,
+		jwks,
+		codes,
+		codes,
+		codes,
+		client.NewAuthenticator(discovery, registry, memory.New(time.Minute)),
+		registry,
+	)
+
+	return service, codes, jwks
+}
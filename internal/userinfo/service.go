@@ -0,0 +1,134 @@
+package userinfo
+
+import (
+	"context"
+	"errors"
+	"github.com/Southclaws/fault"
+	"github.com/Southclaws/fault/fmsg"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/token"
+	"github.com/absurdlab/tigerd/internal/wellknown"
+	"github.com/samber/lo"
+)
+
+var (
+	// ErrAccess is the root error returned when the access token cannot be used to obtain userinfo.
+	ErrAccess = errors.New("userinfo access denied")
+)
+
+// Response is the userinfo response. Exactly one of Claims or JWT is set: JWT is set when the client registered to
+// receive a signed or encrypted response.
+type Response struct {
+	Claims map[string]any
+	JWT    string
+}
+
+// NewService creates a Service which serves userinfo for access tokens issued by the token service.
+func NewService(
+	discovery *wellknown.Discovery,
+	jwks *jose.JSONWebKeySet,
+	accessTokens token.AccessTokenStore,
+	clients client.Registry,
+) *Service {
+	return &Service{
+		issuer:       discovery.Issuer,
+		jwks:         jwks,
+		accessTokens: accessTokens,
+		clients:      clients,
+	}
+}
+
+// Service implements the UserInfo endpoint defined in OpenID Connect Core 1.0 Section 5.3.
+type Service struct {
+	issuer       string
+	jwks         *jose.JSONWebKeySet
+	accessTokens token.AccessTokenStore
+	clients      client.Registry
+}
+
+// UserInfo returns the claims about the End-User authorized to the bearer of the access token. The access token must
+// be granted the openid scope.
+func (s *Service) UserInfo(ctx context.Context, accessToken string) (*Response, error) {
+	if len(accessToken) == 0 {
+		return nil, tokenError("missing access token")
+	}
+
+	at, err := s.accessTokens.GetAccessToken(ctx, accessToken)
+	switch {
+	case errors.Is(err, token.ErrAccessTokenNotFound):
+		return nil, tokenError("access token not found")
+	case err != nil:
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	case at.IsExpired():
+		return nil, tokenError("access token expired")
+	case !lo.Contains(at.Scopes, spec.ScopeOpenID):
+		return nil, fault.Wrap(ErrAccess,
+			ftag.With(spec.ErrKindInsufficientScope),
+			fmsg.WithDesc("openid scope not granted", "The access token is not granted the openid scope."),
+		)
+	}
+
+	c, err := s.clients.Find(ctx, at.ClientID)
+	switch {
+	case errors.Is(err, client.ErrNotFound):
+		return nil, tokenError("client no longer registered")
+	case err != nil:
+		return nil, fault.Wrap(err, ftag.With(spec.ErrKindServerError))
+	}
+
+	claims := at.UserInfoClaims()
+
+	if c.UserInfoSignedResponseAlg.IsNoneOrEmpty() && c.UserInfoEncryptedResponseAlg.IsNoneOrEmpty() {
+		return &Response{Claims: claims}, nil
+	}
+
+	jwt, err := s.encode(ctx, c, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{JWT: jwt}, nil
+}
+
+// encode encodes the claims as a JWT signed and/or encrypted according to the client registration. A signed response
+// carries the iss and aud claims as required by OpenID Connect Core 1.0 Section 5.3.2.
+func (s *Service) encode(ctx context.Context, c *client.Client, claims map[string]any) (string, error) {
+	var opts []jose.EncoderOpt
+
+	if alg := c.UserInfoSignedResponseAlg; !alg.IsNoneOrEmpty() {
+		claims["iss"] = s.issuer
+		claims["aud"] = c.ID
+		opts = append(opts, jose.WithSignature(alg, s.jwks))
+	}
+
+	if alg := c.UserInfoEncryptedResponseAlg; !alg.IsNoneOrEmpty() {
+		keys, err := c.JSONWebKeys(ctx)
+		if err != nil {
+			return "", fault.Wrap(err, ftag.With(spec.ErrKindServerError), fmsg.With("failed to obtain client keys"))
+		}
+
+		enc := c.UserInfoEncryptedResponseEnc
+		if enc == 0 {
+			enc = spec.A128CBC_HS256
+		}
+
+		opts = append(opts, jose.WithEncryption(alg, enc, keys))
+	}
+
+	jwt, err := jose.Encode(claims, opts...)
+	if err != nil {
+		return "", fault.Wrap(err, ftag.With(spec.ErrKindServerError), fmsg.With("failed to encode userinfo"))
+	}
+
+	return jwt, nil
+}
+
+func tokenError(message string) error {
+	return fault.Wrap(ErrAccess,
+		ftag.With(spec.ErrKindInvalidToken),
+		fmsg.WithDesc(message, "The access token is invalid."),
+	)
+}
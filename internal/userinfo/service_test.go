@@ -0,0 +1,175 @@
+//go:build unit
+
+package userinfo_test
+
+import (
+	"context"
+	"github.com/Southclaws/fault/ftag"
+	"github.com/absurdlab/tigerd/internal/client"
+	"github.com/absurdlab/tigerd/internal/jose"
+	"github.com/absurdlab/tigerd/internal/spec"
+	"github.com/absurdlab/tigerd/internal/storage/memory"
+	"github.com/absurdlab/tigerd/internal/token"
+	"github.com/absurdlab/tigerd/internal/userinfo"
+	"github.com/absurdlab/tigerd/internal/wellknown"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestService_UserInfo(t *testing.T) {
+	var (
+		serverKeys = jose.NewJSONWebKeySet(jose.GenerateSignatureKey("server", spec.RS256, 2048))
+		sealedKeys = jose.NewJSONWebKeySet(jose.GenerateEncryptionKey("sealed", spec.RSA_OAEP_256, 2048))
+	)
+
+	registry, err := client.NewStaticRegistry([]*client.Client{
+		{
+			ID:           "plain",
+			RedirectURIs: []string{"https://plain.com/callback"},
+		},
+		{
+			ID:                        "signed",
+			RedirectURIs:              []string{"https://signed.com/callback"},
+			UserInfoSignedResponseAlg: spec.RS256,
+		},
+		{
+			ID:                           "sealed",
+			RedirectURIs:                 []string{"https://sealed.com/callback"},
+			JSONWebKeySet:                sealedKeys.Public(),
+			UserInfoSignedResponseAlg:    spec.RS256,
+			UserInfoEncryptedResponseAlg: spec.RSA_OAEP_256,
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	authorization := func(clientID string) token.Authorization {
+		return token.Authorization{
+			ClientID: clientID,
+			Subject:  "alice",
+			Scopes:   []string{"openid", "email"},
+			Claims: token.Claims{UserInfo: map[string]any{
+				"email":        "alice@example.com",
+				"name":         "Alice",
+				"phone_number": "+1 555 0100",
+				"department":   "engineering",
+			}},
+		}
+	}
+
+	cases := []struct {
+		name   string
+		token  func() *token.AccessToken
+		value  string
+		expect ftag.Kind
+		assert func(t *testing.T, resp *userinfo.Response)
+	}{
+		{
+			name:  "plain",
+			token: func() *token.AccessToken { return token.NewAccessToken(authorization("plain"), time.Hour) },
+			assert: func(t *testing.T, resp *userinfo.Response) {
+				assert.Equal(t, map[string]any{
+					"sub":        "alice",
+					"email":      "alice@example.com",
+					"department": "engineering",
+				}, resp.Claims)
+			},
+		},
+		{
+			name: "claims request",
+			token: func() *token.AccessToken {
+				a := authorization("plain")
+				a.ClaimsRequest = &token.ClaimsRequest{UserInfo: map[string]*token.ClaimOption{
+					"name": {Essential: true},
+				}}
+				return token.NewAccessToken(a, time.Hour)
+			},
+			assert: func(t *testing.T, resp *userinfo.Response) {
+				assert.Equal(t, "Alice", resp.Claims["name"])
+				assert.NotContains(t, resp.Claims, "phone_number")
+			},
+		},
+		{
+			name:  "signed",
+			token: func() *token.AccessToken { return token.NewAccessToken(authorization("signed"), time.Hour) },
+			assert: func(t *testing.T, resp *userinfo.Response) {
+				var claims map[string]any
+				err := jose.Decode(resp.JWT, jose.ExpectSignature(spec.RS256, serverKeys)).Into(&claims)
+				if assert.NoError(t, err) {
+					assert.Equal(t, "alice", claims["sub"])
+					assert.Equal(t, "https://tigerd.test", claims["iss"])
+					assert.Equal(t, "signed", claims["aud"])
+				}
+			},
+		},
+		{
+			name:  "signed and encrypted",
+			token: func() *token.AccessToken { return token.NewAccessToken(authorization("sealed"), time.Hour) },
+			assert: func(t *testing.T, resp *userinfo.Response) {
+				var claims map[string]any
+				err := jose.Decode(resp.JWT,
+					jose.ExpectSignature(spec.RS256, serverKeys),
+					jose.ExpectEncryption(spec.RSA_OAEP_256, sealedKeys),
+				).Into(&claims)
+				if assert.NoError(t, err) {
+					assert.Equal(t, "alice@example.com", claims["email"])
+				}
+			},
+		},
+		{
+			name: "openid not granted",
+			token: func() *token.AccessToken {
+				a := authorization("plain")
+				a.Scopes = []string{"email"}
+				return token.NewAccessToken(a, time.Hour)
+			},
+			expect: spec.ErrKindInsufficientScope,
+		},
+		{
+			name: "expired token",
+			token: func() *token.AccessToken {
+				return token.NewAccessToken(authorization("plain"), -time.Minute)
+			},
+			expect: spec.ErrKindInvalidToken,
+		},
+		{
+			name: "deregistered client",
+			token: func() *token.AccessToken {
+				return token.NewAccessToken(authorization("gone"), time.Hour)
+			},
+			expect: spec.ErrKindInvalidToken,
+		},
+		{
+			name:   "unknown token",
+			value:  "unknown",
+			expect: spec.ErrKindInvalidToken,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			accessTokens := memory.New(time.Minute)
+			service := userinfo.NewService(
+				&wellknown.Discovery{Issuer: "https://tigerd.test"},
+				serverKeys,
+				accessTokens,
+				registry,
+			)
+
+			value := c.value
+			if c.token != nil {
+				at := c.token()
+				require.NoError(t, accessTokens.SaveAccessToken(context.Background(), at))
+				value = at.Value
+			}
+
+			resp, err := service.UserInfo(context.Background(), value)
+			if len(c.expect) > 0 {
+				assert.Equal(t, c.expect, ftag.Get(err))
+			} else if assert.NoError(t, err) {
+				c.assert(t, resp)
+			}
+		})
+	}
+}
@@ -23,41 +23,56 @@ var (
 
 // Discovery models the OpenID Connect configuration metadata.
 type Discovery struct {
-	Issuer                                     string                      `json:"issuer,omitempty"`
-	AuthorizationEndpoint                      string                      `json:"authorization_endpoint,omitempty"`
-	ResumeAuthorizationEndpoint                string                      `json:"resume_authorization_endpoint,omitempty"`
-	TokenEndpoint                              string                      `json:"token_endpoint,omitempty"`
-	UserInfoEndpoint                           string                      `json:"userinfo_endpoint,omitempty"`
-	JSONWebKeySetURI                           string                      `json:"jwks_uri,omitempty"`
-	RegistrationEndpoint                       string                      `json:"registration_endpoint,omitempty"`
-	ScopesSupported                            []string                    `json:"scopes_supported,omitempty"`
-	ResponseTypesSupported                     []spec.ResponseTypeSet      `json:"response_types_supported,omitempty"`
-	ResponseModesSupported                     []spec.ResponseMode         `json:"response_modes_supported,omitempty"`
-	GrantTypesSupported                        []spec.GrantType            `json:"grant_types_supported,omitempty"`
-	AcrValuesSupported                         []string                    `json:"acr_values_supported,omitempty"`
-	SubjectTypesSupported                      []spec.SubjectType          `json:"subject_types_supported,omitempty"`
-	IdTokenSigningAlgValuesSupported           []spec.SignatureAlgorithm   `json:"id_token_signing_alg_values_supported,omitempty"`
-	IdTokenEncryptionAlgValuesSupported        []spec.EncryptionAlgorithm  `json:"id_token_encryption_alg_values_supported,omitempty"`
-	IdTokenEncryptionEncValuesSupported        []spec.EncryptionEncoding   `json:"id_token_encryption_enc_values_supported,omitempty"`
-	UserInfoSigningAlgValuesSupported          []spec.SignatureAlgorithm   `json:"userinfo_signing_alg_values_supported,omitempty"`
-	UserInfoEncryptionAlgValuesSupported       []spec.EncryptionAlgorithm  `json:"userinfo_encryption_alg_values_supported,omitempty"`
-	UserInfoEncryptionEncValuesSupported       []spec.EncryptionEncoding   `json:"userinfo_encryption_enc_values_supported,omitempty"`
-	RequestObjectSigningAlgValuesSupported     []spec.SignatureAlgorithm   `json:"request_object_signing_alg_values_supported,omitempty"`
-	RequestObjectEncryptionAlgValuesSupported  []spec.EncryptionAlgorithm  `json:"request_object_encryption_alg_values_supported,omitempty"`
-	RequestObjectEncryptionEncValuesSupported  []spec.EncryptionEncoding   `json:"request_object_encryption_enc_values_supported,omitempty"`
-	TokenEndpointAuthMethodsSupported          []spec.AuthenticationMethod `json:"token_endpoint_auth_methods_supported,omitempty"`
-	TokenEndpointAuthSigningAlgValuesSupported []spec.SignatureAlgorithm   `json:"token_endpoint_auth_signing_alg_values_supported,omitempty"`
-	DisplayValuesSupported                     []spec.Display              `json:"display_values_supported,omitempty"`
-	ClaimTypesSupported                        []spec.ClaimType            `json:"claim_types_supported,omitempty"`
-	ClaimsSupported                            []string                    `json:"claims_supported,omitempty"`
-	ServiceDocumentation                       string                      `json:"service_documentation,omitempty"`
-	UILocalesSupported                         []string                    `json:"ui_locales_supported,omitempty"`
-	ClaimsParameterSupported                   bool                        `json:"claims_parameter_supported,omitempty"`
-	RequestParameterSupported                  bool                        `json:"request_parameter_supported,omitempty"`
-	RequestURIParameterSupported               bool                        `json:"request_uri_parameter_supported,omitempty"`
-	RequireRequestURIRegistration              bool                        `json:"require_request_uri_registration,omitempty"`
-	OPPolicyURI                                string                      `json:"op_policy_uri,omitempty"`
-	OPTermsOfServiceURI                        string                      `json:"op_tos_uri,omitempty"`
+	Issuer                                             string                      `json:"issuer,omitempty"`
+	AuthorizationEndpoint                              string                      `json:"authorization_endpoint,omitempty"`
+	ResumeAuthorizationEndpoint                        string                      `json:"resume_authorization_endpoint,omitempty"`
+	TokenEndpoint                                      string                      `json:"token_endpoint,omitempty"`
+	UserInfoEndpoint                                   string                      `json:"userinfo_endpoint,omitempty"`
+	JSONWebKeySetURI                                   string                      `json:"jwks_uri,omitempty"`
+	RegistrationEndpoint                               string                      `json:"registration_endpoint,omitempty"`
+	EndSessionEndpoint                                 string                      `json:"end_session_endpoint,omitempty"`
+	BackChannelLogoutSupported                         bool                        `json:"backchannel_logout_supported,omitempty"`
+	BackChannelLogoutSessionSupported                  bool                        `json:"backchannel_logout_session_supported,omitempty"`
+	FrontChannelLogoutSupported                        bool                        `json:"frontchannel_logout_supported,omitempty"`
+	FrontChannelLogoutSessionSupported                 bool                        `json:"frontchannel_logout_session_supported,omitempty"`
+	IntrospectionEndpoint                              string                      `json:"introspection_endpoint,omitempty"`
+	IntrospectionEndpointAuthMethodsSupported          []spec.AuthenticationMethod `json:"introspection_endpoint_auth_methods_supported,omitempty"`
+	IntrospectionEndpointAuthSigningAlgValuesSupported []spec.SignatureAlgorithm   `json:"introspection_endpoint_auth_signing_alg_values_supported,omitempty"`
+	RevocationEndpoint                                 string                      `json:"revocation_endpoint,omitempty"`
+	RevocationEndpointAuthMethodsSupported             []spec.AuthenticationMethod `json:"revocation_endpoint_auth_methods_supported,omitempty"`
+	RevocationEndpointAuthSigningAlgValuesSupported    []spec.SignatureAlgorithm   `json:"revocation_endpoint_auth_signing_alg_values_supported,omitempty"`
+	ScopesSupported                                    []string                    `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported                             []spec.ResponseTypeSet      `json:"response_types_supported,omitempty"`
+	ResponseModesSupported                             []spec.ResponseMode         `json:"response_modes_supported,omitempty"`
+	GrantTypesSupported                                []spec.GrantType            `json:"grant_types_supported,omitempty"`
+	AcrValuesSupported                                 []string                    `json:"acr_values_supported,omitempty"`
+	SubjectTypesSupported                              []spec.SubjectType          `json:"subject_types_supported,omitempty"`
+	IdTokenSigningAlgValuesSupported                   []spec.SignatureAlgorithm   `json:"id_token_signing_alg_values_supported,omitempty"`
+	IdTokenEncryptionAlgValuesSupported                []spec.EncryptionAlgorithm  `json:"id_token_encryption_alg_values_supported,omitempty"`
+	IdTokenEncryptionEncValuesSupported                []spec.EncryptionEncoding   `json:"id_token_encryption_enc_values_supported,omitempty"`
+	UserInfoSigningAlgValuesSupported                  []spec.SignatureAlgorithm   `json:"userinfo_signing_alg_values_supported,omitempty"`
+	UserInfoEncryptionAlgValuesSupported               []spec.EncryptionAlgorithm  `json:"userinfo_encryption_alg_values_supported,omitempty"`
+	UserInfoEncryptionEncValuesSupported               []spec.EncryptionEncoding   `json:"userinfo_encryption_enc_values_supported,omitempty"`
+	AuthorizationSigningAlgValuesSupported             []spec.SignatureAlgorithm   `json:"authorization_signing_alg_values_supported,omitempty"`
+	AuthorizationEncryptionAlgValuesSupported          []spec.EncryptionAlgorithm  `json:"authorization_encryption_alg_values_supported,omitempty"`
+	AuthorizationEncryptionEncValuesSupported          []spec.EncryptionEncoding   `json:"authorization_encryption_enc_values_supported,omitempty"`
+	RequestObjectSigningAlgValuesSupported             []spec.SignatureAlgorithm   `json:"request_object_signing_alg_values_supported,omitempty"`
+	RequestObjectEncryptionAlgValuesSupported          []spec.EncryptionAlgorithm  `json:"request_object_encryption_alg_values_supported,omitempty"`
+	RequestObjectEncryptionEncValuesSupported          []spec.EncryptionEncoding   `json:"request_object_encryption_enc_values_supported,omitempty"`
+	TokenEndpointAuthMethodsSupported                  []spec.AuthenticationMethod `json:"token_endpoint_auth_methods_supported,omitempty"`
+	TokenEndpointAuthSigningAlgValuesSupported         []spec.SignatureAlgorithm   `json:"token_endpoint_auth_signing_alg_values_supported,omitempty"`
+	CodeChallengeMethodsSupported                      []spec.CodeChallengeMethod  `json:"code_challenge_methods_supported,omitempty"`
+	DisplayValuesSupported                             []spec.Display              `json:"display_values_supported,omitempty"`
+	ClaimTypesSupported                                []spec.ClaimType            `json:"claim_types_supported,omitempty"`
+	ClaimsSupported                                    []string                    `json:"claims_supported,omitempty"`
+	ServiceDocumentation                               string                      `json:"service_documentation,omitempty"`
+	UILocalesSupported                                 []string                    `json:"ui_locales_supported,omitempty"`
+	ClaimsParameterSupported                           bool                        `json:"claims_parameter_supported,omitempty"`
+	RequestParameterSupported                          bool                        `json:"request_parameter_supported,omitempty"`
+	RequestURIParameterSupported                       bool                        `json:"request_uri_parameter_supported,omitempty"`
+	RequireRequestURIRegistration                      bool                        `json:"require_request_uri_registration,omitempty"`
+	OPPolicyURI                                        string                      `json:"op_policy_uri,omitempty"`
+	OPTermsOfServiceURI                                string                      `json:"op_tos_uri,omitempty"`
 }
 
 // Apply runs the supplied functions on this Discovery, and potentially modifies this Discovery.
@@ -67,14 +82,6 @@ func (d *Discovery) Apply(fn ...func(discovery *Discovery)) {
 	}
 }
 
-func (d *Discovery) onlyImplicitFlow() bool {
-	return lo.None(d.GrantTypesSupported, []spec.GrantType{
-		spec.GrantTypeAuthorizationCode,
-		spec.GrantTypeClientCredentials,
-		spec.GrantTypeRefreshToken,
-	})
-}
-
 // Validate performs validation on the Discovery and returns an error if exists violation. The returned error will
 // be a ErrDiscovery.
 func (d *Discovery) Validate() error {
@@ -90,11 +97,9 @@ func (d *Discovery) Validate() error {
 			should.URL().Http().Https().NoFragment(),
 		),
 		"token_endpoint": v.Validate(d.TokenEndpoint,
-			v.When(!d.onlyImplicitFlow(),
-				v.Required,
-				is.URL,
-				should.URL().Http().Https().NoFragment(),
-			),
+			v.Required,
+			is.URL,
+			should.URL().Http().Https().NoFragment(),
 		),
 		"userinfo_endpoint": v.Validate(d.UserInfoEndpoint,
 			v.Required,
@@ -110,19 +115,41 @@ func (d *Discovery) Validate() error {
 			is.URL,
 			should.URL().Https().NoFragment(),
 		),
+		"end_session_endpoint": v.Validate(d.EndSessionEndpoint,
+			is.URL,
+			should.URL().Https().NoFragment(),
+		),
+		"introspection_endpoint": v.Validate(d.IntrospectionEndpoint,
+			is.URL,
+			should.URL().Https().NoFragment(),
+		),
+		"introspection_endpoint_auth_methods_supported": v.Validate(d.IntrospectionEndpointAuthMethodsSupported,
+			v.When(len(d.IntrospectionEndpoint) > 0, v.Required),
+			v.Each(v.NotIn(spec.NoAuthenticationMethod).Error("none is not allowed")),
+		),
+		"revocation_endpoint": v.Validate(d.RevocationEndpoint,
+			is.URL,
+			should.URL().Https().NoFragment(),
+		),
+		"revocation_endpoint_auth_methods_supported": v.Validate(d.RevocationEndpointAuthMethodsSupported,
+			v.When(len(d.RevocationEndpoint) > 0, v.Required),
+		),
 		"scopes_supported": v.Validate(d.ScopesSupported,
 			v.Required,
 			should.Contain(spec.ScopeOpenID).Error("should contain openid"),
 		),
 		"response_types_supported": v.Validate(d.ResponseTypesSupported,
 			v.Required,
-			should.Contain(spec.ResponseTypeCode.ToSet(), spec.ResponseTypeIDToken.ToSet()).
-				Error("should contain code and id_token"),
+			v.Each(v.In(spec.ResponseTypeCode.ToSet()).Error("only code is supported")),
 		),
 		"grant_types_supported": v.Validate(d.GrantTypesSupported,
 			v.Required,
-			should.Contain(spec.GrantTypeAuthorizationCode, spec.GrantTypeImplicit).
-				Error("should contain authorization_code and implicit"),
+			should.Contain(spec.GrantTypeAuthorizationCode).Error("should contain authorization_code"),
+			v.Each(v.In(
+				spec.GrantTypeAuthorizationCode,
+				spec.GrantTypeRefreshToken,
+				spec.GrantTypeClientCredentials,
+			).Error("not supported")),
 		),
 		"response_modes_supported": v.Validate(d.ResponseModesSupported,
 			v.Required,
@@ -134,6 +161,10 @@ func (d *Discovery) Validate() error {
 			v.Required,
 			should.Contain(spec.RS256).Error("should contain RS256"),
 		),
+		"authorization_signing_alg_values_supported": v.Validate(d.AuthorizationSigningAlgValuesSupported,
+			v.When(lo.ContainsBy(d.ResponseModesSupported, spec.ResponseMode.IsJWT), v.Required),
+			v.Each(v.NotIn(spec.NoSignature).Error("must not be none")),
+		),
 		"request_object_signing_alg_values_supported": v.Validate(d.RequestObjectSigningAlgValuesSupported,
 			v.Required,
 			should.Contain(spec.RS256, spec.NoSignature).Error("should contain RS256 and none"),
@@ -207,11 +238,20 @@ func NewDiscovery(props *DiscoveryProperties) (*Discovery, error) {
 	}
 
 	discovery := &Discovery{
-		ResponseModesSupported:            []spec.ResponseMode{spec.ResponseModeQuery, spec.ResponseModeFragment},
-		GrantTypesSupported:               []spec.GrantType{spec.GrantTypeAuthorizationCode, spec.GrantTypeImplicit},
-		TokenEndpointAuthMethodsSupported: []spec.AuthenticationMethod{spec.ClientSecretBasic},
-		ClaimTypesSupported:               []spec.ClaimType{spec.ClaimTypeNormal},
-		RequestURIParameterSupported:      true,
+		ResponseModesSupported: []spec.ResponseMode{
+			spec.ResponseModeQuery,
+			spec.ResponseModeFragment,
+			spec.ResponseModeFormPost,
+			spec.ResponseModeQueryJWT,
+			spec.ResponseModeFragmentJWT,
+			spec.ResponseModeFormPostJWT,
+			spec.ResponseModeJWT,
+		},
+		AuthorizationSigningAlgValuesSupported: []spec.SignatureAlgorithm{spec.RS256},
+		GrantTypesSupported:                    []spec.GrantType{spec.GrantTypeAuthorizationCode},
+		TokenEndpointAuthMethodsSupported:      []spec.AuthenticationMethod{spec.ClientSecretBasic},
+		ClaimTypesSupported:                    []spec.ClaimType{spec.ClaimTypeNormal},
+		RequestURIParameterSupported:           true,
 	} // default values
 
 	if err = json.NewDecoder(reader).Decode(&discovery); err != nil {
@@ -3,6 +3,7 @@
 package wellknown_test
 
 import (
+	"github.com/absurdlab/tigerd/internal/spec"
 	"github.com/absurdlab/tigerd/internal/wellknown"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -34,6 +35,24 @@ func TestNewDiscovery(t *testing.T) {
 				assert.ErrorIs(t, err, wellknown.ErrDiscovery)
 			},
 		},
+		{
+			name: "unsupported response type",
+			hook: func(d *wellknown.Discovery) {
+				d.ResponseTypesSupported = append(d.ResponseTypesSupported, spec.ResponseTypeIDToken.ToSet())
+			},
+			assert: func(t *testing.T, discovery *wellknown.Discovery, err error) {
+				assert.ErrorIs(t, err, wellknown.ErrDiscovery)
+			},
+		},
+		{
+			name: "unsupported grant type",
+			hook: func(d *wellknown.Discovery) {
+				d.GrantTypesSupported = append(d.GrantTypesSupported, spec.GrantTypeImplicit)
+			},
+			assert: func(t *testing.T, discovery *wellknown.Discovery, err error) {
+				assert.ErrorIs(t, err, wellknown.ErrDiscovery)
+			},
+		},
 		// TODO more tests
 	}
 